@@ -0,0 +1,166 @@
+package mmapfile
+
+import (
+	"sync/atomic"
+	"unsafe"
+)
+
+// The methods in this file access a word of the mapping atomically, e.g. for
+// counters or lock-free structures shared between processes that map the same
+// file with a shared mapping. Words are in native byte order, and must be
+// naturally aligned in memory, i.e. 4-byte aligned for uint32 and 8-byte
+// aligned for uint64; for a file mapped from its start, this means off must be
+// a multiple of the word size. Otherwise, they return [ErrMisaligned].
+//
+// On the fallback backend, which reads the file into memory, the operations
+// are only atomic with respect to other goroutines of the same process.
+
+// word returns a pointer to the size bytes at off of the mapping, checking
+// that they are in bounds and aligned.
+//
+// The caller must hold f.mu.
+func (f *MmapFile) word(off, size int64, write bool) (unsafe.Pointer, error) {
+	if f.closed {
+		return nil, ErrClosed
+	}
+	if write && !f.writable {
+		return nil, ErrReadOnly
+	}
+	if !write && f.writeOnly {
+		return nil, ErrWriteOnly
+	}
+	if off < 0 {
+		return nil, ErrNegativeOffset
+	}
+	if off > int64(len(f.data))-size {
+		return nil, ErrOutOfRange
+	}
+
+	p := unsafe.Pointer(&f.data[off])
+	if uintptr(p)%uintptr(size) != 0 {
+		return nil, ErrMisaligned
+	}
+	if write {
+		f.dirty.Store(true)
+	}
+
+	return p, nil
+}
+
+// LoadUint32 atomically loads the uint32 at off.
+func (f *MmapFile) LoadUint32(off int64) (uint32, error) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	p, err := f.word(off, 4, false)
+	if err != nil {
+		return 0, err
+	}
+
+	return atomic.LoadUint32((*uint32)(p)), nil
+}
+
+// StoreUint32 atomically stores val at off.
+func (f *MmapFile) StoreUint32(off int64, val uint32) error {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	p, err := f.word(off, 4, true)
+	if err != nil {
+		return err
+	}
+	atomic.StoreUint32((*uint32)(p), val)
+
+	return f.writeThrough(off, 4)
+}
+
+// AddUint32 atomically adds delta to the uint32 at off and returns the new
+// value.
+func (f *MmapFile) AddUint32(off int64, delta uint32) (uint32, error) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	p, err := f.word(off, 4, true)
+	if err != nil {
+		return 0, err
+	}
+	v := atomic.AddUint32((*uint32)(p), delta)
+
+	return v, f.writeThrough(off, 4)
+}
+
+// CompareAndSwapUint32 atomically replaces the uint32 at off with new if it
+// equals old, and reports whether it did.
+func (f *MmapFile) CompareAndSwapUint32(off int64, old, new uint32) (bool, error) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	p, err := f.word(off, 4, true)
+	if err != nil {
+		return false, err
+	}
+	if !atomic.CompareAndSwapUint32((*uint32)(p), old, new) {
+		return false, nil
+	}
+
+	return true, f.writeThrough(off, 4)
+}
+
+// LoadUint64 atomically loads the uint64 at off.
+func (f *MmapFile) LoadUint64(off int64) (uint64, error) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	p, err := f.word(off, 8, false)
+	if err != nil {
+		return 0, err
+	}
+
+	return atomic.LoadUint64((*uint64)(p)), nil
+}
+
+// StoreUint64 atomically stores val at off.
+func (f *MmapFile) StoreUint64(off int64, val uint64) error {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	p, err := f.word(off, 8, true)
+	if err != nil {
+		return err
+	}
+	atomic.StoreUint64((*uint64)(p), val)
+
+	return f.writeThrough(off, 8)
+}
+
+// AddUint64 atomically adds delta to the uint64 at off and returns the new
+// value.
+func (f *MmapFile) AddUint64(off int64, delta uint64) (uint64, error) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	p, err := f.word(off, 8, true)
+	if err != nil {
+		return 0, err
+	}
+	v := atomic.AddUint64((*uint64)(p), delta)
+
+	return v, f.writeThrough(off, 8)
+}
+
+// CompareAndSwapUint64 atomically replaces the uint64 at off with new if it
+// equals old, and reports whether it did.
+func (f *MmapFile) CompareAndSwapUint64(off int64, old, new uint64) (bool, error) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	p, err := f.word(off, 8, true)
+	if err != nil {
+		return false, err
+	}
+	if !atomic.CompareAndSwapUint64((*uint64)(p), old, new) {
+		return false, nil
+	}
+
+	return true, f.writeThrough(off, 8)
+}
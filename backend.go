@@ -0,0 +1,36 @@
+package mmapfile
+
+import "os"
+
+// Backend provides the storage of the fallback backend, which reads a file
+// into memory instead of mapping it, e.g. to take the buffers from a pool, or
+// to observe the I/O in a test. See [WithBackend].
+//
+// The methods are called with the lock of the [MmapFile] held, so they need
+// not be safe for concurrent use on the same buffer.
+type Backend interface {
+	// Map returns a buffer of exactly size bytes holding the contents of file
+	// starting at offset off.
+	Map(file *os.File, off, size int64) ([]byte, error)
+
+	// Flush writes data, all or part of a buffer returned by Map, back to file
+	// at offset off.
+	Flush(file *os.File, off int64, data []byte) error
+
+	// Unmap releases a buffer returned by Map, up to its capacity, once it is
+	// no longer used.
+	Unmap(data []byte) error
+}
+
+// WithBackend makes the fallback backend store the file with b instead of
+// reading it into a newly allocated slice and writing it back with
+// [os.File.WriteAt], which is what the default Backend does. As a buffer may
+// be reused once it is unmapped, slices returned by [MmapFile.Bytes] and the
+// like must not be used after the file is closed or remapped.
+//
+// It has no effect on native backends, which map the file itself.
+func WithBackend(b Backend) Option {
+	return func(o *options) {
+		o.backend = b
+	}
+}
@@ -0,0 +1,78 @@
+package mmapfile
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"sync"
+)
+
+// Compression identifies a compression algorithm used by
+// [MmapFile.DecompressSection].
+type Compression uint8
+
+const (
+	// Gzip is the gzip format (RFC 1952), decompressed with [gzip.NewReader].
+	Gzip Compression = iota + 1
+)
+
+// Decompressor returns a reader that decompresses the data read from r.
+type Decompressor func(r io.Reader) (io.Reader, error)
+
+var decompressors = struct {
+	sync.RWMutex
+	m map[Compression]Decompressor
+}{
+	m: map[Compression]Decompressor{
+		Gzip: func(r io.Reader) (io.Reader, error) { return gzip.NewReader(r) },
+	},
+}
+
+// RegisterDecompressor registers fn as the decompressor for algo, replacing
+// any previously registered one. It is typically called from an init function
+// to add algorithms outside the standard library, e.g. zstd.
+func RegisterDecompressor(algo Compression, fn Decompressor) {
+	decompressors.Lock()
+	defer decompressors.Unlock()
+
+	if fn == nil {
+		delete(decompressors.m, algo)
+		return
+	}
+	decompressors.m[algo] = fn
+}
+
+// DecompressSection returns a reader that decompresses the compLen bytes at
+// off using the decompressor registered for algo.
+//
+// The compressed bytes are read directly from the mapping without copying;
+// only the decompressed stream allocates. Like the slice returned by
+// [MmapFile.Bytes], the reader must not be used after the file is closed or
+// remapped.
+//
+// It returns [ErrNegativeOffset] if off or compLen is negative,
+// [ErrOutOfRange] if the section extends past the end of the file, and
+// [ErrUnsupported] if no decompressor is registered for algo.
+func (f *MmapFile) DecompressSection(off, compLen int64, algo Compression) (io.Reader, error) {
+	decompressors.RLock()
+	fn, ok := decompressors.m[algo]
+	decompressors.RUnlock()
+
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	if f.closed {
+		return nil, ErrClosed
+	}
+	if f.writeOnly {
+		return nil, ErrWriteOnly
+	}
+	if err := f.validRange(off, compLen); err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrUnsupported
+	}
+
+	return fn(bytes.NewReader(f.data[off : off+compLen : off+compLen]))
+}
@@ -0,0 +1,104 @@
+package mmapfile
+
+import (
+	"os"
+	"unsafe"
+)
+
+// CopyFile copies the contents of the file named src to the file named dst,
+// mapping both and copying between the mappings in a single pass.
+//
+// dst is created with perm if it does not exist, and truncated to the size of
+// src otherwise. The destination is synced before CopyFile returns. It returns
+// the number of bytes copied.
+func CopyFile(dst, src string, perm os.FileMode) (n int64, err error) {
+	sf, err := Open(src)
+	if err != nil {
+		return 0, err
+	}
+	defer sf.Close()
+
+	size := int64(sf.Len())
+	if size == 0 {
+		// an empty file cannot be mapped, so just create or truncate dst
+		df, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+		if err != nil {
+			return 0, err
+		}
+
+		return 0, df.Close()
+	}
+
+	df, err := OpenFile(dst, os.O_RDWR|os.O_CREATE|os.O_TRUNC, perm, size)
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		if cErr := df.Close(); cErr != nil && err == nil {
+			err = cErr
+		}
+	}()
+
+	n = int64(copy(df.Bytes(), sf.Bytes()))
+
+	if err := df.Sync(); err != nil {
+		return n, err
+	}
+
+	return n, nil
+}
+
+// CopyRangeBetween copies the length bytes at srcOff of src to dstOff of dst,
+// directly between the mappings, e.g. to compact a log segment into another.
+// dst and src may be the same file, in which case the ranges may overlap.
+//
+// The range must lie within both files: it returns [ErrOutOfRange] if it
+// extends past the end of src, and [ErrWriteOutOfBounds] if it extends past
+// the end of dst, in which case nothing is copied. dst is locked for writing
+// and src for reading, in a consistent order, so concurrent calls in opposite
+// directions do not deadlock. It returns the number of bytes copied.
+func CopyRangeBetween(dst *MmapFile, dstOff int64, src *MmapFile, srcOff, length int64) (n int64, err error) {
+	defer countWrite(&dst.stats, dstOff, &n)
+
+	if dst == src {
+		dst.mu.Lock()
+		defer dst.mu.Unlock()
+	} else if uintptr(unsafe.Pointer(dst)) < uintptr(unsafe.Pointer(src)) {
+		dst.mu.Lock()
+		defer dst.mu.Unlock()
+		src.mu.RLock()
+		defer src.mu.RUnlock()
+	} else {
+		src.mu.RLock()
+		defer src.mu.RUnlock()
+		dst.mu.Lock()
+		defer dst.mu.Unlock()
+	}
+
+	if dst.closed || src.closed {
+		return 0, ErrClosed
+	}
+	if !dst.writable {
+		return 0, ErrReadOnly
+	}
+	if src.writeOnly {
+		return 0, ErrWriteOnly
+	}
+	if err := src.validRange(srcOff, length); err != nil {
+		return 0, err
+	}
+	if dstOff < 0 {
+		return 0, ErrNegativeOffset
+	}
+	if dstOff > int64(len(dst.data)) || length > int64(len(dst.data))-dstOff {
+		return 0, ErrWriteOutOfBounds
+	}
+	if length == 0 {
+		return 0, nil
+	}
+
+	dst.dirty.Store(true)
+	n = int64(copy(dst.data[dstOff:], src.data[srcOff:srcOff+length]))
+
+	return n, dst.writeThrough(dstOff, int(n))
+}
@@ -0,0 +1,79 @@
+package mmapfile
+
+import (
+	"os"
+	"sync"
+)
+
+// DoubleBuffer is a pair of writable files of the same size used as ping-pong
+// buffers, e.g. for a pipeline where a producer fills the back buffer while a
+// consumer reads the front one, and [DoubleBuffer.Swap] hands the filled
+// buffer over once it is complete.
+//
+// A DoubleBuffer is safe for concurrent use. The files returned by
+// [DoubleBuffer.Front] and [DoubleBuffer.Back] are only the front and back
+// buffers until the next Swap; coordinating when the producer and consumer
+// are done with them is up to the caller.
+type DoubleBuffer struct {
+	mu          sync.RWMutex
+	front, back *MmapFile
+}
+
+// NewDoubleBuffer opens or creates the files at frontPath and backPath for
+// reading and writing, each of the given size, as the initial front and back
+// buffers of a [DoubleBuffer]. It returns [ErrSizeMismatch] if either file
+// already exists with a different size.
+func NewDoubleBuffer(frontPath, backPath string, size int64) (*DoubleBuffer, error) {
+	front, err := OpenFileWith(frontPath, os.O_RDWR|os.O_CREATE, 0644, size, WithExactSize(size))
+	if err != nil {
+		return nil, err
+	}
+
+	back, err := OpenFileWith(backPath, os.O_RDWR|os.O_CREATE, 0644, size, WithExactSize(size))
+	if err != nil {
+		_ = front.Close()
+		return nil, err
+	}
+
+	return &DoubleBuffer{front: front, back: back}, nil
+}
+
+// Front returns the front buffer, which holds the data last handed over by
+// [DoubleBuffer.Swap].
+func (d *DoubleBuffer) Front() *MmapFile {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	return d.front
+}
+
+// Back returns the back buffer, which is being filled.
+func (d *DoubleBuffer) Back() *MmapFile {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	return d.back
+}
+
+// Swap atomically exchanges the front and back buffers, so that the buffer
+// that was filled becomes the front one. The contents of the buffers are left
+// as they are, and neither file offset is reset.
+func (d *DoubleBuffer) Swap() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.front, d.back = d.back, d.front
+}
+
+// Close closes both buffers, and returns the first error encountered.
+func (d *DoubleBuffer) Close() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	err := d.front.Close()
+	if bErr := d.back.Close(); bErr != nil && err == nil {
+		err = bErr
+	}
+
+	return err
+}
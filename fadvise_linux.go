@@ -0,0 +1,30 @@
+//go:build linux && (amd64 || arm64 || loong64 || mips64 || mips64le || ppc64 || ppc64le || riscv64)
+
+package mmapfile
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// fadvise issues posix_fadvise(2) over [off, off+length) of file. On these
+// architectures, fadvise64 takes 64-bit arguments in single registers.
+func fadvise(file *os.File, off, length int64, advice int) error {
+	rc, err := file.SyscallConn()
+	if err != nil {
+		return err
+	}
+
+	var errno syscall.Errno
+	if err := rc.Control(func(fd uintptr) {
+		_, _, errno = syscall.Syscall6(syscall.SYS_FADVISE64, fd, uintptr(off), uintptr(length), uintptr(advice), 0, 0)
+	}); err != nil {
+		return err
+	}
+	if errno != 0 {
+		return fmt.Errorf("mmapfile: fadvise failed: %w", errno)
+	}
+
+	return nil
+}
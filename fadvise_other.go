@@ -0,0 +1,10 @@
+//go:build !linux || !(amd64 || arm64 || loong64 || mips64 || mips64le || ppc64 || ppc64le || riscv64)
+
+package mmapfile
+
+import "os"
+
+// fadvise reports that posix_fadvise(2) is not available.
+func fadvise(file *os.File, off, length int64, advice int) error {
+	return ErrUnsupported
+}
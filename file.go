@@ -0,0 +1,32 @@
+package mmapfile
+
+import (
+	"io/fs"
+	"os"
+)
+
+// File adapts an [MmapFile] to file system abstractions modeled on
+// [os.File], such as afero.File, whose method sets include directory methods
+// that a mapped file cannot support.
+//
+// All methods of the embedded [MmapFile] remain available; File only adds
+// [File.Readdir] and [File.Readdirnames], which fail as they do for a regular
+// [os.File].
+type File struct {
+	*MmapFile
+}
+
+// AsFile returns f wrapped in a [File].
+func (f *MmapFile) AsFile() File {
+	return File{f}
+}
+
+// Readdir returns an error, as a mapped file is not a directory.
+func (f File) Readdir(count int) ([]os.FileInfo, error) {
+	return nil, &fs.PathError{Op: "readdir", Path: f.Name(), Err: ErrUnsupported}
+}
+
+// Readdirnames returns an error, as a mapped file is not a directory.
+func (f File) Readdirnames(n int) ([]string, error) {
+	return nil, &fs.PathError{Op: "readdirnames", Path: f.Name(), Err: ErrUnsupported}
+}
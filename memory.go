@@ -0,0 +1,64 @@
+package mmapfile
+
+import (
+	"os"
+	"time"
+)
+
+// memoryName is the name of files created by [NewMemory].
+const memoryName = "<memory>"
+
+// NewMemory returns a writable [MmapFile] of the given size that is backed by
+// plain memory instead of a file, e.g. as a test double for code that takes
+// an [io.ReadWriteSeeker] or [io.ReaderAt]. It is available on every
+// platform, and reads, writes and seeks behave exactly as they do on a
+// file-backed mapping of the same size. The contents start out zeroed, and
+// are discarded on [Close].
+//
+// There is no file behind it: [Sync] and [Prefetch] are no-ops, [Name]
+// returns "<memory>", [Stat] reports a mode of 0600 and the current size, and
+// methods that need a file, such as [Truncate], [Rename], or [Overlay], return
+// [ErrUnsupported]. A negative size panics, as with make.
+func NewMemory(size int64) *MmapFile {
+	return &MmapFile{
+		data:     make([]byte, size),
+		name:     memoryName,
+		writable: true,
+		memory:   true,
+	}
+}
+
+// memoryFileInfo is the [os.FileInfo] of a file created by [NewMemory].
+type memoryFileInfo struct {
+	size int64
+}
+
+// Name implements [os.FileInfo].
+func (fi memoryFileInfo) Name() string {
+	return memoryName
+}
+
+// Size implements [os.FileInfo].
+func (fi memoryFileInfo) Size() int64 {
+	return fi.size
+}
+
+// Mode implements [os.FileInfo].
+func (fi memoryFileInfo) Mode() os.FileMode {
+	return 0600
+}
+
+// ModTime implements [os.FileInfo].
+func (fi memoryFileInfo) ModTime() time.Time {
+	return time.Time{}
+}
+
+// IsDir implements [os.FileInfo].
+func (fi memoryFileInfo) IsDir() bool {
+	return false
+}
+
+// Sys implements [os.FileInfo].
+func (fi memoryFileInfo) Sys() any {
+	return nil
+}
@@ -5,28 +5,67 @@
 // many contexts.
 //
 // Limitations:
-//   - File size is fixed at open time; the file cannot grow.
-//   - Truncate is not supported.
+//   - File size is fixed at open time, except through [MmapFile.Grow] and
+//     [MmapFile.Truncate], which remap the file.
 //   - Directory operations are not supported.
 package mmapfile
 
 import (
+	"bufio"
+	"bytes"
+	"context"
 	"errors"
+	"fmt"
+	"hash"
 	"io"
+	"io/fs"
+	"math"
 	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
 	"sync"
+	"sync/atomic"
+	"time"
+	"unicode/utf8"
+	"unsafe"
 )
 
 // Common errors.
 var (
-	ErrClosed           = errors.New("mmapfile: file is closed")
-	ErrReadOnly         = errors.New("mmapfile: file is read-only")
-	ErrInvalidWhence    = errors.New("mmapfile: invalid whence")
-	ErrNegativeOffset   = errors.New("mmapfile: negative offset")
-	ErrOffsetTooLarge   = errors.New("mmapfile: offset too large")
-	ErrWriteOutOfBounds = errors.New("mmapfile: write would exceed file size")
+	ErrClosed                = errors.New("mmapfile: file is closed")
+	ErrReadOnly              = errors.New("mmapfile: file is read-only")
+	ErrWriteOnly             = errors.New("mmapfile: file is write-only")
+	ErrInvalidWhence         = errors.New("mmapfile: invalid whence")
+	ErrNegativeOffset        = errors.New("mmapfile: negative offset")
+	ErrOffsetTooLarge        = errors.New("mmapfile: offset too large")
+	ErrWriteOutOfBounds      = errors.New("mmapfile: write would exceed file size")
+	ErrOutOfRange            = errors.New("mmapfile: range exceeds file size")
+	ErrSizeMismatch          = errors.New("mmapfile: file size does not match expected size")
+	ErrNegativeCount         = errors.New("mmapfile: negative count")
+	ErrStaleView             = errors.New("mmapfile: view is stale")
+	ErrEmpty                 = errors.New("mmapfile: file is empty")
+	ErrPartialRecord         = errors.New("mmapfile: file size is not a multiple of the record size")
+	ErrNotRegularFile        = errors.New("mmapfile: not a regular file")
+	ErrInvalidSize           = errors.New("mmapfile: size must be positive when creating a file")
+	ErrLocked                = errors.New("mmapfile: file is locked by another opener")
+	ErrFileTooLarge          = errors.New("mmapfile: file exceeds the maximum size")
+	ErrMisaligned            = errors.New("mmapfile: offset is not aligned")
+	ErrNotClosed             = errors.New("mmapfile: file is not closed")
+	ErrInUse                 = errors.New("mmapfile: file is in use by other handles")
+	ErrAddressSpaceExhausted = errors.New("mmapfile: not enough address space to map the file")
+	ErrUnsupported           = fmt.Errorf("mmapfile: %w", errors.ErrUnsupported)
 )
 
+// maxInt is the largest offset that can index the mapping on this platform.
+//
+// It is a variable so tests can simulate a platform with a smaller int.
+var maxInt int64 = math.MaxInt
+
+// maxEmptyReads is the number of consecutive (0, nil) reads tolerated from an
+// [io.Reader] before giving up with [io.ErrNoProgress], as in [bufio].
+const maxEmptyReads = 100
+
 // MmapFile represents a memory-mapped file that implements an [os.File]-like
 // interface.
 //
@@ -36,18 +75,35 @@ var (
 //
 // Use [ReadAt]/[WriteAt] for concurrent positional I/O.
 type MmapFile struct {
-	mu       sync.RWMutex
-	data     []byte
-	offset   int64
-	name     string
-	writable bool
-	closed   bool
-	platform any //nolint:unused // platform-specific data (e.g., file handle for fallback impl)
+	mu        sync.RWMutex
+	data      []byte
+	base      int64 // file offset of data[0] (see OpenFileAt)
+	offset    int64
+	name      string
+	writable  bool
+	writeOnly bool
+	private   bool
+	exclusive bool    // WriteAt takes the write lock (see WithExclusiveWriteAt)
+	zeroFill  bool    // reads past the end yield zeros (see WithZeroFillReads)
+	unshared  bool    // opened exclusively (see WithShared)
+	info      MapInfo // protection and flags of the mapping (see MapInfo)
+	writeThru bool    // writes also go straight to the file (see WithWriteThrough)
+	growBy    int64   // headroom added when a write grows the file (see WithGrowIncrement)
+	opts      options // options it was opened with (see Reopen)
+	memory    bool    // not backed by a file (see NewMemory)
+	region    bool    // maps a region of the file (see OpenFileAt)
+	closed    bool
+	dirty     atomic.Bool  // modified since the last write-back
+	lastSync  atomic.Int64 // monotonic time of the last SyncThrottled flush (see clock)
+	stats     stats        // I/O counters (see Stats)
+	gen       uint64       // incremented every time data is remapped
+	platform  any          //nolint:unused // platform-specific data (e.g., file handle for fallback impl)
 }
 
 // fileHolder holds the underlying file.
 type fileHolder struct {
-	file *os.File
+	file     *os.File
+	borrowed bool // owned by the caller; not closed on Close
 }
 
 // Compile-time interface checks.
@@ -61,13 +117,240 @@ var (
 	_ io.ReaderFrom   = (*MmapFile)(nil)
 	_ io.WriterTo     = (*MmapFile)(nil)
 	_ io.StringWriter = (*MmapFile)(nil)
+	_ io.RuneReader   = (*MmapFile)(nil)
 )
 
+// OpenFileAt is like [OpenFile], but maps only the length bytes of the named
+// file starting at fileOffset, e.g. the payload of a container format.
+// fileOffset need not be page-aligned.
+//
+// Offset 0 of the returned [MmapFile] corresponds to fileOffset in the file:
+// all offsets passed to its methods are relative to it, and [Len] reports
+// length. The region must lie within the file, unless [os.O_CREATE] is given,
+// in which case a file that is too short is extended. [os.O_TRUNC] and
+// [os.O_APPEND] are not supported.
+func OpenFileAt(name string, flag int, perm os.FileMode, fileOffset, length int64) (*MmapFile, error) {
+	if fileOffset < 0 || length < 0 {
+		return nil, ErrNegativeOffset
+	}
+	if length > math.MaxInt64-fileOffset {
+		return nil, ErrOffsetTooLarge
+	}
+	if flag&(os.O_TRUNC|os.O_APPEND) != 0 {
+		return nil, fmt.Errorf("mmapfile: O_TRUNC and O_APPEND are not supported by OpenFileAt")
+	}
+
+	writable := flag&os.O_RDWR != 0 || flag&os.O_WRONLY != 0
+	writeOnly := flag&(os.O_RDWR|os.O_WRONLY) == os.O_WRONLY
+	create := flag&os.O_CREATE != 0
+
+	osFlag := os.O_RDONLY
+	if writable {
+		osFlag = os.O_RDWR
+	}
+	osFlag |= flag & (os.O_CREATE | os.O_EXCL)
+
+	file, err := os.OpenFile(name, osFlag, perm)
+	if err != nil {
+		return nil, err
+	}
+
+	fi, err := file.Stat()
+	if err != nil {
+		_ = file.Close()
+		return nil, err
+	}
+	if err := checkMode(fi, options{}); err != nil {
+		_ = file.Close()
+		return nil, err
+	}
+
+	if end := fileOffset + length; fi.Size() < end {
+		if !create || !writable {
+			_ = file.Close()
+			return nil, ErrOutOfRange
+		}
+		if err := file.Truncate(end); err != nil {
+			_ = file.Close()
+			return nil, fmt.Errorf("mmapfile: failed to set file size: %w", err)
+		}
+	}
+
+	mf, err := mapFile(file, name, writable, writeOnly, fileOffset, length, options{})
+	if err != nil {
+		_ = file.Close()
+		return nil, err
+	}
+	mf.region = true
+
+	return mf, nil
+}
+
+// OpenReadOnly memory-maps the named file for reading only, regardless of the
+// permissions on the file, so that nothing can be written through the
+// returned [MmapFile]: the mapping is created without write protection, and
+// [Write], [WriteAt], [ReadFrom], and the other methods that modify the file
+// return [ErrReadOnly], while [Sync] does nothing.
+//
+// It is the same as [Open], and is spelled out for code that wants to make
+// the guarantee explicit. The file must exist; it is never created.
+func OpenReadOnly(name string) (*MmapFile, error) {
+	return OpenFileWith(name, os.O_RDONLY, 0, 0)
+}
+
+// OpenLimited is like [Open], but fails with [ErrFileTooLarge] if the named
+// file is larger than maxSize bytes, rather than mapping it. It is shorthand
+// for [OpenFileWith] with [os.O_RDONLY] and [WithMaxSize].
+func OpenLimited(name string, maxSize int64) (*MmapFile, error) {
+	return OpenFileWith(name, os.O_RDONLY, 0, 0, WithMaxSize(maxSize))
+}
+
+// NewFromFile memory-maps an already open file, e.g. one created with
+// memfd_create(2) or inherited from a parent process.
+//
+// The mapping covers the file's current size, and its name is taken from
+// file.Name(). If writable is true, file must have been opened for reading
+// and writing.
+//
+// By default, the returned [MmapFile] takes ownership of file and closes it on
+// [Close]. Pass [WithBorrowedFd] to leave file open, in which case the caller
+// must keep it open until the [MmapFile] is closed. If NewFromFile fails, file
+// is never closed.
+func NewFromFile(file *os.File, writable bool, opts ...Option) (*MmapFile, error) {
+	fi, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	o := newOptions(opts)
+	o.unshared = false // the sharing mode of an open file cannot be changed
+	if err := checkMode(fi, o); err != nil {
+		return nil, err
+	}
+
+	return mapFile(file, file.Name(), writable, false, 0, fi.Size(), o)
+}
+
+// openSize returns the size of the mapping of a file opened by [OpenFileWith]
+// with fi as its [os.FileInfo], and checks it against o, so that a file is not
+// created or resized only to be rejected (see [WithExactSize] and
+// [WithMaxSize]).
+func openSize(fi os.FileInfo, create, trunc bool, size int64, o options) (int64, error) {
+	fileSize := fi.Size()
+
+	switch {
+	case !fi.Mode().IsRegular():
+		// a special file has no meaningful size, so map size bytes of it as is
+		fileSize = size
+	case create && fileSize == 0 && size > 0, trunc && size > 0:
+		fileSize = size
+	}
+
+	return fileSize, o.checkSize(fileSize)
+}
+
+// createsFile reports whether opening the named file with [os.O_CREATE] in
+// flag creates it, so that it can be removed again if the open fails.
+func createsFile(name string, flag int) bool {
+	if flag&os.O_CREATE == 0 {
+		return false
+	}
+	_, err := os.Lstat(name)
+
+	return errors.Is(err, fs.ErrNotExist)
+}
+
+// checkCreateSize returns [ErrInvalidSize] if opening the named file for
+// writing with [os.O_CREATE] and size would leave it empty, as nothing could
+// be written to it, unless o allows writes to grow it (see
+// [WithGrowIncrement]).
+func checkCreateSize(name string, size int64, o options) error {
+	if size > 0 || o.growIncrement > 0 {
+		return nil
+	}
+
+	fi, err := os.Stat(name)
+	if errors.Is(err, fs.ErrNotExist) || (err == nil && fi.Mode().IsRegular() && fi.Size() == 0) {
+		return ErrInvalidSize
+	}
+
+	return nil
+}
+
+// verifySink keeps the loads in verify from being optimized away.
+var verifySink byte
+
+// verify reads one byte of every page of b, the start of a mapping, turning
+// a fault on an unreadable page into an error (see [WithVerify]).
+func verify(b []byte) (err error) {
+	defer debug.SetPanicOnFault(debug.SetPanicOnFault(true))
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("mmapfile: mapping is not readable: %v", r)
+		}
+	}()
+
+	var sum byte
+	for i := 0; i < len(b); i += PageSize() {
+		sum += b[i]
+	}
+	verifySink = sum
+
+	return nil
+}
+
+// checkMode returns [ErrNotRegularFile] unless fi describes a file that may be
+// mapped under o.
+func checkMode(fi os.FileInfo, o options) error {
+	mode := fi.Mode()
+	if mode.IsRegular() || (o.allowSpecial && !mode.IsDir()) {
+		return nil
+	}
+
+	return fmt.Errorf("%w: %s", ErrNotRegularFile, fi.Name())
+}
+
 // Name returns the name of the file as presented to [Open] or [OpenFile].
+//
+// After [Rename], it returns the new name.
 func (f *MmapFile) Name() string {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
 	return f.name
 }
 
+// Rename renames (moves) the underlying file to newpath with [os.Rename] and
+// updates [Name] and [Stat] to match.
+//
+// The mapping refers to the file itself rather than its path, so it is not
+// affected: data remains readable and writable through f. On Windows, the
+// rename may fail while the file is open by another process.
+func (f *MmapFile) Rename(newpath string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.closed {
+		return ErrClosed
+	}
+	if f.memory {
+		return ErrUnsupported
+	}
+
+	if err := os.Rename(f.name, newpath); err != nil {
+		return err
+	}
+	f.name = newpath
+
+	return nil
+}
+
+// PageSize returns the memory page size, which is the granularity of
+// [MmapFile.Prefetch], [MmapFile.Resident], and of the mapping itself.
+func PageSize() int {
+	return os.Getpagesize()
+}
+
 // Len returns the length of the memory-mapped region.
 func (f *MmapFile) Len() int {
 	f.mu.RLock()
@@ -76,226 +359,2370 @@ func (f *MmapFile) Len() int {
 	return len(f.data)
 }
 
-// Bytes returns direct access to the underlying memory-mapped byte slice.
-//
-// WARNING: The returned slice is only valid until [Close] is called.
-// Modifying the slice on a read-only file will cause a panic/segfault.
-// The caller is responsible for synchronization when using this method.
-func (f *MmapFile) Bytes() []byte {
+// Pages returns the number of pages covering the file contents, that is,
+// [Len] divided by [PageSize], rounded up.
+func (f *MmapFile) Pages() int {
 	f.mu.RLock()
 	defer f.mu.RUnlock()
-	return f.data
+
+	pageSize := PageSize()
+
+	return (len(f.data) + pageSize - 1) / pageSize
 }
 
-// Read reads up to len(b) bytes from the file, advancing the file offset.
+// Overlay returns a new copy-on-write [MmapFile] over the same file, e.g. to
+// patch a few pages of a large base image without copying it.
 //
-// It returns the number of bytes read and any error encountered.
-// At end of file, Read returns 0, io.EOF.
-func (f *MmapFile) Read(b []byte) (n int, err error) {
-	f.mu.Lock()
-	defer f.mu.Unlock()
+// The overlay is a private mapping (see [WithPrivate]) of the same region of
+// the file, and is always writable, even if f is read-only. Writes to the
+// overlay are never visible to f, to other overlays, or to the file. Pages
+// that have not been written through the overlay may reflect later changes
+// to the file, depending on the platform.
+//
+// The overlay has its own duplicate of the file descriptor, so it remains
+// valid after f is closed, and must be closed separately.
+func (f *MmapFile) Overlay() (*MmapFile, error) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
 
 	if f.closed {
-		return 0, ErrClosed
+		return nil, ErrClosed
 	}
-	if f.offset >= int64(len(f.data)) {
-		return 0, io.EOF
+
+	fh, ok := f.platform.(*fileHolder)
+	if !ok || fh.file == nil {
+		return nil, ErrUnsupported
 	}
 
-	n = copy(b, f.data[f.offset:])
-	f.offset += int64(n)
+	file, err := dupFile(fh.file)
+	if err != nil {
+		return nil, err
+	}
 
-	if n < len(b) {
-		return n, io.EOF
+	mf, err := mapFile(file, f.name, true, false, f.base, int64(len(f.data)), options{private: true})
+	if err != nil {
+		_ = file.Close()
+		return nil, err
 	}
-	return n, nil
+
+	return mf, nil
 }
 
-// ReadAt reads len(b) bytes from the file starting at byte offset off.
+// MapInfo describes how a file is mapped, in terms of the raw values passed
+// to the operating system.
 //
-// It returns the number of bytes read and any error encountered.
-// ReadAt does not affect the file offset used by [Read]/[Write]/[Seek].
+// On Unix, Prot holds the PROT_* protection and Flags the MAP_* flags passed
+// to mmap(2), e.g. syscall.MAP_SHARED or syscall.MAP_PRIVATE. On Windows, Prot
+// holds the PAGE_* protection of the file mapping object and Flags the
+// FILE_MAP_* access of the view.
+type MapInfo struct {
+	Prot  int
+	Flags int
+}
+
+// MapInfo returns the protection and flags the file was mapped with at open
+// time, e.g. to verify in a test that [WithPrivate] or [WithPopulate] took
+// effect. Remaps by [Grow], [Truncate], and [Refresh] keep the protection and
+// sharing mode, but not the other flags.
 //
-// It is safe for concurrent use.
-func (f *MmapFile) ReadAt(b []byte, off int64) (n int, err error) {
+// It returns [ErrUnsupported] on the fallback backend, which does not map
+// files, and for files created by [NewMemory].
+func (f *MmapFile) MapInfo() (MapInfo, error) {
 	f.mu.RLock()
 	defer f.mu.RUnlock()
 
 	if f.closed {
-		return 0, ErrClosed
+		return MapInfo{}, ErrClosed
 	}
-	if off < 0 {
-		return 0, ErrNegativeOffset
-	}
-	if off >= int64(len(f.data)) {
-		return 0, io.EOF
+	if !nativeMapping || f.memory {
+		return MapInfo{}, ErrUnsupported
 	}
 
-	n = copy(b, f.data[off:])
-	if n < len(b) {
-		return n, io.EOF
+	return f.info, nil
+}
+
+// IsExclusive reports whether the file was opened exclusively with
+// [WithShared](false), so that no other exclusive opener can map it until it
+// is closed.
+func (f *MmapFile) IsExclusive() (bool, error) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	if f.closed {
+		return false, ErrClosed
 	}
 
-	return n, nil
+	return f.unshared, nil
 }
 
-// Write writes len(b) bytes to the file, advancing the file offset.
+// ReadOnly reports whether the file is read-only.
+func (f *MmapFile) ReadOnly() bool {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	return !f.writable
+}
+
+// SetReadOnly downgrades a writable file to read-only, so that subsequent
+// writes return [ErrReadOnly].
 //
-// It returns the number of bytes written and any error encountered.
-// Write returns an error if the file was opened read-only or if the
-// write would exceed the file's size.
-func (f *MmapFile) Write(b []byte) (n int, err error) {
+// On native backends the mapping itself is re-protected as read-only, so
+// writes through a slice returned by [Bytes] will fault as well. Changes made
+// before the downgrade are kept, but [Sync] becomes a no-op afterwards; call
+// it first if they must be flushed to disk.
+//
+// There is no way to make the file writable again once it has been
+// downgraded. Calling SetReadOnly on a read-only file is a no-op.
+func (f *MmapFile) SetReadOnly() error {
 	f.mu.Lock()
 	defer f.mu.Unlock()
 
 	if f.closed {
-		return 0, ErrClosed
+		return ErrClosed
 	}
 	if !f.writable {
-		return 0, ErrReadOnly
-	}
-
-	available := int64(len(f.data)) - f.offset
-	if available <= 0 {
-		return 0, ErrWriteOutOfBounds
+		return nil
 	}
 
-	if int64(len(b)) > available {
-		n = copy(f.data[f.offset:], b[:available])
-		f.offset += int64(n)
-		return n, ErrWriteOutOfBounds
+	if !f.memory {
+		if err := f.setReadOnly(); err != nil {
+			return err
+		}
 	}
+	f.writable = false
 
-	n = copy(f.data[f.offset:], b)
-	f.offset += int64(n)
-
-	return n, nil
+	return nil
 }
 
-// WriteAt writes len(b) bytes to the file starting at byte offset off.
+// Refresh picks up growth of the underlying file, e.g. when tailing a file
+// that another process appends to. If the file has grown since it was mapped,
+// Refresh remaps it at the new size and reports true; [Len] then reflects the
+// new size, and all previously mapped offsets remain readable with the same
+// contents. If the file has not grown, the mapping is left untouched.
 //
-// It returns the number of bytes written and any error encountered.
-// WriteAt does not affect the file offset used by [Read]/[Write]/[Seek].
+// A successful remap increments [Generation] and invalidates slices
+// previously returned by [Bytes], [Peek], and the like, as well as [View]s.
 //
-// It is safe for concurrent use (though overlapping writes MAY interleave).
-func (f *MmapFile) WriteAt(b []byte, off int64) (n int, err error) {
-	f.mu.RLock()
-	defer f.mu.RUnlock()
+// Refresh is only supported on read-only files; it returns [ErrUnsupported]
+// for writable ones.
+func (f *MmapFile) Refresh() (grew bool, err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
 
 	if f.closed {
-		return 0, ErrClosed
+		return false, ErrClosed
 	}
-	if !f.writable {
-		return 0, ErrReadOnly
+	if f.writable {
+		return false, ErrUnsupported
 	}
-	if off < 0 {
-		return 0, ErrNegativeOffset
+
+	fh, ok := f.platform.(*fileHolder)
+	if !ok || fh.file == nil {
+		return false, ErrUnsupported
 	}
-	if off >= int64(len(f.data)) {
-		return 0, ErrWriteOutOfBounds
+
+	fi, err := fh.file.Stat()
+	if err != nil {
+		return false, err
 	}
 
-	available := int64(len(f.data)) - off
-	if int64(len(b)) > available {
-		n = copy(f.data[off:], b[:available])
-		return n, ErrWriteOutOfBounds
+	size := fi.Size() - f.base
+	if size <= int64(len(f.data)) {
+		return false, nil
+	}
+	if size > maxInt {
+		return false, fmt.Errorf("%w: file %q is %d bytes", ErrAddressSpaceExhausted, f.name, size)
 	}
 
-	n = copy(f.data[off:], b)
+	if err := f.remap(fh.file, size); err != nil {
+		return false, err
+	}
+	f.gen++
 
-	return n, nil
+	return true, nil
 }
 
-// WriteString is like Write, but writes the contents of string s.
-func (f *MmapFile) WriteString(s string) (n int, err error) {
-	return f.Write([]byte(s))
+// IsMapped reports whether the file contents are backed by a real OS memory
+// mapping.
+//
+// It returns false on platforms using the fallback backend, where the file is
+// read into memory and written back on [Sync] and [Close], as well as for
+// empty or closed files and those created by [NewMemory], which have no
+// mapping.
+func (f *MmapFile) IsMapped() bool {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	return nativeMapping && !f.closed && !f.memory && len(f.data) > 0
 }
 
-// Seek sets the offset for the next Read or Write on the file,
-// interpreted according to whence:
-//   - [io.SeekStart] (0): relative to the start of the file
-//   - [io.SeekCurrent] (1): relative to the current offset
-//   - [io.SeekEnd] (2): relative to the end of the file
+// IsShared reports whether changes to the file are shared with other
+// processes mapping it, as with the default MAP_SHARED mapping on Unix, so
+// that code coordinating through the mapping can check for it up front.
 //
-// It returns the new offset and any error encountered.
-func (f *MmapFile) Seek(offset int64, whence int) (int64, error) {
-	f.mu.Lock()
-	defer f.mu.Unlock()
+// It returns false for private mappings (see [WithPrivate]), including
+// [Overlay]s, on platforms using the fallback backend, whose in-memory copy
+// is never shared, for files created by [NewMemory], and for closed files.
+func (f *MmapFile) IsShared() bool {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
 
-	if f.closed {
-		return 0, ErrClosed
-	}
+	return nativeMapping && !f.closed && !f.private && !f.memory
+}
 
-	var newOffset int64
-	switch whence {
-	case io.SeekStart:
-		newOffset = offset
-	case io.SeekCurrent:
-		newOffset = f.offset + offset
-	case io.SeekEnd:
-		newOffset = int64(len(f.data)) + offset
-	default:
-		return 0, ErrInvalidWhence
-	}
+// Generation returns a counter that is incremented every time the file is
+// remapped.
+//
+// Any remap invalidates slices previously returned by [Bytes], so callers that
+// cache such a slice can compare generations to detect that it is stale and
+// must be fetched again.
+func (f *MmapFile) Generation() uint64 {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
 
-	if newOffset < 0 {
-		return 0, ErrNegativeOffset
-	}
+	return f.gen
+}
 
-	f.offset = newOffset
+// Bytes returns direct access to the underlying memory-mapped byte slice.
+//
+// WARNING: The returned slice is only valid until [Close] is called, or until
+// the file is remapped (see [Generation]).
+// Modifying the slice on a read-only file will cause a panic/segfault.
+// The caller is responsible for synchronization when using this method.
+//
+// Since writes through the slice cannot be observed, calling Bytes on a
+// writable file marks it as modified, whether or not it is written to, and
+// later writes through the slice are not tracked at all: they are only
+// written back on the fallback backend, or by [WithWriteThrough], if the
+// file happens to be marked modified again. Use [MutableBytes] to report
+// such writes explicitly.
+func (f *MmapFile) Bytes() []byte {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
 
-	return newOffset, nil
+	if f.writable {
+		f.dirty.Store(true)
+	}
+
+	return f.data[:len(f.data):len(f.data)]
 }
 
-// ReadFrom reads data from r until EOF and writes it to the file.
+// MutableBytes is like [Bytes], but for writing through the slice: it does not
+// mark the file as modified, and instead returns a function with which the
+// caller reports each range [off, off+length) it has modified, after the fact.
 //
-// It returns the number of bytes read and any error encountered.
-func (f *MmapFile) ReadFrom(r io.Reader) (n int64, err error) {
-	f.mu.Lock()
-	defer f.mu.Unlock()
+// Reporting a range marks the file as modified for [Sync] and [Close], and
+// with [WithWriteThrough] writes it to the file right away, as [WriteAt]
+// would. Unreported writes may never be written back on the fallback backend.
+// Ranges are clipped to the file, and reports are ignored once the file is
+// closed or remapped, along with the slice. It returns [ErrReadOnly] for a
+// read-only file.
+func (f *MmapFile) MutableBytes() ([]byte, func(off, length int64), error) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
 
 	if f.closed {
-		return 0, ErrClosed
+		return nil, nil, ErrClosed
 	}
 	if !f.writable {
-		return 0, ErrReadOnly
+		return nil, nil, ErrReadOnly
 	}
 
-	for f.offset < int64(len(f.data)) {
-		m, readErr := r.Read(f.data[f.offset:])
-		n += int64(m)
-		f.offset += int64(m)
-		if readErr == io.EOF {
-			return n, nil
+	gen := f.gen
+	mark := func(off, length int64) {
+		f.mu.RLock()
+		defer f.mu.RUnlock()
+
+		if f.closed || f.gen != gen {
+			return
 		}
-		if readErr != nil {
-			return n, readErr
+
+		size := int64(len(f.data))
+		end := off + length
+		if length > 0 && end < off {
+			end = size // overflow
+		}
+		off = min(max(off, 0), size)
+		end = min(max(end, 0), size)
+		if end <= off {
+			return
 		}
-	}
 
-	// Check if there's more data in the reader
-	var buf [1]byte
-	_, readErr := r.Read(buf[:])
-	if readErr == nil || readErr != io.EOF {
-		return n, ErrWriteOutOfBounds
+		f.dirty.Store(true)
+		// on failure, the range is still written back by Sync or Close
+		_ = f.writeThrough(off, int(end-off))
 	}
 
-	return n, nil
+	return f.data[:len(f.data):len(f.data)], mark, nil
 }
 
-// WriteTo writes the entire file contents to w.
+// WithBytes calls fn with direct access to the mapped byte slice, as returned
+// by [Bytes], while holding the read lock, so that the file cannot be closed
+// or remapped, e.g. by [Truncate] or [Grow], until fn returns. It returns the
+// error returned by fn.
 //
-// It returns the number of bytes written and any error encountered.
-func (f *MmapFile) WriteTo(w io.Writer) (n int64, err error) {
+// This allows zero-copy processing without the lifetime hazards of [Bytes]:
+// b must not be retained after fn returns. fn must not call methods of f, as
+// a method waiting for the write lock, or a concurrent one, would deadlock.
+// As with [Bytes], calling WithBytes on a writable file marks it as modified.
+func (f *MmapFile) WithBytes(fn func(b []byte) error) error {
 	f.mu.RLock()
 	defer f.mu.RUnlock()
 
 	if f.closed {
-		return 0, ErrClosed
+		return ErrClosed
+	}
+	if f.writable {
+		f.dirty.Store(true)
 	}
 
-	written, err := w.Write(f.data)
-	return int64(written), err
+	return fn(f.data[:len(f.data):len(f.data)])
+}
+
+// Pointer returns the base address and length of the mapping, e.g. to hand
+// the mapped region to a C library.
+//
+// WARNING: The pointer is only valid until [Close] is called, or until the
+// file is remapped (see [Generation]), and must not be retained (e.g. by C
+// code) beyond that. The same caveats as for [Bytes] apply, including
+// marking writable files as modified.
+//
+// It returns [ErrEmpty] for an empty file, which has no mapping.
+func (f *MmapFile) Pointer() (unsafe.Pointer, int, error) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	if f.closed {
+		return nil, 0, ErrClosed
+	}
+	if len(f.data) == 0 {
+		return nil, 0, ErrEmpty
+	}
+	if f.writable {
+		f.dirty.Store(true)
+	}
+
+	return unsafe.Pointer(&f.data[0]), len(f.data), nil
+}
+
+// BytesCopy returns a copy of the file contents.
+//
+// Unlike [Bytes], the returned slice is freshly allocated and remains valid
+// after [Close] or a remap. It returns nil if the file is closed or
+// write-only.
+func (f *MmapFile) BytesCopy() []byte {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	if f.closed || f.writeOnly {
+		return nil
+	}
+
+	return bytes.Clone(f.data)
+}
+
+// BytesCopyRange returns a copy of the region [off, off+length) of the file.
+//
+// It returns [ErrNegativeOffset] if off or length is negative, and
+// [ErrOutOfRange] if the region extends past the end of the file.
+func (f *MmapFile) BytesCopyRange(off, length int64) ([]byte, error) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	if f.closed {
+		return nil, ErrClosed
+	}
+	if f.writeOnly {
+		return nil, ErrWriteOnly
+	}
+	if err := f.validRange(off, length); err != nil {
+		return nil, err
+	}
+
+	b := make([]byte, length)
+	copy(b, f.data[off:])
+
+	return b, nil
+}
+
+// ReadAll returns a copy of the entire file in a single allocation.
+//
+// Unlike [io.ReadAll], it neither depends on nor advances the file offset.
+// It returns [ErrClosed] if the file is closed and [ErrWriteOnly] if the
+// file was opened write-only. Use [Bytes] instead if aliasing the mapping is
+// acceptable.
+func (f *MmapFile) ReadAll() ([]byte, error) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	if f.closed {
+		return nil, ErrClosed
+	}
+	if f.writeOnly {
+		return nil, ErrWriteOnly
+	}
+
+	b := make([]byte, len(f.data))
+	copy(b, f.data)
+
+	return b, nil
+}
+
+// Read reads up to len(b) bytes from the file, advancing the file offset.
+//
+// It returns the number of bytes read and any error encountered.
+// At end of file, Read returns 0, io.EOF, unless the file was opened with
+// [WithZeroFillReads].
+//
+// A read that fills b returns n == len(b) and a nil error, even if it ends
+// exactly at the end of the file; the next Read then returns 0, io.EOF. A
+// read cut short by the end of the file returns the remaining bytes together
+// with io.EOF, as [io.ReaderAt] requires of [ReadAt], which behaves the same.
+func (f *MmapFile) Read(b []byte) (n int, err error) {
+	defer countRead(&f.stats, &n)
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.closed {
+		return 0, ErrClosed
+	}
+	if f.writeOnly {
+		return 0, ErrWriteOnly
+	}
+	if f.zeroFill {
+		n, err = f.readZeroFill(b, f.offset)
+		f.offset += int64(n)
+		return n, err
+	}
+	if f.offset >= int64(len(f.data)) {
+		return 0, io.EOF
+	}
+
+	n = copy(b, f.data[f.offset:])
+	f.offset += int64(n)
+
+	if n < len(b) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// ReadRune reads a single UTF-8 encoded Unicode character from the file,
+// advancing the file offset.
+//
+// It returns the rune and its size in bytes. If the encoding is invalid, it
+// consumes one byte and returns [utf8.RuneError] with a size of 1.
+// At end of file, ReadRune returns 0, 0, io.EOF.
+func (f *MmapFile) ReadRune() (r rune, size int, err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.closed {
+		return 0, 0, ErrClosed
+	}
+	if f.writeOnly {
+		return 0, 0, ErrWriteOnly
+	}
+	if f.offset >= int64(len(f.data)) {
+		return 0, 0, io.EOF
+	}
+
+	r, size = utf8.DecodeRune(f.data[f.offset:])
+	f.offset += int64(size)
+
+	return r, size, nil
+}
+
+// ReadStringN reads exactly n bytes at the current offset as a string and
+// advances the offset past them, e.g. the value of a length-prefixed field.
+//
+// The string aliases the mapping without copying, so it is only valid until
+// [Close] or a remap, and it must not be used with a writable mapping whose
+// contents may change, since Go strings are assumed to be immutable. Use
+// [ReadStringNCopy] when in doubt.
+//
+// If no bytes remain, ReadStringN returns io.EOF; if fewer than n remain, it
+// returns [io.ErrUnexpectedEOF]. In both cases, the offset is unchanged.
+func (f *MmapFile) ReadStringN(n int) (string, error) {
+	b, err := f.readN(n)
+	if err != nil || len(b) == 0 {
+		return "", err
+	}
+
+	return unsafe.String(&b[0], len(b)), nil
+}
+
+// ReadStringNCopy is like [ReadStringN], but returns a copy of the bytes,
+// which remains valid after the file is modified, remapped, or closed.
+func (f *MmapFile) ReadStringNCopy(n int) (string, error) {
+	b, err := f.readN(n)
+
+	return string(b), err
+}
+
+// readN returns the next n bytes of the mapping and advances the offset past
+// them, or returns an error if fewer than n bytes remain.
+func (f *MmapFile) readN(n int) ([]byte, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.closed {
+		return nil, ErrClosed
+	}
+	if f.writeOnly {
+		return nil, ErrWriteOnly
+	}
+	if n < 0 {
+		return nil, ErrNegativeCount
+	}
+	if n == 0 {
+		return nil, nil
+	}
+
+	rest := int64(len(f.data)) - f.offset
+	if rest <= 0 {
+		return nil, io.EOF
+	}
+	if int64(n) > rest {
+		return nil, io.ErrUnexpectedEOF
+	}
+
+	b := f.data[f.offset : f.offset+int64(n)]
+	f.offset += int64(n)
+
+	return b, nil
+}
+
+// Peek returns the next n bytes at the current offset without advancing it.
+//
+// The returned slice aliases the mapping, so it must not be modified and is
+// only valid until [Close] or a remap; copy it to retain it. If fewer than n
+// bytes remain, Peek returns them along with io.EOF.
+func (f *MmapFile) Peek(n int) ([]byte, error) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	if f.closed {
+		return nil, ErrClosed
+	}
+	if f.writeOnly {
+		return nil, ErrWriteOnly
+	}
+	if n < 0 {
+		return nil, ErrNegativeCount
+	}
+	if n == 0 {
+		return []byte{}, nil
+	}
+	if f.offset >= int64(len(f.data)) {
+		return nil, io.EOF
+	}
+
+	rest := f.data[f.offset:]
+	if n > len(rest) {
+		return rest[:len(rest):len(rest)], io.EOF
+	}
+
+	return rest[:n:n], nil
+}
+
+// ReadAt reads len(b) bytes from the file starting at byte offset off.
+//
+// It returns the number of bytes read and any error encountered.
+// If off cannot be represented as an int on this platform, ReadAt returns
+// [ErrOffsetTooLarge] rather than io.EOF.
+// ReadAt does not affect the file offset used by [Read]/[Write]/[Seek].
+// See [WithZeroFillReads] for reads past the end of the file.
+//
+// It is safe for concurrent use.
+func (f *MmapFile) ReadAt(b []byte, off int64) (n int, err error) {
+	defer countRead(&f.stats, &n)
+
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	if f.closed {
+		return 0, ErrClosed
+	}
+	if f.writeOnly {
+		return 0, ErrWriteOnly
+	}
+	if off < 0 {
+		return 0, ErrNegativeOffset
+	}
+	if off > maxInt {
+		return 0, ErrOffsetTooLarge
+	}
+	if f.zeroFill {
+		return f.readZeroFill(b, off)
+	}
+	if off >= int64(len(f.data)) {
+		return 0, io.EOF
+	}
+
+	n = copy(b, f.data[off:])
+	if n < len(b) {
+		return n, io.EOF
+	}
+
+	return n, nil
+}
+
+// SafeReadAt is like [ReadAt], but guards against the file having been
+// truncated underneath the mapping, e.g. by another process. Accessing a page
+// of a mapping past the end of the file raises SIGBUS, which crashes the
+// program, so SafeReadAt first checks the current size of the file on disk,
+// and refuses to read past it with [io.ErrUnexpectedEOF], returning the bytes
+// before it, if any.
+//
+// The check costs an fstat(2) per call. A truncation racing with the read can
+// still fault; SafeReadAt recovers from that fault as well, and returns 0,
+// [io.ErrUnexpectedEOF]. This is best-effort: only faults in SafeReadAt
+// itself are recovered, so other accesses to the mapping, e.g. through
+// [Bytes] or [ReadAt], still crash the program.
+func (f *MmapFile) SafeReadAt(b []byte, off int64) (n int, err error) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	if f.closed {
+		return 0, ErrClosed
+	}
+	if f.writeOnly {
+		return 0, ErrWriteOnly
+	}
+	if off < 0 {
+		return 0, ErrNegativeOffset
+	}
+	if off > maxInt {
+		return 0, ErrOffsetTooLarge
+	}
+	if off >= int64(len(f.data)) {
+		return 0, io.EOF
+	}
+
+	limit := int64(len(f.data))
+	if fh, ok := f.platform.(*fileHolder); ok && fh.file != nil {
+		fi, err := fh.file.Stat()
+		if err != nil {
+			return 0, err
+		}
+		if fi.Mode().IsRegular() {
+			limit = max(min(limit, fi.Size()-f.base), 0)
+		}
+	}
+	if off >= limit {
+		return 0, io.ErrUnexpectedEOF
+	}
+
+	n, err = copyNoFault(b, f.data[off:limit])
+	if err != nil {
+		return 0, err
+	}
+	if n < len(b) {
+		if limit < int64(len(f.data)) {
+			return n, io.ErrUnexpectedEOF
+		}
+		return n, io.EOF
+	}
+
+	return n, nil
+}
+
+// copyNoFault copies src to dst like copy, but returns [io.ErrUnexpectedEOF]
+// instead of crashing if src is mapped past the end of its file.
+func copyNoFault(dst, src []byte) (n int, err error) {
+	defer debug.SetPanicOnFault(debug.SetPanicOnFault(true))
+	defer func() {
+		if r := recover(); r != nil {
+			n, err = 0, io.ErrUnexpectedEOF
+		}
+	}()
+
+	return copy(dst, src), nil
+}
+
+// readZeroFill reads into b at off like [ReadAt], but treats the bytes between
+// the end of the file and the end of its last page as zeros.
+//
+// The caller must hold f.mu.
+func (f *MmapFile) readZeroFill(b []byte, off int64) (n int, err error) {
+	limit := f.pageEnd()
+	if off >= limit {
+		return 0, io.EOF
+	}
+
+	if off < int64(len(f.data)) {
+		n = copy(b, f.data[off:])
+	}
+
+	zeros := int(min(int64(len(b)-n), limit-off-int64(n)))
+	clear(b[n : n+zeros])
+	n += zeros
+
+	if n < len(b) {
+		return n, io.EOF
+	}
+
+	return n, nil
+}
+
+// pageEnd returns the offset of the end of the mapping, which extends to the
+// end of the page holding the last mapped byte. An empty file has no mapping.
+//
+// The caller must hold f.mu.
+func (f *MmapFile) pageEnd() int64 {
+	if cap(f.data) == 0 {
+		return 0
+	}
+
+	_, adjust := f.mapping()
+	pageSize := int64(PageSize())
+	end := int64(adjust) + int64(cap(f.data))
+
+	return (end+pageSize-1)&^(pageSize-1) - int64(adjust)
+}
+
+// ByteAt returns the byte at offset off, without the overhead of [ReadAt]
+// with a one-byte buffer.
+//
+// It returns io.EOF if off is at or past the end of the file.
+func (f *MmapFile) ByteAt(off int64) (byte, error) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	if f.closed {
+		return 0, ErrClosed
+	}
+	if f.writeOnly {
+		return 0, ErrWriteOnly
+	}
+	if off < 0 {
+		return 0, ErrNegativeOffset
+	}
+	if off >= int64(len(f.data)) {
+		return 0, io.EOF
+	}
+
+	return f.data[off], nil
+}
+
+// Write writes len(b) bytes to the file, advancing the file offset.
+//
+// It returns the number of bytes written and any error encountered.
+// Write returns an error if the file was opened read-only or if the
+// write would exceed the file's size. Writing an empty b always succeeds,
+// even at the end of the file or on an empty file.
+func (f *MmapFile) Write(b []byte) (n int, err error) {
+	return write(f, b)
+}
+
+// write implements [MmapFile.Write] and [MmapFile.WriteString], copying b
+// straight into the mapping without converting strings to a []byte first.
+func write[T []byte | string](f *MmapFile, b T) (n int, err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	defer countWrite(&f.stats, f.offset, &n)
+
+	if f.closed {
+		return 0, ErrClosed
+	}
+	if !f.writable {
+		return 0, ErrReadOnly
+	}
+
+	if len(b) == 0 {
+		// nothing to write, even into an empty mapping or at the end
+		return 0, nil
+	}
+	if err := f.growFor(f.offset, int64(len(b))); err != nil {
+		return 0, err
+	}
+
+	available := int64(len(f.data)) - f.offset
+	if available <= 0 {
+		return 0, ErrWriteOutOfBounds
+	}
+	f.dirty.Store(true)
+
+	start := f.offset
+	if int64(len(b)) > available {
+		n = copy(f.data[f.offset:], b[:available])
+		f.offset += int64(n)
+		if err := f.writeThrough(start, n); err != nil {
+			return n, err
+		}
+		return n, ErrWriteOutOfBounds
+	}
+
+	n = copy(f.data[f.offset:], b)
+	f.offset += int64(n)
+
+	return n, f.writeThrough(start, n)
+}
+
+// WriteAt writes len(b) bytes to the file starting at byte offset off.
+//
+// It returns the number of bytes written and any error encountered.
+// If off cannot be represented as an int on this platform, WriteAt returns
+// [ErrOffsetTooLarge] rather than [ErrWriteOutOfBounds].
+// WriteAt does not affect the file offset used by [Read]/[Write]/[Seek].
+//
+// It is safe for concurrent use, though overlapping writes MAY interleave
+// unless the file was opened with [WithExclusiveWriteAt].
+func (f *MmapFile) WriteAt(b []byte, off int64) (n int, err error) {
+	defer countWrite(&f.stats, off, &n)
+
+	if f.exclusive || f.growBy > 0 {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+	} else {
+		f.mu.RLock()
+		defer f.mu.RUnlock()
+	}
+
+	_, n, err = f.writeAt(b, off, false)
+
+	return n, err
+}
+
+// WriteAtIfChanged is like [WriteAt], but first compares b with the bytes at
+// off, and only writes them if they differ, e.g. for change data capture. It
+// reports whether the file was changed.
+//
+// Writing identical bytes leaves the file unmodified, so it neither dirties
+// the pages nor causes any write-back on [Sync]. n counts the bytes in range
+// either way, and the errors are the same as for WriteAt. Only calls that
+// change the file are counted in [Stats] and raise [HighWater].
+func (f *MmapFile) WriteAtIfChanged(b []byte, off int64) (changed bool, n int, err error) {
+	defer func() {
+		if changed {
+			countWrite(&f.stats, off, &n)
+		}
+	}()
+
+	if f.exclusive || f.growBy > 0 {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+	} else {
+		f.mu.RLock()
+		defer f.mu.RUnlock()
+	}
+
+	return f.writeAt(b, off, true)
+}
+
+// writeAt implements [WriteAt] and, if ifChanged is set, [WriteAtIfChanged].
+//
+// The caller must hold f.mu, for writing if f.exclusive or f.growBy is set.
+func (f *MmapFile) writeAt(b []byte, off int64, ifChanged bool) (changed bool, n int, err error) {
+	if f.closed {
+		return false, 0, ErrClosed
+	}
+	if !f.writable {
+		return false, 0, ErrReadOnly
+	}
+	if off < 0 {
+		return false, 0, ErrNegativeOffset
+	}
+	if off > maxInt {
+		return false, 0, ErrOffsetTooLarge
+	}
+	if err := f.growFor(off, int64(len(b))); err != nil {
+		return false, 0, err
+	}
+	if off >= int64(len(f.data)) {
+		return false, 0, ErrWriteOutOfBounds
+	}
+
+	if available := int64(len(f.data)) - off; int64(len(b)) > available {
+		b, err = b[:available], ErrWriteOutOfBounds
+	}
+	if ifChanged && bytes.Equal(f.data[off:off+int64(len(b))], b) {
+		return false, len(b), err
+	}
+	f.dirty.Store(true)
+
+	n = copy(f.data[off:], b)
+	if wtErr := f.writeThrough(off, n); wtErr != nil {
+		return true, n, wtErr
+	}
+
+	return true, n, err
+}
+
+// WriteAtHW is like [WriteAt], but additionally returns the high-water mark
+// after the write, as reported by [HighWater], so that append-style writers
+// need not track how far they have written themselves.
+func (f *MmapFile) WriteAtHW(b []byte, off int64) (n int, highWater int64, err error) {
+	n, err = f.WriteAt(b, off)
+
+	return n, f.HighWater(), err
+}
+
+// HighWater returns the high-water mark of the file: the end of the furthest
+// range written to by [Write], [WriteAt], and related methods, whichever
+// order they were called in. It starts at zero when the file is opened, and
+// is lowered to the new size when the file is truncated, e.g. to find the
+// meaningful length of an over-allocated mapping.
+//
+// Writes through the slice returned by [Bytes], a [View], or the atomic
+// accessors are not tracked.
+func (f *MmapFile) HighWater() int64 {
+	return f.stats.highWater.Load()
+}
+
+// Zero overwrites the whole file with zeros and then calls [Sync], e.g. to
+// wipe secrets from a scratch file.
+//
+// The clear goes through memory the Go compiler cannot prove unused, so it is
+// never optimized away. It returns [ErrReadOnly] if the file is read-only.
+func (f *MmapFile) Zero() error {
+	if err := f.zero(); err != nil {
+		return err
+	}
+
+	return f.Sync()
+}
+
+// zero clears the mapping.
+func (f *MmapFile) zero() error {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	if f.closed {
+		return ErrClosed
+	}
+	if !f.writable {
+		return ErrReadOnly
+	}
+	if len(f.data) == 0 {
+		return nil
+	}
+
+	f.dirty.Store(true)
+	clear(f.data)
+
+	return nil
+}
+
+// ReadAtContext is like [ReadAt], but stops waiting once ctx is done.
+//
+// Touching a page that is not resident can block indefinitely, e.g. when the
+// file lives on an unresponsive network filesystem. ReadAtContext performs the
+// copy in a separate goroutine and returns ctx.Err() if ctx is done first, so
+// the caller can give up and fail over.
+//
+// An in-kernel page fault cannot be aborted: after ReadAtContext returns
+// early, the background copy may still complete (or stay blocked) later. It
+// copies into an internal buffer, so b is never written after return.
+func (f *MmapFile) ReadAtContext(ctx context.Context, b []byte, off int64) (n int, err error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	type result struct {
+		n   int
+		err error
+	}
+
+	buf := make([]byte, len(b))
+	done := make(chan result, 1)
+	go func() {
+		n, err := f.ReadAt(buf, off)
+		done <- result{n, err}
+	}()
+
+	select {
+	case r := <-done:
+		copy(b, buf[:r.n])
+		return r.n, r.err
+	case <-ctx.Done():
+		return 0, ctx.Err()
+	}
+}
+
+// ReadAtv reads into each buffer in bufs in turn, starting at byte offset off
+// and continuing from where the previous buffer left off.
+//
+// It returns the total number of bytes read. If the end of the file is reached
+// before all buffers are filled, ReadAtv returns io.EOF. The lock is acquired
+// once for the whole vector, and the file offset used by
+// [Read]/[Write]/[Seek] is not affected.
+func (f *MmapFile) ReadAtv(bufs [][]byte, off int64) (n int, err error) {
+	defer countRead(&f.stats, &n)
+
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	if f.closed {
+		return 0, ErrClosed
+	}
+	if f.writeOnly {
+		return 0, ErrWriteOnly
+	}
+	if off < 0 {
+		return 0, ErrNegativeOffset
+	}
+	if off > maxInt {
+		return 0, ErrOffsetTooLarge
+	}
+
+	for _, b := range bufs {
+		if len(b) == 0 {
+			continue
+		}
+		if off >= int64(len(f.data)) {
+			return n, io.EOF
+		}
+
+		m := copy(b, f.data[off:])
+		n += m
+		off += int64(m)
+		if m < len(b) {
+			return n, io.EOF
+		}
+	}
+
+	return n, nil
+}
+
+// WriteAtv writes each buffer in bufs in turn, starting at byte offset off
+// and continuing from where the previous buffer left off.
+//
+// It returns the total number of bytes written. If the end of the file is
+// reached before all buffers are written, WriteAtv returns
+// [ErrWriteOutOfBounds]. The lock is acquired once for the whole vector, and
+// the file offset used by [Read]/[Write]/[Seek] is not affected.
+func (f *MmapFile) WriteAtv(bufs [][]byte, off int64) (n int, err error) {
+	defer countWrite(&f.stats, off, &n)
+
+	if f.exclusive || f.growBy > 0 {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+	} else {
+		f.mu.RLock()
+		defer f.mu.RUnlock()
+	}
+
+	if f.closed {
+		return 0, ErrClosed
+	}
+	if !f.writable {
+		return 0, ErrReadOnly
+	}
+	if off < 0 {
+		return 0, ErrNegativeOffset
+	}
+	if off > maxInt {
+		return 0, ErrOffsetTooLarge
+	}
+	if f.growBy > 0 {
+		var total int64
+		for _, b := range bufs {
+			total += int64(len(b))
+		}
+		if err := f.growFor(off, total); err != nil {
+			return 0, err
+		}
+	}
+	f.dirty.Store(true)
+
+	start := off
+	for _, b := range bufs {
+		if len(b) == 0 {
+			continue
+		}
+		if off >= int64(len(f.data)) {
+			err = ErrWriteOutOfBounds
+			break
+		}
+
+		m := copy(f.data[off:], b)
+		n += m
+		off += int64(m)
+		if m < len(b) {
+			err = ErrWriteOutOfBounds
+			break
+		}
+	}
+
+	if wtErr := f.writeThrough(start, n); wtErr != nil {
+		return n, wtErr
+	}
+
+	return n, err
+}
+
+// ReaderAt returns an [io.Reader] that reads the file starting at byte offset
+// base, advancing its own position with each read.
+//
+// Unlike [io.NewSectionReader], the reader is not bounded by a length; it
+// returns io.EOF at the end of the file. It does not affect the file offset
+// used by [Read]/[Write]/[Seek], and multiple readers progress independently.
+func (f *MmapFile) ReaderAt(base int64) io.Reader {
+	return io.NewSectionReader(f, base, math.MaxInt64)
+}
+
+// WriterAt returns an [io.Writer] that writes to the file starting at byte
+// offset base, advancing its own position with each write.
+//
+// The writer does not affect the file offset used by [Read]/[Write]/[Seek].
+// Writers over disjoint regions are safe for concurrent use. Once a writer
+// reaches the end of the file, it returns [ErrWriteOutOfBounds].
+func (f *MmapFile) WriterAt(base int64) io.Writer {
+	return io.NewOffsetWriter(f, base)
+}
+
+// SliceAt returns an [io.SectionReader] over the region [off, off+length) of
+// the file, e.g. to decode a structure stored in a fixed slot.
+//
+// It returns [ErrNegativeOffset] if off or length is negative, and
+// [ErrOutOfRange] if the region extends past the end of the file.
+func (f *MmapFile) SliceAt(off, length int64) (*io.SectionReader, error) {
+	if err := f.checkRange(off, length); err != nil {
+		return nil, err
+	}
+
+	return io.NewSectionReader(f, off, length), nil
+}
+
+// SectionWriter returns an [io.Writer] over the region [off, off+length) of
+// the file, e.g. to encode a structure into a fixed slot.
+//
+// Writes advance the writer's own position and never go past the end of the
+// region; once it is full, they return [ErrWriteOutOfBounds]. The errors for
+// an invalid region are the same as for [SliceAt].
+func (f *MmapFile) SectionWriter(off, length int64) (io.Writer, error) {
+	if err := f.checkRange(off, length); err != nil {
+		return nil, err
+	}
+
+	return &sectionWriter{f: f, off: off, limit: off + length}, nil
+}
+
+// checkRange validates that [off, off+length) lies within the file.
+func (f *MmapFile) checkRange(off, length int64) error {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	if f.closed {
+		return ErrClosed
+	}
+
+	return f.validRange(off, length)
+}
+
+// validRange is like checkRange, but the caller must hold f.mu and have
+// checked that the file is open.
+func (f *MmapFile) validRange(off, length int64) error {
+	if off < 0 || length < 0 {
+		return ErrNegativeOffset
+	}
+	if off > int64(len(f.data)) || length > int64(len(f.data))-off {
+		return ErrOutOfRange
+	}
+
+	return nil
+}
+
+// sectionWriter is the [io.Writer] returned by [MmapFile.SectionWriter].
+type sectionWriter struct {
+	f     *MmapFile
+	off   int64
+	limit int64
+}
+
+// Write implements [io.Writer].
+func (w *sectionWriter) Write(b []byte) (n int, err error) {
+	if w.off >= w.limit {
+		return 0, ErrWriteOutOfBounds
+	}
+
+	short := false
+	if remaining := w.limit - w.off; int64(len(b)) > remaining {
+		b = b[:remaining]
+		short = true
+	}
+
+	n, err = w.f.WriteAt(b, w.off)
+	w.off += int64(n)
+	if err == nil && short {
+		err = ErrWriteOutOfBounds
+	}
+
+	return n, err
+}
+
+// WriteString is like Write, but writes the contents of string s.
+//
+// The string is copied directly into the mapping without an intermediate
+// []byte allocation.
+func (f *MmapFile) WriteString(s string) (n int, err error) {
+	return write(f, s)
+}
+
+// Seek sets the offset for the next Read or Write on the file,
+// interpreted according to whence:
+//   - [io.SeekStart] (0): relative to the start of the file
+//   - [io.SeekCurrent] (1): relative to the current offset
+//   - [io.SeekEnd] (2): relative to the end of the file
+//
+// It returns the new offset and any error encountered. Seeking past the end
+// of the file is allowed, but a resulting offset that would overflow int64
+// returns [ErrOffsetTooLarge].
+func (f *MmapFile) Seek(offset int64, whence int) (int64, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.closed {
+		return 0, ErrClosed
+	}
+
+	var base int64
+	switch whence {
+	case io.SeekStart:
+		base = 0
+	case io.SeekCurrent:
+		base = f.offset
+	case io.SeekEnd:
+		base = int64(len(f.data))
+	default:
+		return 0, ErrInvalidWhence
+	}
+
+	if offset > 0 && base > math.MaxInt64-offset {
+		return 0, ErrOffsetTooLarge
+	}
+	newOffset := base + offset
+
+	if newOffset < 0 {
+		return 0, ErrNegativeOffset
+	}
+
+	f.offset = newOffset
+
+	return newOffset, nil
+}
+
+// ReadFrom reads data from r until EOF and writes it to the file.
+//
+// It returns the number of bytes read and any error encountered. If r has
+// more data than fits in the file, ReadFrom returns [ErrWriteOutOfBounds];
+// an r that is already exhausted succeeds, even on an empty file.
+//
+// On Linux, if r is an [os.File] and the mapping is shared, the data is
+// copied in the kernel into the underlying file with copy_file_range(2), or
+// sendfile(2) where that is unavailable, without passing through user space;
+// the mapping sees the copied data right away, as both share the page cache.
+// Otherwise r is read into the mapping directly, a window of at most 4 MiB at
+// a time (see [WithReadChunkSize]).
+func (f *MmapFile) ReadFrom(r io.Reader) (n int64, err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.closed {
+		return 0, ErrClosed
+	}
+	if !f.writable {
+		return 0, ErrReadOnly
+	}
+
+	return f.readFrom(r, nil)
+}
+
+// ReadFromN is like [ReadFrom], but reads at most limit bytes from r, or up to
+// the end of the file, whichever comes first, leaving the rest of r unread.
+// Unlike [ReadFrom], data that does not fit is not an error: ReadFromN stops
+// at the end of the file without returning [ErrWriteOutOfBounds].
+//
+// It returns the number of bytes read, by which the file offset is advanced,
+// and [ErrNegativeCount] if limit is negative.
+func (f *MmapFile) ReadFromN(r io.Reader, limit int64) (n int64, err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.closed {
+		return 0, ErrClosed
+	}
+	if !f.writable {
+		return 0, ErrReadOnly
+	}
+	if limit < 0 {
+		return 0, ErrNegativeCount
+	}
+
+	if remaining := int64(len(f.data)) - f.offset; limit > remaining {
+		limit = max(remaining, 0)
+	}
+
+	return f.readFrom(&io.LimitedReader{R: r, N: limit}, nil)
+}
+
+// TeeReadFrom is like [ReadFrom], but also writes the data stored in the file
+// to tee as it is read, e.g. to a [hash.Hash] to checksum the data in the same
+// pass. Data from r that does not fit is not written to tee.
+//
+// It returns the number of bytes stored in the file. If writing to tee fails,
+// TeeReadFrom stops and returns that error; the data that failed to be written
+// to tee is already stored. As the data must pass through user space, the
+// in-kernel copy of [ReadFrom] is never used.
+func (f *MmapFile) TeeReadFrom(r io.Reader, tee io.Writer) (n int64, err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.closed {
+		return 0, ErrClosed
+	}
+	if !f.writable {
+		return 0, ErrReadOnly
+	}
+
+	return f.readFrom(r, tee)
+}
+
+// ReadFromExact is like [ReadFrom], but once r is exhausted, it truncates the
+// file at the resulting file offset. Starting from offset zero, the file then
+// holds exactly the data read, without a stale tail, and [Len] reports its
+// new size.
+//
+// The file must be large enough for everything r produces; otherwise
+// ReadFromExact returns [ErrWriteOutOfBounds] and leaves the size unchanged.
+// Truncating remaps the file, which increments [Generation] and invalidates
+// slices previously returned by [Bytes]. ReadFromExact returns
+// [ErrUnsupported] for private mappings.
+func (f *MmapFile) ReadFromExact(r io.Reader) (n int64, err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	file, err := f.resizable()
+	if err != nil {
+		return 0, err
+	}
+
+	n, err = f.readFrom(r, nil)
+	if err != nil {
+		return n, err
+	}
+
+	return n, f.setSize(file, f.offset)
+}
+
+// Truncate changes the size of the file, remapping it at the new size. If the
+// file is extended, the new bytes read as zeros. Like [os.File.Truncate], it
+// does not change the file offset.
+//
+// A remap increments [Generation] and invalidates slices previously returned
+// by [Bytes]; concurrent calls to other methods are safe, as they wait for
+// the remap to complete. Truncate returns [ErrReadOnly] for read-only files
+// and [ErrUnsupported] for private mappings.
+func (f *MmapFile) Truncate(size int64) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	file, err := f.resizable()
+	if err != nil {
+		return err
+	}
+	if size < 0 {
+		return ErrNegativeOffset
+	}
+
+	return f.setSize(file, size)
+}
+
+// Grow extends the file by n bytes, remapping it as [Truncate] does.
+func (f *MmapFile) Grow(n int64) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	file, err := f.resizable()
+	if err != nil {
+		return err
+	}
+	if n < 0 {
+		return ErrNegativeCount
+	}
+	if n > maxInt-int64(len(f.data)) {
+		return ErrOffsetTooLarge
+	}
+
+	return f.setSize(file, int64(len(f.data))+n)
+}
+
+// resizable returns the underlying file if f can be resized.
+//
+// The caller must hold f.mu.
+func (f *MmapFile) resizable() (*os.File, error) {
+	if f.closed {
+		return nil, ErrClosed
+	}
+	if !f.writable {
+		return nil, ErrReadOnly
+	}
+
+	fh, ok := f.platform.(*fileHolder)
+	if f.private || !ok || fh.file == nil {
+		return nil, ErrUnsupported
+	}
+
+	return fh.file, nil
+}
+
+// setSize resizes the file and mapping to size, if it differs.
+//
+// The caller must hold f.mu for writing.
+func (f *MmapFile) setSize(file *os.File, size int64) error {
+	if size == int64(len(f.data)) && size == int64(cap(f.data)) {
+		return nil
+	}
+	if size > maxInt {
+		return ErrOffsetTooLarge
+	}
+
+	if err := f.resize(file, size); err != nil {
+		return err
+	}
+	f.gen++
+	f.stats.lowerHighWater(size)
+
+	return nil
+}
+
+// growFor extends a file opened with [WithGrowIncrement] so that n bytes can
+// be written at off. Within the capacity of the mapping, only the logical
+// length changes; otherwise the file is remapped with growBy bytes of
+// headroom. It is a no-op for other files, or if the write already fits.
+//
+// The caller must hold f.mu for writing.
+func (f *MmapFile) growFor(off, n int64) error {
+	if f.growBy <= 0 || n == 0 {
+		return nil
+	}
+	if n > maxInt-off {
+		return ErrOffsetTooLarge
+	}
+
+	end := off + n
+	if end <= int64(len(f.data)) {
+		return nil
+	}
+	if end <= int64(cap(f.data)) {
+		f.data = f.data[:end]
+		return nil
+	}
+
+	file, err := f.resizable()
+	if err != nil {
+		return err
+	}
+	if err := f.resize(file, end+min(f.growBy, maxInt-end)); err != nil {
+		return err
+	}
+	f.data = f.data[:end]
+	f.gen++
+
+	return nil
+}
+
+// Capacity returns the size of the mapping in bytes.
+//
+// It equals [Len], except for files opened with [WithGrowIncrement], where it
+// includes the headroom that writes can fill without remapping the file.
+func (f *MmapFile) Capacity() int64 {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	return int64(cap(f.data))
+}
+
+// SetLen sets the logical length of the file to n, which may be anywhere up to
+// [Capacity], without remapping or resizing the file, e.g. to track the
+// high-water mark of an over-allocated file. [Len], [Read], [ReadAt],
+// [WriteTo], [Bytes], and [Seek] relative to the end then operate on the
+// first n bytes, writes past them fail with [ErrWriteOutOfBounds] as usual,
+// and the rest of the mapping stays in place, so that a later SetLen can
+// extend the length again. Shrinking the length increments [Generation], as a
+// remap does, so that existing [View]s become stale.
+//
+// The file itself keeps its size, except that files opened with
+// [WithGrowIncrement] are truncated to Len on [Close]. SetLen returns
+// [ErrNegativeCount] if n is negative, and [ErrOutOfRange] if it exceeds
+// Capacity.
+func (f *MmapFile) SetLen(n int64) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.closed {
+		return ErrClosed
+	}
+	if n < 0 {
+		return ErrNegativeCount
+	}
+	if n > int64(cap(f.data)) {
+		return ErrOutOfRange
+	}
+
+	if n < int64(len(f.data)) {
+		// views and reported ranges must not reach past the new length
+		f.gen++
+	}
+	f.data = f.data[:n]
+	f.stats.lowerHighWater(n)
+
+	return nil
+}
+
+// trim truncates the file to its logical length, dropping the headroom left
+// by [WithGrowIncrement], once it is no longer mapped.
+//
+// The caller must hold f.mu for writing.
+func (f *MmapFile) trim(file *os.File, size int64) error {
+	if f.growBy <= 0 || !f.writable || f.private {
+		return nil
+	}
+
+	fi, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	if fi.Size() <= f.base+size {
+		return nil
+	}
+
+	return file.Truncate(f.base + size)
+}
+
+// readFrom implements [ReadFrom], writing the data stored in the file to tee
+// as well unless it is nil. The caller must hold f.mu and have checked that
+// the file is open and writable.
+func (f *MmapFile) readFrom(r io.Reader, tee io.Writer) (n int64, err error) {
+	defer countWrite(&f.stats, f.offset, &n)
+
+	if tee == nil {
+		if m, ok, err := f.copyFrom(r); ok {
+			n = m
+			if err != nil || f.offset < int64(len(f.data)) {
+				// r is exhausted before the end of the mapping, or failed
+				return n, err
+			}
+		}
+	}
+
+	chunk := f.opts.readChunk
+	if chunk <= 0 {
+		chunk = defaultReadChunk
+	}
+
+	for f.offset < int64(len(f.data)) {
+		end := f.offset + min(chunk, int64(len(f.data))-f.offset)
+		m, readErr := r.Read(f.data[f.offset:end])
+		if m > 0 {
+			f.dirty.Store(true)
+		}
+		n += int64(m)
+		f.offset += int64(m)
+		if err := f.writeThrough(f.offset-int64(m), m); err != nil {
+			return n, err
+		}
+		if tee != nil && m > 0 {
+			if _, err := tee.Write(f.data[f.offset-int64(m) : f.offset]); err != nil {
+				return n, err
+			}
+		}
+		if readErr == io.EOF {
+			return n, nil
+		}
+		if readErr != nil {
+			return n, readErr
+		}
+	}
+
+	// The mapping is full (or empty); probe r for more data. Only data that
+	// does not fit is an error, so an exhausted r still succeeds.
+	var buf [1]byte
+	for range maxEmptyReads {
+		m, readErr := r.Read(buf[:])
+		if m > 0 {
+			return n, ErrWriteOutOfBounds
+		}
+		if readErr == io.EOF {
+			return n, nil
+		}
+		if readErr != nil {
+			return n, readErr
+		}
+	}
+
+	return n, io.ErrNoProgress
+}
+
+// WriteTo writes the entire file contents to w.
+//
+// On Linux, if w is an [os.File], the contents are copied in the kernel with
+// sendfile(2) from the underlying file. Otherwise the mapping is written to w
+// in a single call.
+//
+// It returns the number of bytes written and any error encountered.
+func (f *MmapFile) WriteTo(w io.Writer) (n int64, err error) {
+	defer countRead(&f.stats, &n)
+
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	if f.closed {
+		return 0, ErrClosed
+	}
+	if f.writeOnly {
+		return 0, ErrWriteOnly
+	}
+
+	if n, ok, err := f.sendfile(w, 0, int64(len(f.data))); ok {
+		return n, err
+	}
+
+	written, err := w.Write(f.data)
+	return int64(written), err
+}
+
+// WriteRangeTo is like [WriteTo], but only writes the region [off, off+length)
+// of the file to w, e.g. to serve an HTTP range request. A region extending
+// past the end of the file is clamped to it, so an off at or past the end
+// writes nothing.
+//
+// It returns the number of bytes written and any error encountered; a failing
+// w stops the copy short. It returns [ErrNegativeOffset] if off is negative,
+// and [ErrNegativeCount] if length is. It does not affect the file offset used
+// by [Read]/[Write]/[Seek].
+func (f *MmapFile) WriteRangeTo(w io.Writer, off, length int64) (n int64, err error) {
+	defer countRead(&f.stats, &n)
+
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	if f.closed {
+		return 0, ErrClosed
+	}
+	if f.writeOnly {
+		return 0, ErrWriteOnly
+	}
+	if off < 0 {
+		return 0, ErrNegativeOffset
+	}
+	if length < 0 {
+		return 0, ErrNegativeCount
+	}
+
+	size := int64(len(f.data))
+	off = min(off, size)
+	length = min(length, size-off)
+
+	if n, ok, err := f.sendfile(w, off, length); ok {
+		return n, err
+	}
+
+	written, err := w.Write(f.data[off : off+length])
+	return int64(written), err
+}
+
+// Flush is equivalent to [Sync], for code written against interfaces that use
+// the "flush" naming.
+//
+// Flush is guaranteed to return nil on read-only and empty files, regardless
+// of platform. It returns [ErrClosed] if the file is closed, or if f is nil.
+func (f *MmapFile) Flush() error {
+	if f == nil {
+		return ErrClosed
+	}
+
+	f.mu.RLock()
+	closed := f.closed
+	noop := !f.writable || len(f.data) == 0
+	f.mu.RUnlock()
+
+	if closed {
+		return ErrClosed
+	}
+	if noop {
+		return nil
+	}
+
+	return f.Sync()
+}
+
+// Dump writes an xxd-style hex dump of the region [off, off+length) of the
+// file to w, e.g. for debugging a binary format. Each line shows the file
+// offset of its first byte, up to 16 bytes in hex, and their printable ASCII
+// characters, with '.' for the others.
+//
+// A negative length dumps to the end of the file, and a region extending past
+// it is clamped to it. The read lock is held while writing to w.
+func (f *MmapFile) Dump(w io.Writer, off, length int64) error {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	if f.closed {
+		return ErrClosed
+	}
+	if f.writeOnly {
+		return ErrWriteOnly
+	}
+	if off < 0 {
+		return ErrNegativeOffset
+	}
+
+	size := int64(len(f.data))
+	off = min(off, size)
+	if length < 0 || length > size-off {
+		length = size - off
+	}
+
+	const hexDigits = "0123456789abcdef"
+
+	bw := bufio.NewWriter(w)
+	var line []byte
+	for start := off; start < off+length; start += 16 {
+		chunk := f.data[start:min(start+16, off+length)]
+
+		line = fmt.Appendf(line[:0], "%08x: ", start)
+		for i := range 16 {
+			switch {
+			case i < len(chunk):
+				line = append(line, hexDigits[chunk[i]>>4], hexDigits[chunk[i]&0xf])
+			default:
+				line = append(line, ' ', ' ')
+			}
+			if i%2 == 1 {
+				line = append(line, ' ')
+			}
+		}
+		line = append(line, ' ')
+		for _, c := range chunk {
+			if c < 0x20 || c > 0x7e {
+				c = '.'
+			}
+			line = append(line, c)
+		}
+		line = append(line, '\n')
+
+		if _, err := bw.Write(line); err != nil {
+			return err
+		}
+	}
+
+	return bw.Flush()
+}
+
+// clockBase is the reference point of [clock].
+var clockBase = time.Now()
+
+// clock returns a monotonic timestamp in nanoseconds, unaffected by changes
+// to the wall clock.
+func clock() int64 {
+	return int64(time.Since(clockBase))
+}
+
+// SyncThrottled calls [Sync] only if at least minInterval has elapsed since
+// the last flush by SyncThrottled, and otherwise returns nil immediately. It
+// lets a writer sync after every record while flushing at most once per
+// interval, without managing timers.
+//
+// Writes made since the last flush are not durable until the next one, so a
+// crash can lose up to minInterval worth of writes. Concurrent callers within
+// the same interval flush only once. If the flush fails, the next call
+// retries regardless of the interval. [Sync] itself remains unconditional.
+func (f *MmapFile) SyncThrottled(minInterval time.Duration) error {
+	now := clock()
+	last := f.lastSync.Load()
+	if last != 0 && now-last < int64(minInterval) {
+		return nil
+	}
+	if !f.lastSync.CompareAndSwap(last, now) {
+		// another caller is flushing for this interval
+		return nil
+	}
+
+	if err := f.Sync(); err != nil {
+		f.lastSync.CompareAndSwap(now, last)
+		return err
+	}
+
+	return nil
+}
+
+// FindAll returns the offsets of successive non-overlapping occurrences of
+// pattern in the file, scanning the mapping in place in a single pass.
+//
+// If n >= 0, at most n offsets are returned; if n < 0, all of them are. An
+// empty pattern matches nothing. The file offset is not affected.
+func (f *MmapFile) FindAll(pattern []byte, n int) ([]int64, error) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	if f.closed {
+		return nil, ErrClosed
+	}
+	if f.writeOnly {
+		return nil, ErrWriteOnly
+	}
+	if len(pattern) == 0 || n == 0 {
+		return nil, nil
+	}
+
+	var offsets []int64
+	for off := 0; n < 0 || len(offsets) < n; {
+		i := bytes.Index(f.data[off:], pattern)
+		if i < 0 {
+			break
+		}
+
+		offsets = append(offsets, int64(off+i))
+		off += i + len(pattern)
+	}
+
+	return offsets, nil
+}
+
+// Hash writes the entire file contents to h, e.g. a [crypto/sha256] digest,
+// in a single pass under the lock, and returns the number of bytes hashed.
+//
+// The file offset is not affected.
+func (f *MmapFile) Hash(h hash.Hash) (int64, error) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	if f.closed {
+		return 0, ErrClosed
+	}
+	if f.writeOnly {
+		return 0, ErrWriteOnly
+	}
+
+	n, err := h.Write(f.data)
+
+	return int64(n), err
+}
+
+// SnapshotTo writes a point-in-time copy of the file contents to path.
+//
+// The contents are written to a temporary file in the same directory as path,
+// synced, and then renamed into place, so path either keeps its previous
+// contents or holds the complete snapshot. The read lock is held throughout,
+// so no writes through this [MmapFile] can interleave with the copy.
+func (f *MmapFile) SnapshotTo(path string, perm os.FileMode) (err error) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	if f.closed {
+		return ErrClosed
+	}
+	if f.writeOnly {
+		return ErrWriteOnly
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			_ = tmp.Close()
+			_ = os.Remove(tmp.Name())
+		}
+	}()
+
+	if _, err = tmp.Write(f.data); err != nil {
+		return err
+	}
+	if err = tmp.Chmod(perm); err != nil {
+		return err
+	}
+	if err = tmp.Sync(); err != nil {
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
+
+// Snapshot returns a reader over a point-in-time copy of the file contents,
+// so that a consumer can read a consistent snapshot while writers continue.
+//
+// Unlike [Bytes], which aliases the mapping, the snapshot is isolated from
+// later writes, and remains valid after [Close] or a remap. This costs a copy
+// of the whole file. The write lock is held during the copy, so it sees either
+// all or none of each write made through this [MmapFile]; writes through the
+// slice returned by [Bytes], or by other processes, may still be torn.
+func (f *MmapFile) Snapshot() (io.ReadSeeker, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.closed {
+		return nil, ErrClosed
+	}
+	if f.writeOnly {
+		return nil, ErrWriteOnly
+	}
+
+	return bytes.NewReader(bytes.Clone(f.data)), nil
+}
+
+// CloseNoSync is like [Close], but guarantees that no changes are written
+// back to the file as part of closing it, e.g. to avoid the I/O when relying
+// on the kernel's lazy writeback, or when the changes are not worth keeping.
+//
+// On Unix and Windows, this is the same as [Close], which only unmaps the file
+// and leaves writing back the modified pages to the kernel. On platforms
+// without native mmap support, where [Close] writes the in-memory copy back,
+// CloseNoSync discards the changes that have not been written back by [Sync]
+// or [WithWriteThrough].
+func (f *MmapFile) CloseNoSync() error {
+	return f.close(false)
+}
+
+// closeCheck runs the verify function of [WithCloseChecksum], if any, over its
+// region of the mapping.
+//
+// The caller must hold f.mu.
+func (f *MmapFile) closeCheck() error {
+	if f.opts.closeCheck == nil {
+		return nil
+	}
+
+	size := int64(len(f.data))
+	off := min(f.opts.closeCheckOff, size)
+	end := off + min(f.opts.closeCheckLen, size-off)
+
+	return f.opts.closeCheck(f.data[off:end])
+}
+
+// Remove closes the file and then removes the named file from the file
+// system, e.g. to clean up a scratch file.
+//
+// The file is unmapped and closed first, as some platforms refuse to remove a
+// file that is open or mapped. The name is removed even if [Close] fails, and
+// the first error encountered is returned. If the file has already been
+// removed, e.g. one created by [OpenTemp], the error satisfies
+// errors.Is(err, fs.ErrNotExist).
+func (f *MmapFile) Remove() error {
+	err := f.Close()
+	if f.memory {
+		return err
+	}
+	if rmErr := os.Remove(f.name); rmErr != nil && err == nil {
+		err = rmErr
+	}
+
+	return err
+}
+
+// Reopen opens and maps the named file again after [Close], with the same
+// access mode and [Option]s it was originally opened with, e.g. for a cached
+// handle that is closed while idle. The file offset is reset to zero, and
+// [Generation] is incremented.
+//
+// The whole file is mapped at its current size, which may differ from the
+// size it had when it was closed. Reopen returns [ErrNotClosed] if the file is
+// open, and [ErrUnsupported] for files opened with [OpenFileAt] or created by
+// [NewMemory]. Files opened with [NewFromFile] are reopened by their name,
+// which may no longer refer to the same file, or to any file, as for those
+// created by [OpenTemp].
+func (f *MmapFile) Reopen() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if !f.closed {
+		return ErrNotClosed
+	}
+	if f.region || f.memory {
+		return ErrUnsupported
+	}
+
+	flag := os.O_RDONLY
+	switch {
+	case f.writeOnly:
+		flag = os.O_WRONLY
+	case f.writable:
+		flag = os.O_RDWR
+	}
+
+	o := f.opts
+	nf, err := OpenFileWith(f.name, flag, 0, 0, func(opts *options) { *opts = o })
+	if err != nil {
+		return err
+	}
+	runtime.SetFinalizer(nf, nil)
+
+	f.data = nf.data
+	f.info = nf.info
+	f.platform = nf.platform
+	f.offset = 0
+	f.gen++
+	f.dirty.Store(false)
+	f.closed = false
+
+	if nativeMapping {
+		runtime.SetFinalizer(f, (*MmapFile).Close)
+	}
+
+	return nil
+}
+
+// Prefetch hints the kernel that the region [off, off+length) will be
+// accessed soon, so it can start reading the pages in ahead of time.
+//
+// The range is expanded down to a page boundary and clamped to the end of the
+// file. On platforms without native mmap support, this is a no-op.
+func (f *MmapFile) Prefetch(off, length int64) error {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	if f.closed {
+		return ErrClosed
+	}
+
+	region, err := f.pageRange(off, length)
+	if err != nil {
+		return err
+	}
+	if len(region) == 0 || f.memory {
+		return nil
+	}
+
+	return prefetch(region)
+}
+
+// FlushAndEvict writes the modified pages in the region [off, off+length) of
+// the file back to it, waiting until they are durable, and then drops them
+// from the mapping, e.g. to keep a streaming write workload from filling up
+// memory with pages it will not touch again.
+//
+// On Unix this issues msync(2) with MS_SYNC followed by madvise(2) with
+// MADV_DONTNEED, so the pages are re-read from the file if accessed again.
+// This unmaps them from the process, but leaves them in the page cache; follow
+// it with [MmapFile.Fadvise] and [FadvDontNeed] to drop them from there too.
+// Pages of a writable private mapping are not dropped, as that would discard
+// changes. On Windows, the pages are flushed but not dropped. On platforms
+// without native mmap support, the region is written back if the file was
+// modified, and nothing is dropped.
+//
+// The range is expanded down to a page boundary and clamped to the end of the
+// file.
+func (f *MmapFile) FlushAndEvict(off, length int64) error {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	if f.closed {
+		return ErrClosed
+	}
+
+	region, err := f.pageRange(off, length)
+	if err != nil {
+		return err
+	}
+	if len(region) == 0 || f.memory {
+		return nil
+	}
+
+	return f.flushAndEvict(region)
+}
+
+// EnableTHP hints the kernel to back the mapping with transparent huge pages,
+// which can reduce TLB misses for large working sets, without reserving
+// hugetlbfs pages up front.
+//
+// On Linux this issues madvise(2) with MADV_HUGEPAGE over the mapping. It is
+// only a hint: whether huge pages are used depends on the kernel settings in
+// /sys/kernel/mm/transparent_hugepage, and on the file system for shared file
+// mappings. Kernels built without THP support fail with EINVAL. On other
+// platforms, EnableTHP is a no-op that returns nil.
+func (f *MmapFile) EnableTHP() error {
+	return f.hugepage(true)
+}
+
+// EnableNoTHP is like [EnableTHP], but hints the kernel not to use transparent
+// huge pages for the mapping, with MADV_NOHUGEPAGE, e.g. for a sparse access
+// pattern where they would waste memory.
+func (f *MmapFile) EnableNoTHP() error {
+	return f.hugepage(false)
+}
+
+// hugepage implements [EnableTHP] and [EnableNoTHP].
+func (f *MmapFile) hugepage(enable bool) error {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	if f.closed {
+		return ErrClosed
+	}
+	if cap(f.data) == 0 || f.memory {
+		return nil
+	}
+
+	m, _ := f.mapping()
+
+	return hugepage(m, enable)
+}
+
+// mapping returns the whole mapping backing f.data and the index of data[0]
+// within it. The mapping starts before data[0] when the file was opened at an
+// offset that is not aligned to [mapAlign].
+//
+// The caller must hold f.mu.
+func (f *MmapFile) mapping() ([]byte, int) {
+	if cap(f.data) == 0 {
+		return nil, 0
+	}
+
+	adjust := int(f.base % mapAlign())
+	start := unsafe.Add(unsafe.Pointer(unsafe.SliceData(f.data)), -adjust)
+
+	return unsafe.Slice((*byte)(start), adjust+cap(f.data)), adjust
+}
+
+// Resident reports, for each page of the mapping, whether it is currently
+// resident in memory.
+//
+// The result is a snapshot; pages may be evicted or faulted in at any time.
+// Resident returns [ErrUnsupported] on platforms without mincore(2).
+func (f *MmapFile) Resident() ([]bool, error) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	if f.closed {
+		return nil, ErrClosed
+	}
+	if len(f.data) == 0 {
+		return nil, nil
+	}
+	if f.memory {
+		return nil, ErrUnsupported
+	}
+
+	m, _ := f.mapping()
+
+	return resident(m)
+}
+
+// Advice values for [MmapFile.Fadvise], as defined by posix_fadvise(2).
+const (
+	FadvNormal     = 0 // no special treatment
+	FadvRandom     = 1 // expect random access
+	FadvSequential = 2 // expect sequential access
+	FadvWillNeed   = 3 // read the data into the page cache ahead of time
+	FadvDontNeed   = 4 // drop the data from the page cache
+	FadvNoReuse    = 5 // the data will be accessed only once
+)
+
+// Fadvise advises the kernel about the expected use of the region
+// [off, off+length) of the underlying file, as opposed to the mapping like
+// [WithSequential] and [WithRandom]. A length of zero extends to the end of
+// the file. For example, [FadvDontNeed] after a one-shot scan drops the file
+// from the page cache.
+//
+// Fadvise calls posix_fadvise(2) on the file descriptor, which stays open
+// while the file is mapped. It is supported on 64-bit Linux, except s390x;
+// elsewhere it returns [ErrUnsupported].
+func (f *MmapFile) Fadvise(off, length int64, advice int) error {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	if f.closed {
+		return ErrClosed
+	}
+	if off < 0 || length < 0 {
+		return ErrNegativeOffset
+	}
+
+	fh, ok := f.platform.(*fileHolder)
+	if !ok || fh.file == nil {
+		return ErrUnsupported
+	}
+
+	return fadvise(fh.file, f.base+off, length, advice)
+}
+
+// LockRange acquires an advisory lock over the byte range [off, off+length)
+// of the file, blocking until the lock is available. A length of zero locks
+// from off to the end of the file, including bytes past it.
+//
+// If exclusive is true, a write lock is taken, which requires a writable file
+// on Unix; otherwise a shared read lock is taken. The lock is for coordinating
+// with other processes (or other [MmapFile]s of the same file) and is separate
+// from the internal mutex. Being advisory, it does not stop anyone from
+// accessing the mapping.
+//
+// On Linux this uses open file description locks (F_OFD_SETLKW), on other
+// Unix systems fcntl(2) with F_SETLKW, and on Windows LockFileEx. Locks are
+// held on the underlying file descriptor and are released by [UnlockRange] or
+// when the file is closed. The fallback backend returns [ErrUnsupported].
+func (f *MmapFile) LockRange(off, length int64, exclusive bool) error {
+	file, base, err := f.lockFile(off, length)
+	if err != nil {
+		return err
+	}
+
+	return lockRange(file, base+off, length, exclusive)
+}
+
+// UnlockRange releases a lock acquired by [LockRange] over the same range.
+func (f *MmapFile) UnlockRange(off, length int64) error {
+	file, base, err := f.lockFile(off, length)
+	if err != nil {
+		return err
+	}
+
+	return unlockRange(file, base+off, length)
+}
+
+// lockFile validates a lock range and returns the underlying file, along with
+// the file offset that offsets into f are relative to.
+//
+// The lock on f.mu is not held while waiting for a range lock; the file
+// itself guards against being closed concurrently.
+func (f *MmapFile) lockFile(off, length int64) (*os.File, int64, error) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	if f.closed {
+		return nil, 0, ErrClosed
+	}
+	if off < 0 || length < 0 {
+		return nil, 0, ErrNegativeOffset
+	}
+
+	fh, ok := f.platform.(*fileHolder)
+	if !ok || fh.file == nil {
+		return nil, 0, ErrUnsupported
+	}
+
+	return fh.file, f.base, nil
+}
+
+// pageRange returns the subslice of the mapping covering [off, off+length),
+// with the start rounded down to a page boundary and the end clamped to the
+// mapping size.
+//
+// The caller must hold f.mu.
+func (f *MmapFile) pageRange(off, length int64) ([]byte, error) {
+	if off < 0 || length < 0 {
+		return nil, ErrNegativeOffset
+	}
+
+	size := int64(len(f.data))
+	if off >= size || length == 0 {
+		return nil, nil
+	}
+
+	end := size
+	if length < size-off {
+		end = off + length
+	}
+
+	// align relative to the mapping, which starts on a page boundary
+	m, adjust := f.mapping()
+	pageSize := int64(PageSize())
+	start := (off + int64(adjust)) &^ (pageSize - 1)
+
+	return m[start : end+int64(adjust)], nil
+}
+
+// Scan tokenizes the whole file with split and calls yield for each token,
+// stopping early if yield returns false.
+//
+// Unlike [bufio.Scanner], the split function runs directly against the mapped
+// bytes, so tokens are sub-slices of the mapping rather than copies. They are
+// only valid until [Close] is called, and must not be modified on a read-only
+// file. Scan does not affect the file offset used by [Read]/[Write]/[Seek].
+//
+// The read lock is held while yield runs, so yield must not call methods that
+// modify the file (e.g. [Write] or [Close]).
+//
+// Scan returns the first non-[bufio.ErrFinalToken] error reported by split.
+func (f *MmapFile) Scan(split bufio.SplitFunc, yield func(token []byte) bool) error {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	if f.closed {
+		return ErrClosed
+	}
+	if f.writeOnly {
+		return ErrWriteOnly
+	}
+
+	data := f.data
+	empties := 0
+	for {
+		advance, token, err := split(data, true)
+		if err != nil {
+			if err == bufio.ErrFinalToken {
+				if token != nil {
+					yield(token)
+				}
+				return nil
+			}
+			return err
+		}
+		if advance < 0 {
+			return bufio.ErrNegativeAdvance
+		}
+		if advance > len(data) {
+			return bufio.ErrAdvanceTooFar
+		}
+		data = data[advance:]
+
+		if token == nil {
+			if advance == 0 {
+				return nil
+			}
+			continue
+		}
+		if !yield(token) {
+			return nil
+		}
+
+		if advance > 0 {
+			empties = 0
+		} else if empties++; empties > 100 {
+			return io.ErrNoProgress
+		}
+	}
+}
+
+// Records splits the file into consecutive records of recordSize bytes, e.g.
+// the entries of a packed index file, and calls yield with the index and
+// contents of each, stopping early if yield returns false.
+//
+// As with [Scan], records are sub-slices of the mapping rather than copies,
+// they are only valid until [Close] is called, and the read lock is held while
+// yield runs. Records returns [ErrPartialRecord] without calling yield if the
+// file size is not a multiple of recordSize.
+func (f *MmapFile) Records(recordSize int, yield func(index int, rec []byte) bool) error {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	if f.closed {
+		return ErrClosed
+	}
+	if f.writeOnly {
+		return ErrWriteOnly
+	}
+	if recordSize <= 0 {
+		return fmt.Errorf("mmapfile: invalid record size %d", recordSize)
+	}
+	if len(f.data)%recordSize != 0 {
+		return ErrPartialRecord
+	}
+
+	for i, off := 0, 0; off < len(f.data); i, off = i+1, off+recordSize {
+		if !yield(i, f.data[off:off+recordSize:off+recordSize]) {
+			return nil
+		}
+	}
+
+	return nil
 }
 
 // Stat returns the FileInfo structure describing the file.
@@ -303,15 +2730,90 @@ func (f *MmapFile) Stat() (os.FileInfo, error) {
 	f.mu.RLock()
 	closed := f.closed
 	name := f.name
+	memory, size := f.memory, int64(len(f.data))
 	f.mu.RUnlock()
 
 	if closed {
 		return nil, ErrClosed
 	}
+	if memory {
+		return memoryFileInfo{size}, nil
+	}
 
 	if fh, ok := f.platform.(*fileHolder); ok && fh.file != nil {
-		return fh.file.Stat()
+		fi, err := fh.file.Stat()
+		if err != nil {
+			return nil, err
+		}
+		if base := filepath.Base(name); fi.Name() != base {
+			// the file was renamed after it was opened
+			return renamedFileInfo{fi, base}, nil
+		}
+
+		return fi, nil
 	}
 
 	return os.Stat(name)
 }
+
+// renamedFileInfo is an [os.FileInfo] reporting the name of a file that was
+// renamed with [MmapFile.Rename].
+type renamedFileInfo struct {
+	os.FileInfo
+	name string
+}
+
+// Name implements [os.FileInfo].
+func (fi renamedFileInfo) Name() string {
+	return fi.name
+}
+
+// Mode returns the file mode bits of the underlying file.
+func (f *MmapFile) Mode() (os.FileMode, error) {
+	fi, err := f.Stat()
+	if err != nil {
+		return 0, err
+	}
+
+	return fi.Mode(), nil
+}
+
+// Chmod changes the mode of the underlying file to mode.
+func (f *MmapFile) Chmod(mode os.FileMode) error {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	if f.closed {
+		return ErrClosed
+	}
+	if f.memory {
+		return ErrUnsupported
+	}
+
+	if fh, ok := f.platform.(*fileHolder); ok && fh.file != nil {
+		return fh.file.Chmod(mode)
+	}
+
+	return os.Chmod(f.name, mode)
+}
+
+// Chtimes changes the access and modification times of the underlying file,
+// like [os.Chtimes] on its current name; a zero [time.Time] leaves the
+// corresponding time unchanged.
+//
+// The kernel updates the modification time of a file as its mapped pages
+// are written to, so set it after the last write, and after [Sync] for a
+// shared mapping.
+func (f *MmapFile) Chtimes(atime, mtime time.Time) error {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	if f.closed {
+		return ErrClosed
+	}
+	if f.memory {
+		return ErrUnsupported
+	}
+
+	return os.Chtimes(f.name, atime, mtime)
+}
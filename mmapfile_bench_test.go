@@ -208,6 +208,39 @@ func BenchmarkReadAt(b *testing.B) {
 	}
 }
 
+func BenchmarkByteAt(b *testing.B) {
+	f, err := Open("testdata/binary.dat")
+	if err != nil {
+		b.Fatalf("Open failed: %v", err)
+	}
+	defer f.Close()
+
+	size := int64(f.Len())
+
+	b.Run("ByteAt", func(b *testing.B) {
+		var sum byte
+		for b.Loop() {
+			for off := int64(0); off < size; off++ {
+				c, _ := f.ByteAt(off)
+				sum += c
+			}
+		}
+		_ = sum
+	})
+
+	b.Run("ReadAt", func(b *testing.B) {
+		var buf [1]byte
+		var sum byte
+		for b.Loop() {
+			for off := int64(0); off < size; off++ {
+				f.ReadAt(buf[:], off)
+				sum += buf[0]
+			}
+		}
+		_ = sum
+	})
+}
+
 func BenchmarkReadAtParallel(b *testing.B) {
 	for _, size := range sizes {
 		sizeStr := byteSize(size).Human()
@@ -321,6 +354,57 @@ func BenchmarkWrite(b *testing.B) {
 	}
 }
 
+func BenchmarkWriteString(b *testing.B) {
+	for _, size := range sizes {
+		sizeStr := byteSize(size).Human()
+		sizeInt := int64(size)
+		b.Run(sizeStr, func(b *testing.B) {
+			buf := make([]byte, sizeInt)
+			for i := range buf {
+				buf[i] = byte(i % 256)
+			}
+			data := string(buf)
+
+			b.Run("mmap", func(b *testing.B) {
+				path := filepath.Join(b.TempDir(), fmt.Sprintf("bench_mmap_%s.txt", sizeStr))
+				f, err := OpenFile(path, os.O_RDWR|os.O_CREATE, 0644, sizeInt)
+				if err != nil {
+					b.Fatalf("OpenFile failed: %v", err)
+				}
+				defer f.Close()
+
+				b.ReportAllocs()
+				b.ResetTimer()
+
+				for b.Loop() {
+					f.Seek(0, io.SeekStart)
+					f.WriteString(data)
+				}
+			})
+
+			b.Run("os", func(b *testing.B) {
+				path := filepath.Join(b.TempDir(), fmt.Sprintf("bench_os_%s.txt", sizeStr))
+				f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+				if err != nil {
+					b.Fatalf("OpenFile failed: %v", err)
+				}
+				defer f.Close()
+
+				// Pre-allocate to match mmap behavior
+				f.Truncate(sizeInt)
+
+				b.ReportAllocs()
+				b.ResetTimer()
+
+				for b.Loop() {
+					f.Seek(0, io.SeekStart)
+					f.WriteString(data)
+				}
+			})
+		})
+	}
+}
+
 func BenchmarkWriteAt(b *testing.B) {
 	for _, size := range sizes {
 		sizeStr := byteSize(size).Human()
@@ -460,6 +544,58 @@ func BenchmarkReadFrom(b *testing.B) {
 	}
 }
 
+func BenchmarkReadFromFile(b *testing.B) {
+	for _, size := range sizes {
+		sizeStr := byteSize(size).Human()
+		sizeInt := int64(size)
+		b.Run(sizeStr, func(b *testing.B) {
+			tempDir := b.TempDir()
+			srcPath := filepath.Join(tempDir, fmt.Sprintf("readfrom_src_%s.dat", sizeStr))
+
+			data := make([]byte, sizeInt)
+			for i := range data {
+				data[i] = byte(i % 256)
+			}
+			if err := os.WriteFile(srcPath, data, 0644); err != nil {
+				b.Fatalf("WriteFile failed: %v", err)
+			}
+			data = nil
+
+			src, err := os.Open(srcPath)
+			if err != nil {
+				b.Fatalf("Open failed: %v", err)
+			}
+			defer src.Close()
+
+			f, err := OpenFile(filepath.Join(tempDir, fmt.Sprintf("readfrom_dst_%s.dat", sizeStr)), os.O_RDWR|os.O_CREATE, 0644, sizeInt)
+			if err != nil {
+				b.Fatalf("OpenFile failed: %v", err)
+			}
+			defer f.Close()
+
+			b.Run("file", func(b *testing.B) {
+				b.SetBytes(sizeInt)
+				for b.Loop() {
+					src.Seek(0, io.SeekStart)
+					f.Seek(0, io.SeekStart)
+					f.ReadFrom(src)
+				}
+			})
+
+			b.Run("reader", func(b *testing.B) {
+				// hide the *os.File, so the copy goes through the mapping
+				r := struct{ io.Reader }{src}
+				b.SetBytes(sizeInt)
+				for b.Loop() {
+					src.Seek(0, io.SeekStart)
+					f.Seek(0, io.SeekStart)
+					f.ReadFrom(r)
+				}
+			})
+		})
+	}
+}
+
 func BenchmarkWriteTo(b *testing.B) {
 	b.Run("mmap", func(b *testing.B) {
 		f, err := Open("testdata/binary.dat")
@@ -489,6 +625,151 @@ func BenchmarkWriteTo(b *testing.B) {
 	})
 }
 
+func BenchmarkCopyFile(b *testing.B) {
+	for _, size := range sizes {
+		sizeStr := byteSize(size).Human()
+		sizeInt := int64(size)
+		b.Run(sizeStr, func(b *testing.B) {
+			tempDir := b.TempDir()
+			src := filepath.Join(tempDir, fmt.Sprintf("bench_copy_src_%s.dat", sizeStr))
+
+			data := make([]byte, sizeInt)
+			for i := range data {
+				data[i] = byte(i % 256)
+			}
+			if err := os.WriteFile(src, data, 0644); err != nil {
+				b.Fatalf("WriteFile failed: %v", err)
+			}
+
+			b.Run("mmap", func(b *testing.B) {
+				dst := filepath.Join(tempDir, fmt.Sprintf("bench_copy_mmap_%s.dat", sizeStr))
+
+				b.SetBytes(sizeInt)
+				b.ResetTimer()
+
+				for b.Loop() {
+					if _, err := CopyFile(dst, src, 0644); err != nil {
+						b.Fatalf("CopyFile failed: %v", err)
+					}
+				}
+			})
+
+			b.Run("os", func(b *testing.B) {
+				dst := filepath.Join(tempDir, fmt.Sprintf("bench_copy_os_%s.dat", sizeStr))
+
+				b.SetBytes(sizeInt)
+				b.ResetTimer()
+
+				for b.Loop() {
+					sf, err := os.Open(src)
+					if err != nil {
+						b.Fatalf("Open failed: %v", err)
+					}
+					df, err := os.OpenFile(dst, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+					if err != nil {
+						b.Fatalf("OpenFile failed: %v", err)
+					}
+
+					if _, err := io.Copy(df, sf); err != nil {
+						b.Fatalf("io.Copy failed: %v", err)
+					}
+					df.Sync()
+
+					df.Close()
+					sf.Close()
+				}
+			})
+		})
+	}
+}
+
+func BenchmarkWriteToFile(b *testing.B) {
+	for _, size := range sizes {
+		sizeStr := byteSize(size).Human()
+		sizeInt := int64(size)
+		b.Run(sizeStr, func(b *testing.B) {
+			tempDir := b.TempDir()
+			src := filepath.Join(tempDir, fmt.Sprintf("bench_writeto_%s.dat", sizeStr))
+
+			data := make([]byte, sizeInt)
+			for i := range data {
+				data[i] = byte(i % 256)
+			}
+			if err := os.WriteFile(src, data, 0644); err != nil {
+				b.Fatalf("WriteFile failed: %v", err)
+			}
+
+			f, err := Open(src)
+			if err != nil {
+				b.Fatalf("Open failed: %v", err)
+			}
+			defer f.Close()
+
+			dst, err := os.Create(filepath.Join(tempDir, fmt.Sprintf("bench_writeto_dst_%s.dat", sizeStr)))
+			if err != nil {
+				b.Fatalf("Create failed: %v", err)
+			}
+			defer dst.Close()
+
+			b.Run("sendfile", func(b *testing.B) {
+				b.SetBytes(sizeInt)
+				b.ResetTimer()
+
+				for b.Loop() {
+					dst.Seek(0, io.SeekStart)
+					f.WriteTo(dst)
+				}
+			})
+
+			b.Run("write", func(b *testing.B) {
+				// hide the *os.File so that WriteTo cannot use sendfile
+				w := struct{ io.Writer }{dst}
+
+				b.SetBytes(sizeInt)
+				b.ResetTimer()
+
+				for b.Loop() {
+					dst.Seek(0, io.SeekStart)
+					f.WriteTo(w)
+				}
+			})
+		})
+	}
+}
+
+func BenchmarkAppendGrow(b *testing.B) {
+	record := make([]byte, 128)
+	const records = 4096
+
+	for _, increment := range []int64{1, 64 << 10, 1 << 20} {
+		b.Run(byteSize(increment).Human(), func(b *testing.B) {
+			path := filepath.Join(b.TempDir(), "bench_append.dat")
+
+			b.SetBytes(records * int64(len(record)))
+			b.ResetTimer()
+
+			var remaps uint64
+			for b.Loop() {
+				os.Remove(path)
+				f, err := OpenFileWith(path, os.O_RDWR|os.O_CREATE, 0644, 0,
+					WithGrowIncrement(increment))
+				if err != nil {
+					b.Fatalf("OpenFileWith failed: %v", err)
+				}
+				for range records {
+					if _, err := f.Write(record); err != nil {
+						b.Fatalf("Write failed: %v", err)
+					}
+				}
+				remaps += f.Generation()
+				f.Close()
+			}
+
+			b.ReportMetric(float64(remaps)/float64(b.N), "remaps/op")
+		})
+	}
+}
+
 func BenchmarkStat(b *testing.B) {
 	b.Run("mmap", func(b *testing.B) {
 		f, err := Open("testdata/binary.dat")
@@ -0,0 +1,26 @@
+//go:build linux
+
+package mmapfile
+
+import "syscall"
+
+const (
+	// mapPopulate is the mmap flag used to pre-fault the mapping.
+	mapPopulate = syscall.MAP_POPULATE
+
+	// mapNoReserve is the mmap flag used to skip reserving swap space.
+	mapNoReserve = syscall.MAP_NORESERVE
+
+	// mapSharedValidate is MAP_SHARED_VALIDATE, which the syscall package
+	// does not define.
+	mapSharedValidate = 0x03
+
+	// sysMsync is the msync(2) syscall number.
+	sysMsync = syscall.SYS_MSYNC
+
+	// fcntlSetLockWait is F_OFD_SETLKW, which the syscall package does not
+	// define. Unlike F_SETLKW, open file description locks belong to the
+	// file descriptor rather than the process, so they are not dropped when
+	// another descriptor of the same file is closed.
+	fcntlSetLockWait = 38
+)
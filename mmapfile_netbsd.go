@@ -0,0 +1,24 @@
+//go:build netbsd
+
+package mmapfile
+
+import "syscall"
+
+const (
+	// mapPopulate is zero, as MAP_POPULATE is Linux-specific; the mapping is
+	// prefetched with madvise instead.
+	mapPopulate = 0
+
+	// mapNoReserve is zero, as WithNoReserve is only honored on Linux.
+	mapNoReserve = 0
+
+	// mapSharedValidate is zero, as MAP_SHARED_VALIDATE is Linux-specific.
+	mapSharedValidate = 0
+
+	// sysMsync is the msync(2) syscall number (SYS___MSYNC13), which the
+	// syscall package does not define for NetBSD.
+	sysMsync = 277
+
+	// fcntlSetLockWait is the blocking fcntl(2) record lock command.
+	fcntlSetLockWait = syscall.F_SETLKW
+)
@@ -8,6 +8,9 @@ import (
 	"os"
 )
 
+// nativeMapping is false, as the file is read into memory instead of mapped.
+const nativeMapping = false
+
 // Open memory-maps the named file for reading.
 //
 // On unsupported platforms, this falls back to regular file I/O.
@@ -19,23 +22,54 @@ func Open(name string) (*MmapFile, error) {
 //
 // Supported flags:
 //   - [os.O_RDONLY]: Open for reading only
+//   - [os.O_WRONLY]: Open for writing only (see below)
 //   - [os.O_RDWR]: Open for reading and writing
 //   - [os.O_CREATE]: Create the file if it doesn't exist (requires size > 0)
+//   - [os.O_EXCL]: Used with [os.O_CREATE], file must not exist
 //   - [os.O_TRUNC]: Truncate the file to the specified size
 //
 // The size parameter is used when creating a new file or when [os.O_TRUNC] is
 // specified. For existing files opened without [os.O_TRUNC], size is ignored
 // and the file's current size is used.
+// Creating a writable file with a size of 0, or opening an empty one with
+// [os.O_CREATE], returns [ErrInvalidSize], as nothing could be written to it;
+// pass [WithGrowIncrement] to [OpenFileWith] to start empty and grow on write.
+//
+// Directories, devices, sockets, and other non-regular files are rejected
+// with [ErrNotRegularFile]; see [WithAllowSpecial].
+//
+// With [os.O_WRONLY], the file is still mapped read-write, since there is no
+// write-only memory protection, so read permission on the file is required.
+// However, [MmapFile.Read], [MmapFile.ReadAt], and related methods return
+// [ErrWriteOnly].
 //
 // Note: [os.O_APPEND] is not supported as mmap does not support growing files.
 func OpenFile(name string, flag int, perm os.FileMode, size int64) (*MmapFile, error) {
+	return OpenFileWith(name, flag, perm, size)
+}
+
+// OpenFileWith is like [OpenFile], but additionally applies the given
+// [Option]s to control how the file is mapped.
+func OpenFileWith(name string, flag int, perm os.FileMode, size int64, opts ...Option) (*MmapFile, error) {
+	o := newOptions(opts)
+	o.borrowed = false // the file opened here is always owned
+
 	writable := flag&os.O_RDWR != 0 || flag&os.O_WRONLY != 0
+	writeOnly := flag&(os.O_RDWR|os.O_WRONLY) == os.O_WRONLY
 	create := flag&os.O_CREATE != 0
 	trunc := flag&os.O_TRUNC != 0
 
 	if flag&os.O_APPEND != 0 {
 		return nil, fmt.Errorf("mmapfile: O_APPEND is not supported")
 	}
+	if o.unshared {
+		return nil, ErrUnsupported
+	}
+	if create && writable {
+		if err := checkCreateSize(name, size, o); err != nil {
+			return nil, err
+		}
+	}
 
 	osFlag := os.O_RDONLY
 	if writable {
@@ -44,6 +78,11 @@ func OpenFile(name string, flag int, perm os.FileMode, size int64) (*MmapFile, e
 	if create {
 		osFlag |= os.O_CREATE
 	}
+	if flag&os.O_EXCL != 0 {
+		osFlag |= os.O_EXCL
+	}
+
+	created := createsFile(name, osFlag)
 
 	f, err := os.OpenFile(name, osFlag, perm)
 	if err != nil {
@@ -56,59 +95,229 @@ func OpenFile(name string, flag int, perm os.FileMode, size int64) (*MmapFile, e
 		return nil, err
 	}
 
-	fileSize := fi.Size()
+	if err := checkMode(fi, o); err != nil {
+		_ = f.Close()
+		return nil, err
+	}
 
-	if create && fileSize == 0 && size > 0 {
-		if err := f.Truncate(size); err != nil {
-			_ = f.Close()
-			return nil, fmt.Errorf("mmapfile: failed to set file size: %w", err)
+	fileSize, err := openSize(fi, create, trunc, size, o)
+	if err != nil {
+		_ = f.Close()
+		if created {
+			_ = os.Remove(name)
 		}
-		fileSize = size
-	} else if trunc && size > 0 {
-		if err := f.Truncate(size); err != nil {
+		return nil, err
+	}
+
+	if fi.Mode().IsRegular() && fileSize != fi.Size() {
+		if err := f.Truncate(fileSize); err != nil {
 			_ = f.Close()
-			return nil, fmt.Errorf("mmapfile: failed to truncate file: %w", err)
+			return nil, fmt.Errorf("mmapfile: failed to set file size: %w", err)
 		}
-		fileSize = size
 	}
 
-	if fileSize == 0 {
+	mf, err := mapFile(f, name, writable, writeOnly, 0, fileSize, o)
+	if err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+
+	return mf, nil
+}
+
+// dupFile reopens the file for reading by name, as there is no portable way
+// to duplicate a file descriptor here.
+func dupFile(file *os.File) (*os.File, error) {
+	return os.Open(file.Name())
+}
+
+// mapFile reads the size bytes of file starting at offset off into memory. On
+// success, the returned [MmapFile] owns file; on failure, closing file is up to
+// the caller.
+func mapFile(file *os.File, name string, writable, writeOnly bool, off, size int64, o options) (*MmapFile, error) {
+	if err := o.checkSize(size); err != nil {
+		return nil, err
+	}
+
+	holder := &fileHolder{file: file, borrowed: o.borrowed}
+
+	if size == 0 {
 		return &MmapFile{
-			data:     nil,
-			name:     name,
-			writable: writable,
-			platform: &fileHolder{file: f},
+			data:      nil,
+			base:      off,
+			name:      name,
+			writable:  writable,
+			writeOnly: writeOnly,
+			private:   o.private,
+			exclusive: o.exclusive,
+			zeroFill:  o.zeroFill,
+			unshared:  o.unshared,
+			writeThru: o.writeThrough,
+			growBy:    o.growIncrement,
+			opts:      o,
+			platform:  holder,
 		}, nil
 	}
 
-	if fileSize < 0 {
-		_ = f.Close()
+	if size < 0 {
 		return nil, fmt.Errorf("mmapfile: file %q has negative size", name)
 	}
-	if fileSize != int64(int(fileSize)) {
-		_ = f.Close()
-		return nil, fmt.Errorf("mmapfile: file %q is too large", name)
+	if size > maxInt {
+		return nil, fmt.Errorf("%w: file %q is %d bytes", ErrAddressSpaceExhausted, name, size)
 	}
 
-	// Fallback: read entire file into memory
-	data := make([]byte, fileSize)
-	if _, err := io.ReadFull(f, data); err != nil {
-		_ = f.Close()
-		return nil, fmt.Errorf("mmapfile: failed to read file: %w", err)
+	data, err := mmap(o.storage(), file, off, size)
+	if err != nil {
+		return nil, err
 	}
 
 	mf := &MmapFile{
-		data:     data,
-		name:     name,
-		writable: writable,
-		platform: &fileHolder{file: f},
+		data:      data,
+		base:      off,
+		name:      name,
+		writable:  writable,
+		writeOnly: writeOnly,
+		private:   o.private,
+		exclusive: o.exclusive,
+		zeroFill:  o.zeroFill,
+		unshared:  o.unshared,
+		writeThru: o.writeThrough,
+		growBy:    o.growIncrement,
+		opts:      o,
+		platform:  holder,
 	}
 
 	return mf, nil
 }
 
+// mmap emulates a mapping by reading the size bytes of file starting at
+// offset off into memory with b.
+func mmap(b Backend, file *os.File, off, size int64) ([]byte, error) {
+	data, err := b.Map(file, off, size)
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) != size {
+		_ = b.Unmap(data)
+		return nil, fmt.Errorf("mmapfile: backend returned %d bytes, want %d", len(data), size)
+	}
+
+	return data, nil
+}
+
+// storage returns the [Backend] set by [WithBackend], or the default one.
+func (o options) storage() Backend {
+	if o.backend != nil {
+		return o.backend
+	}
+
+	return heapBackend{}
+}
+
+// heapBackend is the default [Backend], which reads the file into a newly
+// allocated slice.
+type heapBackend struct{}
+
+// Map implements [Backend].
+func (heapBackend) Map(file *os.File, off, size int64) ([]byte, error) {
+	data := make([]byte, size)
+	if _, err := io.ReadFull(io.NewSectionReader(file, off, size), data); err != nil {
+		return nil, fmt.Errorf("mmapfile: failed to read file: %w", err)
+	}
+
+	return data, nil
+}
+
+// Flush implements [Backend].
+func (heapBackend) Flush(file *os.File, off int64, data []byte) error {
+	_, err := file.WriteAt(data, off)
+
+	return err
+}
+
+// Unmap implements [Backend]; the slice is left to the garbage collector.
+func (heapBackend) Unmap(data []byte) error {
+	return nil
+}
+
+// unmap releases the in-memory copy of the file.
+//
+// The caller must hold f.mu.
+func (f *MmapFile) unmap() error {
+	if f.data == nil || f.memory {
+		return nil
+	}
+
+	return f.opts.storage().Unmap(f.data[:cap(f.data)])
+}
+
+// mapAlign returns 1, as the in-memory copy has no alignment requirements.
+func mapAlign() int64 {
+	return 1
+}
+
+// remap re-reads file at the given size.
+//
+// The caller must hold f.mu.
+func (f *MmapFile) remap(file *os.File, size int64) error {
+	data, err := mmap(f.opts.storage(), file, f.base, size)
+	if err != nil {
+		return err
+	}
+	err = f.unmap()
+	f.data = data
+
+	return err
+}
+
+// resize truncates or extends file to size and resizes the in-memory copy to
+// match. Pending changes are kept, and written back as usual.
+//
+// The caller must hold f.mu.
+func (f *MmapFile) resize(file *os.File, size int64) error {
+	if err := file.Truncate(f.base + size); err != nil {
+		return fmt.Errorf("mmapfile: failed to truncate file: %w", err)
+	}
+
+	data, err := mmap(f.opts.storage(), file, f.base, size)
+	if err != nil {
+		return err
+	}
+	copy(data, f.data)
+	err = f.unmap()
+	f.data = data
+
+	return err
+}
+
+// writeThrough writes the n bytes at off of the in-memory copy to the file
+// right away, if it was opened with [WithWriteThrough].
+//
+// The caller must hold f.mu.
+func (f *MmapFile) writeThrough(off int64, n int) error {
+	if !f.writeThru || f.private || n == 0 {
+		return nil
+	}
+
+	fh, ok := f.platform.(*fileHolder)
+	if !ok || fh == nil || fh.file == nil {
+		return nil
+	}
+
+	return f.opts.storage().Flush(fh.file, f.base+off, f.data[off:off+int64(n)])
+}
+
 // Close closes the memory-mapped file.
+//
+// The in-memory copy is written back to the file first, unless it has not
+// been modified since it was read or last written back by [Sync].
 func (f *MmapFile) Close() error {
+	return f.close(true)
+}
+
+// close implements [Close], and [CloseNoSync] if sync is false, in which case
+// the in-memory copy is not written back.
+func (f *MmapFile) close(sync bool) error {
 	f.mu.Lock()
 	defer f.mu.Unlock()
 
@@ -117,21 +326,25 @@ func (f *MmapFile) Close() error {
 	}
 	f.closed = true
 
-	var err error
+	err := f.closeCheck()
 	if fh, ok := f.platform.(*fileHolder); ok && fh != nil && fh.file != nil {
-		if f.writable && len(f.data) > 0 {
-			if _, seekErr := fh.file.Seek(0, io.SeekStart); seekErr != nil {
-				err = seekErr
-			} else if _, writeErr := fh.file.Write(f.data); writeErr != nil {
-				err = writeErr
-			}
+		if err == nil && sync && f.writable && !f.private && f.dirty.Load() && len(f.data) > 0 {
+			err = f.opts.storage().Flush(fh.file, f.base, f.data)
 		}
-		if closeErr := fh.file.Close(); closeErr != nil && err == nil {
-			err = closeErr
+		if tErr := f.trim(fh.file, int64(len(f.data))); tErr != nil && err == nil {
+			err = tErr
+		}
+		if !fh.borrowed {
+			if closeErr := fh.file.Close(); closeErr != nil && err == nil {
+				err = closeErr
+			}
 		}
 		f.platform = nil
 	}
 
+	if uErr := f.unmap(); uErr != nil && err == nil {
+		err = uErr
+	}
 	f.data = nil
 
 	return err
@@ -147,16 +360,91 @@ func (f *MmapFile) Sync() error {
 	}
 
 	fh, ok := f.platform.(*fileHolder)
-	if !f.writable || !ok || fh == nil || fh.file == nil || len(f.data) == 0 {
+	if !f.writable || f.private || !ok || fh == nil || fh.file == nil || len(f.data) == 0 {
+		return nil
+	}
+
+	if f.dirty.Load() {
+		if err := f.opts.storage().Flush(fh.file, f.base, f.data); err != nil {
+			return err
+		}
+		f.dirty.Store(false)
+	}
+
+	if err := fh.file.Sync(); err != nil {
+		return err
+	}
+	f.stats.syncs.Add(1)
+
+	return nil
+}
+
+// flushAndEvict implements [FlushAndEvict] over b, a region of the in-memory
+// copy, by writing it back to the file if it was modified. The copy is kept,
+// as it is the only one.
+//
+// The caller must hold f.mu.
+func (f *MmapFile) flushAndEvict(b []byte) error {
+	fh, ok := f.platform.(*fileHolder)
+	if !f.writable || f.private || !ok || fh == nil || fh.file == nil || !f.dirty.Load() {
 		return nil
 	}
 
-	if _, err := fh.file.Seek(0, io.SeekStart); err != nil {
+	// b shares the backing array of f.data, so its capacity locates its start
+	off := int64(cap(f.data) - cap(b))
+	if err := f.opts.storage().Flush(fh.file, f.base+off, b); err != nil {
 		return err
 	}
-	if _, err := fh.file.Write(f.data); err != nil {
+	if err := fh.file.Sync(); err != nil {
 		return err
 	}
+	f.stats.syncs.Add(1)
+
+	return nil
+}
+
+// setReadOnly writes any pending changes back to the file, since they would
+// otherwise be dropped once the file is no longer writable.
+//
+// The caller must hold f.mu.
+func (f *MmapFile) setReadOnly() error {
+	fh, ok := f.platform.(*fileHolder)
+	if f.private || !f.dirty.Load() || !ok || fh == nil || fh.file == nil || len(f.data) == 0 {
+		return nil
+	}
+
+	if err := f.opts.storage().Flush(fh.file, f.base, f.data); err != nil {
+		return err
+	}
+	f.dirty.Store(false)
+
+	return nil
+}
+
+// SyncMeta flushes changes and file metadata to the underlying file.
+//
+// On the fallback, [Sync] already fsyncs the file after writing the buffer
+// back, so this is equivalent to [Sync].
+func (f *MmapFile) SyncMeta() error {
+	return f.Sync()
+}
+
+// prefetch is a no-op, since the fallback keeps the whole file in memory.
+func prefetch(b []byte) error {
+	return nil
+}
+
+// resident is not supported on the fallback.
+func resident(b []byte) ([]bool, error) {
+	return nil, ErrUnsupported
+}
+
+// lockRange is not supported on this platform.
+func lockRange(file *os.File, off, length int64, exclusive bool) error {
+	return ErrUnsupported
+}
 
-	return fh.file.Sync()
+// unlockRange is not supported on this platform.
+func unlockRange(file *os.File, off, length int64) error {
+	return ErrUnsupported
 }
@@ -1,16 +1,31 @@
 package mmapfile
 
 import (
+	"bufio"
 	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/gob"
 	"errors"
 	"fmt"
+	"hash/crc32"
 	"io"
+	"io/fs"
+	"math"
 	"os"
 	"path/filepath"
 	"runtime"
+	"slices"
+	"strconv"
 	"strings"
 	"sync"
 	"testing"
+	"testing/iotest"
+	"time"
+	"unicode/utf8"
+	"unsafe"
 )
 
 type failingWriter struct {
@@ -113,6 +128,21 @@ func TestOpenFile(t *testing.T) {
 		}
 	})
 
+	t.Run("O_EXCL on existing file", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "excl.txt")
+
+		f, err := OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0644, 100)
+		if err != nil {
+			t.Fatalf("OpenFile failed: %v", err)
+		}
+		defer f.Close()
+
+		_, err = OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0644, 100)
+		if !errors.Is(err, os.ErrExist) {
+			t.Errorf("second OpenFile with O_EXCL: got %v, want os.ErrExist", err)
+		}
+	})
+
 	t.Run("truncate existing file", func(t *testing.T) {
 		path := filepath.Join(t.TempDir(), "trunc.txt")
 
@@ -462,6 +492,30 @@ func TestSeek(t *testing.T) {
 		}
 	})
 
+	t.Run("overflow", func(t *testing.T) {
+		before, _ := f.Seek(7, io.SeekStart)
+
+		_, err := f.Seek(math.MaxInt64, io.SeekEnd)
+		if !errors.Is(err, ErrOffsetTooLarge) {
+			t.Errorf("Seek(MaxInt64, SeekEnd): got %v, want ErrOffsetTooLarge", err)
+		}
+
+		_, err = f.Seek(math.MaxInt64, io.SeekCurrent)
+		if !errors.Is(err, ErrOffsetTooLarge) {
+			t.Errorf("Seek(MaxInt64, SeekCurrent): got %v, want ErrOffsetTooLarge", err)
+		}
+
+		after, _ := f.Seek(0, io.SeekCurrent)
+		if after != before {
+			t.Errorf("offset = %d after failed Seek, want %d", after, before)
+		}
+
+		pos, err := f.Seek(math.MaxInt64, io.SeekStart)
+		if err != nil || pos != math.MaxInt64 {
+			t.Errorf("Seek(MaxInt64, SeekStart) = %d, %v, want %d, nil", pos, err, int64(math.MaxInt64))
+		}
+	})
+
 	t.Run("seek past end (allowed)", func(t *testing.T) {
 		pos, err := f.Seek(int64(f.Len()+100), io.SeekStart)
 		if err != nil {
@@ -624,6 +678,378 @@ func TestReadFrom(t *testing.T) {
 			t.Errorf("ReadFrom read %d bytes, want 10", n)
 		}
 	})
+
+	t.Run("from file", func(t *testing.T) {
+		dir := t.TempDir()
+		srcPath := filepath.Join(dir, "src.txt")
+		if err := os.WriteFile(srcPath, []byte("0123456789abcdef"), 0644); err != nil {
+			t.Fatalf("WriteFile failed: %v", err)
+		}
+
+		src, err := os.Open(srcPath)
+		if err != nil {
+			t.Fatalf("Open failed: %v", err)
+		}
+		defer src.Close()
+
+		f, err := OpenFile(filepath.Join(dir, "dst.txt"), os.O_RDWR|os.O_CREATE, 0644, 20)
+		if err != nil {
+			t.Fatalf("OpenFile failed: %v", err)
+		}
+		defer f.Close()
+
+		f.Seek(2, io.SeekStart)
+		n, err := f.ReadFrom(src)
+		if err != nil {
+			t.Fatalf("ReadFrom failed: %v", err)
+		}
+		if n != 16 {
+			t.Errorf("ReadFrom read %d bytes, want 16", n)
+		}
+		if got := string(f.Bytes()[2:18]); got != "0123456789abcdef" {
+			t.Errorf("mapping holds %q, want %q", got, "0123456789abcdef")
+		}
+		if pos, _ := f.Seek(0, io.SeekCurrent); pos != 18 {
+			t.Errorf("offset = %d, want 18", pos)
+		}
+
+		// the rest of src does not fit in the two bytes left
+		src.Seek(0, io.SeekStart)
+		n, err = f.ReadFrom(src)
+		if err != ErrWriteOutOfBounds {
+			t.Errorf("ReadFrom got err %v, want ErrWriteOutOfBounds", err)
+		}
+		if n != 2 {
+			t.Errorf("ReadFrom read %d bytes, want 2", n)
+		}
+		if got := string(f.Bytes()[18:]); got != "01" {
+			t.Errorf("mapping tail holds %q, want %q", got, "01")
+		}
+	})
+}
+
+// stallingReader returns (0, nil) stalls times before delegating to r.
+type stallingReader struct {
+	r      io.Reader
+	stalls int
+}
+
+func (s *stallingReader) Read(p []byte) (int, error) {
+	if s.stalls > 0 {
+		s.stalls--
+		return 0, nil
+	}
+
+	return s.r.Read(p)
+}
+
+// windowRecorder records the size of the buffer passed to each Read, and
+// returns at most max bytes per call, like a slow connection.
+type windowRecorder struct {
+	r     io.Reader
+	max   int
+	sizes []int
+}
+
+func (w *windowRecorder) Read(p []byte) (int, error) {
+	w.sizes = append(w.sizes, len(p))
+
+	return w.r.Read(p[:min(len(p), w.max)])
+}
+
+func TestReadFromChunked(t *testing.T) {
+	t.Run("custom chunk", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "chunked.bin")
+		f, err := OpenFileWith(path, os.O_RDWR|os.O_CREATE, 0644, 100, WithReadChunkSize(16))
+		if err != nil {
+			t.Fatalf("OpenFileWith failed: %v", err)
+		}
+		defer f.Close()
+
+		data := strings.Repeat("0123456789", 10)
+		r := &windowRecorder{r: strings.NewReader(data), max: 7}
+		n, err := f.ReadFrom(r)
+		if err != nil {
+			t.Fatalf("ReadFrom failed: %v", err)
+		}
+		if n != 100 {
+			t.Errorf("ReadFrom() = %d, want 100", n)
+		}
+		if string(f.Bytes()) != data {
+			t.Error("file contents differ from the input")
+		}
+
+		// each short read is followed by another over the next window
+		for i, size := range r.sizes {
+			if size > 16 {
+				t.Errorf("Read %d got a %d-byte window, want at most 16", i, size)
+			}
+		}
+		if len(r.sizes) < 100/7 {
+			t.Errorf("got %d reads, want at least %d", len(r.sizes), 100/7)
+		}
+	})
+
+	t.Run("excess data", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "chunked.bin")
+		f, err := OpenFileWith(path, os.O_RDWR|os.O_CREATE, 0644, 20, WithReadChunkSize(8))
+		if err != nil {
+			t.Fatalf("OpenFileWith failed: %v", err)
+		}
+		defer f.Close()
+
+		n, err := f.ReadFrom(strings.NewReader(strings.Repeat("x", 21)))
+		if !errors.Is(err, ErrWriteOutOfBounds) {
+			t.Errorf("ReadFrom: got %v, want ErrWriteOutOfBounds", err)
+		}
+		if n != 20 {
+			t.Errorf("ReadFrom() = %d, want 20", n)
+		}
+	})
+
+	t.Run("default chunk", func(t *testing.T) {
+		const size = 4<<20 + 10
+
+		path := filepath.Join(t.TempDir(), "chunked.bin")
+		f, err := OpenFile(path, os.O_RDWR|os.O_CREATE, 0644, size)
+		if err != nil {
+			t.Fatalf("OpenFile failed: %v", err)
+		}
+		defer f.Close()
+
+		r := &windowRecorder{r: bytes.NewReader(make([]byte, size)), max: size}
+		if n, err := f.ReadFrom(r); n != size || err != nil {
+			t.Fatalf("ReadFrom() = %d, %v, want %d, nil", n, err, size)
+		}
+		if len(r.sizes) < 2 || r.sizes[0] != 4<<20 || r.sizes[1] != 10 {
+			t.Errorf("Read windows = %v, want [%d 10 ...]", r.sizes, 4<<20)
+		}
+	})
+}
+
+func TestReadFromN(t *testing.T) {
+	const size = 10
+
+	tests := []struct {
+		name   string
+		input  string
+		limit  int64
+		want   string
+		unread int
+	}{
+		{"limit below reader and mapping", "0123456789abcdefghij", 5, "01234", 15},
+		{"limit equal to reader and mapping", "0123456789", size, "0123456789", 0},
+		{"limit above reader and mapping", "0123456789abcdefghij", 30, "0123456789", 10},
+		{"reader shorter than limit", "012", 5, "012", 0},
+		{"zero limit", "0123456789", 0, "", 10},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "readfromn.bin")
+			f, err := OpenFile(path, os.O_RDWR|os.O_CREATE, 0644, size)
+			if err != nil {
+				t.Fatalf("OpenFile failed: %v", err)
+			}
+			defer f.Close()
+
+			r := strings.NewReader(tt.input)
+			n, err := f.ReadFromN(r, tt.limit)
+			if err != nil {
+				t.Fatalf("ReadFromN failed: %v", err)
+			}
+			if n != int64(len(tt.want)) {
+				t.Errorf("ReadFromN() = %d, want %d", n, len(tt.want))
+			}
+			if got := string(f.Bytes()[:n]); got != tt.want {
+				t.Errorf("file holds %q, want %q", got, tt.want)
+			}
+			if r.Len() != tt.unread {
+				t.Errorf("%d bytes left unread, want %d", r.Len(), tt.unread)
+			}
+			if off, _ := f.Seek(0, io.SeekCurrent); off != n {
+				t.Errorf("file offset = %d, want %d", off, n)
+			}
+		})
+	}
+
+	t.Run("from file", func(t *testing.T) {
+		dir := t.TempDir()
+		src := filepath.Join(dir, "src.bin")
+		if err := os.WriteFile(src, []byte("0123456789abcdefghij"), 0644); err != nil {
+			t.Fatalf("WriteFile failed: %v", err)
+		}
+		in, err := os.Open(src)
+		if err != nil {
+			t.Fatalf("Open failed: %v", err)
+		}
+		defer in.Close()
+
+		f, err := OpenFile(filepath.Join(dir, "dst.bin"), os.O_RDWR|os.O_CREATE, 0644, size)
+		if err != nil {
+			t.Fatalf("OpenFile failed: %v", err)
+		}
+		defer f.Close()
+
+		if n, err := f.ReadFromN(in, 4); n != 4 || err != nil {
+			t.Fatalf("ReadFromN() = %d, %v, want 4, nil", n, err)
+		}
+		if n, err := f.ReadFromN(in, 30); n != 6 || err != nil {
+			t.Fatalf("ReadFromN() = %d, %v, want 6, nil", n, err)
+		}
+		if got := string(f.Bytes()); got != "0123456789" {
+			t.Errorf("file holds %q, want %q", got, "0123456789")
+		}
+		if pos, _ := in.Seek(0, io.SeekCurrent); pos != size {
+			t.Errorf("source offset = %d, want %d", pos, size)
+		}
+	})
+
+	t.Run("negative limit", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "readfromn.bin")
+		f, err := OpenFile(path, os.O_RDWR|os.O_CREATE, 0644, size)
+		if err != nil {
+			t.Fatalf("OpenFile failed: %v", err)
+		}
+		defer f.Close()
+
+		if _, err := f.ReadFromN(strings.NewReader("x"), -1); !errors.Is(err, ErrNegativeCount) {
+			t.Errorf("ReadFromN with negative limit: got %v, want ErrNegativeCount", err)
+		}
+	})
+}
+
+func TestTeeReadFrom(t *testing.T) {
+	data := strings.Repeat("streamed data ", 100)
+
+	t.Run("hashes the stored data", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "tee.txt")
+		f, err := OpenFile(path, os.O_RDWR|os.O_CREATE, 0644, int64(len(data)))
+		if err != nil {
+			t.Fatalf("OpenFile failed: %v", err)
+		}
+		defer f.Close()
+
+		h := sha256.New()
+		n, err := f.TeeReadFrom(iotest.OneByteReader(strings.NewReader(data)), h)
+		if err != nil {
+			t.Fatalf("TeeReadFrom failed: %v", err)
+		}
+		if n != int64(len(data)) {
+			t.Errorf("TeeReadFrom() = %d, want %d", n, len(data))
+		}
+		if string(f.Bytes()) != data {
+			t.Error("file contents differ from the input")
+		}
+		if want := sha256.Sum256([]byte(data)); !bytes.Equal(h.Sum(nil), want[:]) {
+			t.Error("tee saw different data than the input")
+		}
+	})
+
+	t.Run("with excess data", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "tee.txt")
+		f, err := OpenFile(path, os.O_RDWR|os.O_CREATE, 0644, 10)
+		if err != nil {
+			t.Fatalf("OpenFile failed: %v", err)
+		}
+		defer f.Close()
+
+		var tee bytes.Buffer
+		n, err := f.TeeReadFrom(strings.NewReader(data), &tee)
+		if !errors.Is(err, ErrWriteOutOfBounds) {
+			t.Errorf("TeeReadFrom: got %v, want ErrWriteOutOfBounds", err)
+		}
+		if n != 10 {
+			t.Errorf("TeeReadFrom() = %d, want 10", n)
+		}
+		if tee.String() != data[:10] {
+			t.Errorf("tee got %q, want %q", tee.String(), data[:10])
+		}
+	})
+
+	t.Run("tee error", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "tee.txt")
+		f, err := OpenFile(path, os.O_RDWR|os.O_CREATE, 0644, int64(len(data)))
+		if err != nil {
+			t.Fatalf("OpenFile failed: %v", err)
+		}
+		defer f.Close()
+
+		n, err := f.TeeReadFrom(strings.NewReader(data), &failingWriter{limit: 5})
+		if err == nil {
+			t.Error("TeeReadFrom should fail when the tee fails")
+		}
+		if n != int64(len(data)) {
+			t.Errorf("TeeReadFrom() = %d, want %d stored", n, len(data))
+		}
+	})
+
+	t.Run("read-only", func(t *testing.T) {
+		f, err := Open("testdata/hello.txt")
+		if err != nil {
+			t.Fatalf("Open failed: %v", err)
+		}
+		defer f.Close()
+
+		if _, err := f.TeeReadFrom(strings.NewReader(data), io.Discard); !errors.Is(err, ErrReadOnly) {
+			t.Errorf("TeeReadFrom on read-only file: got %v, want ErrReadOnly", err)
+		}
+	})
+}
+
+func TestWriteEmptyMapping(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "empty.bin")
+	if err := os.WriteFile(path, nil, 0644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+
+	f, err := OpenFile(path, os.O_RDWR, 0, 0)
+	if err != nil {
+		t.Fatalf("OpenFile failed: %v", err)
+	}
+	defer f.Close()
+
+	t.Run("Write empty", func(t *testing.T) {
+		if n, err := f.Write(nil); n != 0 || err != nil {
+			t.Errorf("Write(nil) = (%d, %v), want (0, nil)", n, err)
+		}
+		if n, err := f.WriteString(""); n != 0 || err != nil {
+			t.Errorf("WriteString(\"\") = (%d, %v), want (0, nil)", n, err)
+		}
+	})
+
+	t.Run("Write non-empty", func(t *testing.T) {
+		if n, err := f.Write([]byte("x")); n != 0 || !errors.Is(err, ErrWriteOutOfBounds) {
+			t.Errorf("Write = (%d, %v), want (0, ErrWriteOutOfBounds)", n, err)
+		}
+	})
+
+	t.Run("ReadFrom empty", func(t *testing.T) {
+		if n, err := f.ReadFrom(strings.NewReader("")); n != 0 || err != nil {
+			t.Errorf("ReadFrom = (%d, %v), want (0, nil)", n, err)
+		}
+		r := &stallingReader{r: strings.NewReader(""), stalls: 3}
+		if n, err := f.ReadFrom(r); n != 0 || err != nil {
+			t.Errorf("ReadFrom stalling reader = (%d, %v), want (0, nil)", n, err)
+		}
+	})
+
+	t.Run("ReadFrom non-empty", func(t *testing.T) {
+		if n, err := f.ReadFrom(strings.NewReader("x")); n != 0 || !errors.Is(err, ErrWriteOutOfBounds) {
+			t.Errorf("ReadFrom = (%d, %v), want (0, ErrWriteOutOfBounds)", n, err)
+		}
+	})
+
+	t.Run("ReadFrom no progress", func(t *testing.T) {
+		r := &stallingReader{r: strings.NewReader(""), stalls: math.MaxInt}
+		if _, err := f.ReadFrom(r); !errors.Is(err, io.ErrNoProgress) {
+			t.Errorf("got %v, want io.ErrNoProgress", err)
+		}
+	})
+
+	if f.dirty.Load() {
+		t.Error("file marked dirty after writing nothing")
+	}
 }
 
 func TestWriteTo(t *testing.T) {
@@ -662,41 +1088,178 @@ func TestWriteTo(t *testing.T) {
 			t.Errorf("WriteTo wrote %d bytes, want 5", n)
 		}
 	})
+
+	t.Run("file destination", func(t *testing.T) {
+		tempDir := t.TempDir()
+		content := bytes.Repeat([]byte("0123456789"), 1000)
+
+		for _, tc := range []struct {
+			name    string
+			opts    []Option
+			dstFlag int
+		}{
+			{"shared", nil, os.O_WRONLY | os.O_CREATE},
+			{"private", []Option{WithPrivate()}, os.O_WRONLY | os.O_CREATE},
+			{"append", nil, os.O_WRONLY | os.O_CREATE | os.O_APPEND},
+		} {
+			t.Run(tc.name, func(t *testing.T) {
+				src := filepath.Join(tempDir, tc.name+".src")
+				if err := os.WriteFile(src, content, 0644); err != nil {
+					t.Fatalf("WriteFile failed: %v", err)
+				}
+
+				f, err := OpenFileWith(src, os.O_RDWR, 0, 0, tc.opts...)
+				if err != nil {
+					t.Fatalf("OpenFileWith failed: %v", err)
+				}
+				defer f.Close()
+
+				if _, err := f.WriteAt([]byte("MODIFIED"), 100); err != nil {
+					t.Fatalf("WriteAt failed: %v", err)
+				}
+
+				dstPath := filepath.Join(tempDir, tc.name+".dst")
+				dst, err := os.OpenFile(dstPath, tc.dstFlag, 0644)
+				if err != nil {
+					t.Fatalf("OpenFile failed: %v", err)
+				}
+				defer dst.Close()
+
+				n, err := f.WriteTo(dst)
+				if err != nil {
+					t.Fatalf("WriteTo failed: %v", err)
+				}
+				if n != int64(len(content)) {
+					t.Errorf("WriteTo wrote %d bytes, want %d", n, len(content))
+				}
+
+				got, err := os.ReadFile(dstPath)
+				if err != nil {
+					t.Fatalf("ReadFile failed: %v", err)
+				}
+				if !bytes.Equal(got, f.Bytes()) {
+					t.Error("destination content does not match the mapping")
+				}
+
+				if pos, _ := f.Seek(0, io.SeekCurrent); pos != 0 {
+					t.Errorf("offset after WriteTo = %d, want 0", pos)
+				}
+			})
+		}
+	})
 }
 
-func TestEmptyFile(t *testing.T) {
-	f, err := Open("testdata/empty.txt")
+func TestWriteRangeTo(t *testing.T) {
+	f, err := Open("testdata/binary.dat")
 	if err != nil {
 		t.Fatalf("Open failed: %v", err)
 	}
 	defer f.Close()
 
-	if f.Len() != 0 {
-		t.Errorf("Len() = %d, want 0", f.Len())
-	}
+	size := int64(f.Len())
+	data := f.Bytes()
 
-	buf := make([]byte, 10)
-	n, err := f.Read(buf)
-	if n != 0 || err != io.EOF {
-		t.Errorf("Read empty file: got n=%d, err=%v, want n=0, err=EOF", n, err)
+	tests := []struct {
+		name   string
+		off    int64
+		length int64
+		want   []byte
+	}{
+		{"mid-file range", 10, 16, data[10:26]},
+		{"range overrunning the end", size - 8, 100, data[size-8:]},
+		{"whole file", 0, size, data},
+		{"empty range", 10, 0, nil},
+		{"offset past the end", size + 10, 5, nil},
 	}
 
-	n, err = f.ReadAt(buf, 0)
-	if n != 0 || err != io.EOF {
-		t.Errorf("ReadAt empty file: got n=%d, err=%v, want n=0, err=EOF", n, err)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			n, err := f.WriteRangeTo(&buf, tt.off, tt.length)
+			if err != nil {
+				t.Fatalf("WriteRangeTo failed: %v", err)
+			}
+			if n != int64(len(tt.want)) {
+				t.Errorf("WriteRangeTo wrote %d bytes, want %d", n, len(tt.want))
+			}
+			if !bytes.Equal(buf.Bytes(), tt.want) {
+				t.Errorf("WriteRangeTo wrote %q, want %q", buf.Bytes(), tt.want)
+			}
+		})
 	}
-}
 
-func TestInterfaceCompliance(t *testing.T) {
-	path := filepath.Join(t.TempDir(), "interface.txt")
-	f, err := OpenFile(path, os.O_RDWR|os.O_CREATE, 0644, 100)
-	if err != nil {
-		t.Fatalf("OpenFile failed: %v", err)
-	}
-	defer f.Close()
+	t.Run("to file", func(t *testing.T) {
+		out, err := os.Create(filepath.Join(t.TempDir(), "range.bin"))
+		if err != nil {
+			t.Fatalf("Create failed: %v", err)
+		}
+		defer out.Close()
 
-	// Test that MmapFile can be used where these interfaces are expected
-	var _ io.Reader = f
+		if n, err := f.WriteRangeTo(out, size-8, 100); n != 8 || err != nil {
+			t.Fatalf("WriteRangeTo() = %d, %v, want 8, nil", n, err)
+		}
+		got, err := os.ReadFile(out.Name())
+		if err != nil {
+			t.Fatalf("ReadFile failed: %v", err)
+		}
+		if !bytes.Equal(got, data[size-8:]) {
+			t.Errorf("file holds %q, want %q", got, data[size-8:])
+		}
+	})
+
+	t.Run("with error", func(t *testing.T) {
+		n, err := f.WriteRangeTo(&failingWriter{limit: 5}, 10, 16)
+		if err == nil {
+			t.Error("WriteRangeTo should fail with failing writer")
+		}
+		if n != 5 {
+			t.Errorf("WriteRangeTo wrote %d bytes, want 5", n)
+		}
+	})
+
+	t.Run("negative arguments", func(t *testing.T) {
+		if _, err := f.WriteRangeTo(io.Discard, -1, 5); !errors.Is(err, ErrNegativeOffset) {
+			t.Errorf("negative offset: got %v, want ErrNegativeOffset", err)
+		}
+		if _, err := f.WriteRangeTo(io.Discard, 0, -1); !errors.Is(err, ErrNegativeCount) {
+			t.Errorf("negative length: got %v, want ErrNegativeCount", err)
+		}
+	})
+}
+
+func TestEmptyFile(t *testing.T) {
+	f, err := Open("testdata/empty.txt")
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer f.Close()
+
+	if f.Len() != 0 {
+		t.Errorf("Len() = %d, want 0", f.Len())
+	}
+
+	buf := make([]byte, 10)
+	n, err := f.Read(buf)
+	if n != 0 || err != io.EOF {
+		t.Errorf("Read empty file: got n=%d, err=%v, want n=0, err=EOF", n, err)
+	}
+
+	n, err = f.ReadAt(buf, 0)
+	if n != 0 || err != io.EOF {
+		t.Errorf("ReadAt empty file: got n=%d, err=%v, want n=0, err=EOF", n, err)
+	}
+}
+
+func TestInterfaceCompliance(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "interface.txt")
+	f, err := OpenFile(path, os.O_RDWR|os.O_CREATE, 0644, 100)
+	if err != nil {
+		t.Fatalf("OpenFile failed: %v", err)
+	}
+	defer f.Close()
+
+	// Test that MmapFile can be used where these interfaces are expected
+	var _ io.Reader = f
 	var _ io.Writer = f
 	var _ io.Seeker = f
 	var _ io.ReaderAt = f
@@ -706,4 +1269,5479 @@ func TestInterfaceCompliance(t *testing.T) {
 	var _ io.WriterTo = f
 	var _ io.StringWriter = f
 	var _ io.ReadWriteSeeker = f
+	var _ io.RuneReader = f
+}
+
+func TestPrefetch(t *testing.T) {
+	f, err := Open("testdata/binary.dat")
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer f.Close()
+
+	t.Run("whole file", func(t *testing.T) {
+		if err := f.Prefetch(0, int64(f.Len())); err != nil {
+			t.Errorf("Prefetch failed: %v", err)
+		}
+	})
+
+	t.Run("unaligned range", func(t *testing.T) {
+		if err := f.Prefetch(3, 5); err != nil {
+			t.Errorf("Prefetch failed: %v", err)
+		}
+	})
+
+	t.Run("range past EOF", func(t *testing.T) {
+		if err := f.Prefetch(int64(f.Len()+10), 100); err != nil {
+			t.Errorf("Prefetch past EOF failed: %v", err)
+		}
+	})
+
+	t.Run("negative offset", func(t *testing.T) {
+		err := f.Prefetch(-1, 10)
+		if !errors.Is(err, ErrNegativeOffset) {
+			t.Errorf("Prefetch with negative offset: got %v, want ErrNegativeOffset", err)
+		}
+	})
+
+	t.Run("after close", func(t *testing.T) {
+		f, err := Open("testdata/binary.dat")
+		if err != nil {
+			t.Fatalf("Open failed: %v", err)
+		}
+		f.Close()
+
+		if err := f.Prefetch(0, 10); !errors.Is(err, ErrClosed) {
+			t.Errorf("Prefetch after close: got %v, want ErrClosed", err)
+		}
+	})
+}
+
+func TestFlushAndEvict(t *testing.T) {
+	pageSize := PageSize()
+	path := filepath.Join(t.TempDir(), "evict.bin")
+
+	f, err := OpenFile(path, os.O_RDWR|os.O_CREATE, 0644, int64(4*pageSize))
+	if err != nil {
+		t.Fatalf("OpenFile failed: %v", err)
+	}
+	defer f.Close()
+
+	want := make([]byte, f.Len())
+	for i := range want {
+		want[i] = byte(i % 251)
+	}
+	if _, err := f.WriteAt(want, 0); err != nil {
+		t.Fatalf("WriteAt failed: %v", err)
+	}
+
+	t.Run("whole file", func(t *testing.T) {
+		if err := f.FlushAndEvict(0, int64(f.Len())); err != nil {
+			t.Fatalf("FlushAndEvict failed: %v", err)
+		}
+
+		onDisk, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatalf("ReadFile failed: %v", err)
+		}
+		if !bytes.Equal(onDisk, want) {
+			t.Error("file contents differ after FlushAndEvict")
+		}
+
+		// the dropped pages are faulted in again from the file
+		got := make([]byte, f.Len())
+		if _, err := f.ReadAt(got, 0); err != nil {
+			t.Fatalf("ReadAt failed: %v", err)
+		}
+		if !bytes.Equal(got, want) {
+			t.Error("mapping contents differ after FlushAndEvict")
+		}
+	})
+
+	t.Run("unaligned range", func(t *testing.T) {
+		if _, err := f.WriteAt([]byte("evicted"), int64(pageSize)+3); err != nil {
+			t.Fatalf("WriteAt failed: %v", err)
+		}
+		copy(want[pageSize+3:], "evicted")
+
+		if err := f.FlushAndEvict(int64(pageSize)+3, 7); err != nil {
+			t.Fatalf("FlushAndEvict failed: %v", err)
+		}
+
+		onDisk, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatalf("ReadFile failed: %v", err)
+		}
+		if !bytes.Equal(onDisk, want) {
+			t.Error("file contents differ after FlushAndEvict")
+		}
+
+		got := make([]byte, 7)
+		if _, err := f.ReadAt(got, int64(pageSize)+3); err != nil {
+			t.Fatalf("ReadAt failed: %v", err)
+		}
+		if string(got) != "evicted" {
+			t.Errorf("ReadAt() = %q, want %q", got, "evicted")
+		}
+	})
+
+	t.Run("range past EOF", func(t *testing.T) {
+		if err := f.FlushAndEvict(int64(f.Len()+10), 100); err != nil {
+			t.Errorf("FlushAndEvict past EOF failed: %v", err)
+		}
+	})
+
+	t.Run("negative offset", func(t *testing.T) {
+		if err := f.FlushAndEvict(-1, 10); !errors.Is(err, ErrNegativeOffset) {
+			t.Errorf("FlushAndEvict with negative offset: got %v, want ErrNegativeOffset", err)
+		}
+	})
+
+	t.Run("read-only", func(t *testing.T) {
+		g, err := Open("testdata/binary.dat")
+		if err != nil {
+			t.Fatalf("Open failed: %v", err)
+		}
+		defer g.Close()
+
+		if err := g.FlushAndEvict(0, int64(g.Len())); err != nil {
+			t.Fatalf("FlushAndEvict failed: %v", err)
+		}
+		b := make([]byte, 4)
+		if _, err := g.ReadAt(b, 0); err != nil || string(b) != "ABCD" {
+			t.Errorf("ReadAt() = %q, %v after FlushAndEvict", b, err)
+		}
+	})
+
+	t.Run("after close", func(t *testing.T) {
+		g, err := Open("testdata/binary.dat")
+		if err != nil {
+			t.Fatalf("Open failed: %v", err)
+		}
+		g.Close()
+
+		if err := g.FlushAndEvict(0, 10); !errors.Is(err, ErrClosed) {
+			t.Errorf("FlushAndEvict after close: got %v, want ErrClosed", err)
+		}
+	})
+}
+
+func TestOpenFileWith(t *testing.T) {
+	t.Run("no options", func(t *testing.T) {
+		f, err := OpenFileWith("testdata/hello.txt", os.O_RDONLY, 0, 0)
+		if err != nil {
+			t.Fatalf("OpenFileWith failed: %v", err)
+		}
+		defer f.Close()
+
+		if f.Len() == 0 {
+			t.Error("Len() = 0, want > 0")
+		}
+	})
+
+	t.Run("WithPrivate", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "private.txt")
+		if err := os.WriteFile(path, []byte("original"), 0644); err != nil {
+			t.Fatalf("WriteFile failed: %v", err)
+		}
+
+		f, err := OpenFileWith(path, os.O_RDWR, 0644, 0, WithPrivate())
+		if err != nil {
+			t.Fatalf("OpenFileWith failed: %v", err)
+		}
+
+		if _, err := f.WriteAt([]byte("modified"), 0); err != nil {
+			t.Fatalf("WriteAt failed: %v", err)
+		}
+		if string(f.Bytes()) != "modified" {
+			t.Errorf("Bytes() = %q, want %q", f.Bytes(), "modified")
+		}
+		if err := f.Sync(); err != nil {
+			t.Errorf("Sync failed: %v", err)
+		}
+		if err := f.Close(); err != nil {
+			t.Fatalf("Close failed: %v", err)
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatalf("ReadFile failed: %v", err)
+		}
+		if string(data) != "original" {
+			t.Errorf("file content = %q, want %q", data, "original")
+		}
+	})
+
+	t.Run("WithPopulate", func(t *testing.T) {
+		f, err := OpenFileWith("testdata/binary.dat", os.O_RDONLY, 0, 0, WithPopulate())
+		if err != nil {
+			t.Fatalf("OpenFileWith failed: %v", err)
+		}
+		defer f.Close()
+
+		if !strings.HasPrefix(string(f.Bytes()), "ABCDEFGHIJ") {
+			t.Errorf("unexpected Bytes() content: %q", f.Bytes()[:min(10, f.Len())])
+		}
+	})
+
+	for _, tc := range []struct {
+		name string
+		opt  Option
+	}{
+		{"WithSequential", WithSequential()},
+		{"WithRandom", WithRandom()},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			f, err := OpenFileWith("testdata/binary.dat", os.O_RDONLY, 0, 0, tc.opt)
+			if err != nil {
+				t.Fatalf("OpenFileWith failed: %v", err)
+			}
+			defer f.Close()
+
+			var buf bytes.Buffer
+			if _, err := f.WriteTo(&buf); err != nil {
+				t.Fatalf("WriteTo failed: %v", err)
+			}
+			if !strings.HasPrefix(buf.String(), "ABCDEFGHIJ") {
+				t.Errorf("unexpected content: %q", buf.Bytes()[:min(10, buf.Len())])
+			}
+		})
+	}
+}
+
+func TestChmod(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Unix permission test")
+	}
+
+	path := filepath.Join(t.TempDir(), "chmod.txt")
+
+	f, err := OpenFile(path, os.O_RDWR|os.O_CREATE, 0644, 10)
+	if err != nil {
+		t.Fatalf("OpenFile failed: %v", err)
+	}
+	defer f.Close()
+
+	if err := f.Chmod(0600); err != nil {
+		t.Fatalf("Chmod failed: %v", err)
+	}
+
+	mode, err := f.Mode()
+	if err != nil {
+		t.Fatalf("Mode failed: %v", err)
+	}
+	if mode.Perm() != 0600 {
+		t.Errorf("Mode().Perm() = %v, want %v", mode.Perm(), os.FileMode(0600))
+	}
+
+	f.Close()
+
+	if err := f.Chmod(0644); !errors.Is(err, ErrClosed) {
+		t.Errorf("Chmod after close: got %v, want ErrClosed", err)
+	}
+	if _, err := f.Mode(); !errors.Is(err, ErrClosed) {
+		t.Errorf("Mode after close: got %v, want ErrClosed", err)
+	}
+}
+
+func TestChtimes(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "chtimes.txt")
+
+	f, err := OpenFile(path, os.O_RDWR|os.O_CREATE, 0644, 10)
+	if err != nil {
+		t.Fatalf("OpenFile failed: %v", err)
+	}
+	defer f.Close()
+
+	if _, err := f.WriteString("built"); err != nil {
+		t.Fatalf("WriteString failed: %v", err)
+	}
+	if err := f.Sync(); err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+
+	mtime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	if err := f.Chtimes(mtime, mtime); err != nil {
+		t.Fatalf("Chtimes failed: %v", err)
+	}
+
+	fi, err := f.Stat()
+	if err != nil {
+		t.Fatalf("Stat failed: %v", err)
+	}
+	if !fi.ModTime().Equal(mtime) {
+		t.Errorf("ModTime() = %v, want %v", fi.ModTime(), mtime)
+	}
+
+	f.Close()
+
+	if err := f.Chtimes(mtime, mtime); !errors.Is(err, ErrClosed) {
+		t.Errorf("Chtimes after close: got %v, want ErrClosed", err)
+	}
+}
+
+func TestReadRune(t *testing.T) {
+	f, err := Open("testdata/utf8.txt")
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer f.Close()
+
+	t.Run("decode all", func(t *testing.T) {
+		want := []rune("héllo, 世界! 🌍\n")
+
+		var got []rune
+		for {
+			r, size, err := f.ReadRune()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatalf("ReadRune failed: %v", err)
+			}
+			if size != utf8.RuneLen(r) {
+				t.Errorf("ReadRune size = %d, want %d for %q", size, utf8.RuneLen(r), r)
+			}
+			got = append(got, r)
+		}
+
+		if string(got) != string(want) {
+			t.Errorf("ReadRune got %q, want %q", string(got), string(want))
+		}
+	})
+
+	t.Run("at EOF", func(t *testing.T) {
+		f.Seek(0, io.SeekEnd)
+		r, size, err := f.ReadRune()
+		if r != 0 || size != 0 || err != io.EOF {
+			t.Errorf("ReadRune at EOF: got (%q, %d, %v), want (0, 0, EOF)", r, size, err)
+		}
+	})
+
+	t.Run("invalid sequence", func(t *testing.T) {
+		// Seek into the middle of the 2-byte 'é'.
+		f.Seek(2, io.SeekStart)
+		r, size, err := f.ReadRune()
+		if err != nil {
+			t.Fatalf("ReadRune failed: %v", err)
+		}
+		if r != utf8.RuneError || size != 1 {
+			t.Errorf("ReadRune got (%q, %d), want (RuneError, 1)", r, size)
+		}
+
+		pos, _ := f.Seek(0, io.SeekCurrent)
+		if pos != 3 {
+			t.Errorf("offset after invalid rune = %d, want 3", pos)
+		}
+	})
+}
+
+func TestScan(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "scan.txt")
+	if err := os.WriteFile(path, []byte("alpha beta\ngamma\n\ndelta epsilon"), 0644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+
+	f, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer f.Close()
+
+	scan := func(split bufio.SplitFunc) ([]string, error) {
+		var tokens []string
+		err := f.Scan(split, func(token []byte) bool {
+			tokens = append(tokens, string(token))
+			return true
+		})
+		return tokens, err
+	}
+
+	t.Run("lines", func(t *testing.T) {
+		got, err := scan(bufio.ScanLines)
+		if err != nil {
+			t.Fatalf("Scan failed: %v", err)
+		}
+		want := []string{"alpha beta", "gamma", "", "delta epsilon"}
+		if fmt.Sprint(got) != fmt.Sprint(want) {
+			t.Errorf("Scan lines = %q, want %q", got, want)
+		}
+	})
+
+	t.Run("words", func(t *testing.T) {
+		got, err := scan(bufio.ScanWords)
+		if err != nil {
+			t.Fatalf("Scan failed: %v", err)
+		}
+		want := []string{"alpha", "beta", "gamma", "delta", "epsilon"}
+		if fmt.Sprint(got) != fmt.Sprint(want) {
+			t.Errorf("Scan words = %q, want %q", got, want)
+		}
+	})
+
+	t.Run("tokens alias mapping", func(t *testing.T) {
+		var first []byte
+		f.Scan(bufio.ScanWords, func(token []byte) bool {
+			first = token
+			return false
+		})
+		if &first[0] != &f.Bytes()[0] {
+			t.Error("Scan token does not alias the mapping")
+		}
+	})
+
+	t.Run("stop early", func(t *testing.T) {
+		var n int
+		err := f.Scan(bufio.ScanWords, func(token []byte) bool {
+			n++
+			return n < 2
+		})
+		if err != nil {
+			t.Fatalf("Scan failed: %v", err)
+		}
+		if n != 2 {
+			t.Errorf("yield called %d times, want 2", n)
+		}
+	})
+
+	t.Run("final token", func(t *testing.T) {
+		split := func(data []byte, atEOF bool) (int, []byte, error) {
+			return 0, data[:5], bufio.ErrFinalToken
+		}
+		got, err := scan(split)
+		if err != nil {
+			t.Fatalf("Scan failed: %v", err)
+		}
+		if len(got) != 1 || got[0] != "alpha" {
+			t.Errorf("Scan final token = %q, want [alpha]", got)
+		}
+	})
+
+	t.Run("split error", func(t *testing.T) {
+		errSplit := errors.New("split failed")
+		split := func(data []byte, atEOF bool) (int, []byte, error) {
+			return 0, nil, errSplit
+		}
+		if _, err := scan(split); !errors.Is(err, errSplit) {
+			t.Errorf("Scan with failing split: got %v, want %v", err, errSplit)
+		}
+	})
+
+	t.Run("after close", func(t *testing.T) {
+		f, err := Open(path)
+		if err != nil {
+			t.Fatalf("Open failed: %v", err)
+		}
+		f.Close()
+
+		err = f.Scan(bufio.ScanLines, func([]byte) bool { return true })
+		if !errors.Is(err, ErrClosed) {
+			t.Errorf("Scan after close: got %v, want ErrClosed", err)
+		}
+	})
+}
+
+func TestWriteOnly(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "writeonly.txt")
+
+	f, err := OpenFile(path, os.O_WRONLY|os.O_CREATE, 0644, 10)
+	if err != nil {
+		t.Fatalf("OpenFile failed: %v", err)
+	}
+	defer f.Close()
+
+	if _, err := f.Write([]byte("hello")); err != nil {
+		t.Errorf("Write failed: %v", err)
+	}
+	if _, err := f.WriteAt([]byte("world"), 5); err != nil {
+		t.Errorf("WriteAt failed: %v", err)
+	}
+
+	buf := make([]byte, 5)
+	if _, err := f.Read(buf); !errors.Is(err, ErrWriteOnly) {
+		t.Errorf("Read on write-only file: got %v, want ErrWriteOnly", err)
+	}
+	if _, err := f.ReadAt(buf, 0); !errors.Is(err, ErrWriteOnly) {
+		t.Errorf("ReadAt on write-only file: got %v, want ErrWriteOnly", err)
+	}
+	if _, _, err := f.ReadRune(); !errors.Is(err, ErrWriteOnly) {
+		t.Errorf("ReadRune on write-only file: got %v, want ErrWriteOnly", err)
+	}
+	if _, err := f.WriteTo(io.Discard); !errors.Is(err, ErrWriteOnly) {
+		t.Errorf("WriteTo on write-only file: got %v, want ErrWriteOnly", err)
+	}
+
+	f.Close()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("ReadFile failed: %v", err)
+	}
+	if string(data) != "helloworld" {
+		t.Errorf("file content = %q, want %q", data, "helloworld")
+	}
+}
+
+func TestSyncMeta(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "syncmeta.txt")
+
+	f, err := OpenFile(path, os.O_RDWR|os.O_CREATE, 0644, 100)
+	if err != nil {
+		t.Fatalf("OpenFile failed: %v", err)
+	}
+	defer f.Close()
+
+	f.WriteString("Hello, SyncMeta!")
+
+	if err := f.SyncMeta(); err != nil {
+		t.Errorf("SyncMeta failed: %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("ReadFile failed: %v", err)
+	}
+	if !strings.HasPrefix(string(data), "Hello, SyncMeta!") {
+		t.Errorf("after SyncMeta, got %q, want prefix %q", data[:16], "Hello, SyncMeta!")
+	}
+
+	t.Run("read-only is a no-op", func(t *testing.T) {
+		f, err := Open("testdata/hello.txt")
+		if err != nil {
+			t.Fatalf("Open failed: %v", err)
+		}
+		defer f.Close()
+
+		if err := f.SyncMeta(); err != nil {
+			t.Errorf("SyncMeta on read-only file failed: %v", err)
+		}
+	})
+
+	t.Run("after close", func(t *testing.T) {
+		f.Close()
+		if err := f.SyncMeta(); !errors.Is(err, ErrClosed) {
+			t.Errorf("SyncMeta after close: got %v, want ErrClosed", err)
+		}
+	})
+}
+
+func TestAddressSpaceExhausted(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "large.bin")
+	if err := os.WriteFile(path, make([]byte, 64), 0644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+
+	// Simulate a platform whose address space cannot hold the file.
+	oldMaxInt := maxInt
+	maxInt = 32
+	t.Cleanup(func() { maxInt = oldMaxInt })
+
+	t.Run("open", func(t *testing.T) {
+		f, err := Open(path)
+		if err == nil {
+			f.Close()
+			t.Fatal("Open should fail")
+		}
+		if !errors.Is(err, ErrAddressSpaceExhausted) {
+			t.Errorf("Open: got %v, want ErrAddressSpaceExhausted", err)
+		}
+	})
+
+	t.Run("refresh", func(t *testing.T) {
+		maxInt = oldMaxInt
+		f, err := OpenFileAt(path, os.O_RDONLY, 0, 0, 16)
+		if err != nil {
+			t.Fatalf("OpenFileAt failed: %v", err)
+		}
+		defer f.Close()
+		maxInt = 32
+
+		if _, err := f.Refresh(); !errors.Is(err, ErrAddressSpaceExhausted) {
+			t.Errorf("Refresh: got %v, want ErrAddressSpaceExhausted", err)
+		}
+	})
+}
+
+func TestOffsetTooLarge(t *testing.T) {
+	// Simulate a platform with a 32-bit int.
+	oldMaxInt := maxInt
+	maxInt = math.MaxInt32
+	t.Cleanup(func() { maxInt = oldMaxInt })
+
+	path := filepath.Join(t.TempDir(), "offset.txt")
+
+	f, err := OpenFile(path, os.O_RDWR|os.O_CREATE, 0644, 10)
+	if err != nil {
+		t.Fatalf("OpenFile failed: %v", err)
+	}
+	defer f.Close()
+
+	buf := make([]byte, 1)
+
+	t.Run("ReadAt", func(t *testing.T) {
+		if _, err := f.ReadAt(buf, math.MaxInt32+1); !errors.Is(err, ErrOffsetTooLarge) {
+			t.Errorf("ReadAt past maxInt: got %v, want ErrOffsetTooLarge", err)
+		}
+		if _, err := f.ReadAt(buf, math.MaxInt32); err != io.EOF {
+			t.Errorf("ReadAt at maxInt: got %v, want io.EOF", err)
+		}
+	})
+
+	t.Run("WriteAt", func(t *testing.T) {
+		if _, err := f.WriteAt(buf, math.MaxInt32+1); !errors.Is(err, ErrOffsetTooLarge) {
+			t.Errorf("WriteAt past maxInt: got %v, want ErrOffsetTooLarge", err)
+		}
+		if _, err := f.WriteAt(buf, math.MaxInt32); !errors.Is(err, ErrWriteOutOfBounds) {
+			t.Errorf("WriteAt at maxInt: got %v, want ErrWriteOutOfBounds", err)
+		}
+	})
+}
+
+func TestResident(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "resident.dat")
+	size := 4*os.Getpagesize() + 1
+
+	f, err := OpenFile(path, os.O_RDWR|os.O_CREATE, 0644, int64(size))
+	if err != nil {
+		t.Fatalf("OpenFile failed: %v", err)
+	}
+	defer f.Close()
+
+	// Touch the first page so that it is resident.
+	f.WriteAt([]byte("x"), 0)
+
+	pages, err := f.Resident()
+	if errors.Is(err, ErrUnsupported) {
+		t.Skipf("Resident not supported: %v", err)
+	}
+	if err != nil {
+		t.Fatalf("Resident failed: %v", err)
+	}
+
+	if len(pages) != 5 {
+		t.Errorf("Resident returned %d pages, want 5", len(pages))
+	}
+	if len(pages) > 0 && !pages[0] {
+		t.Error("first page should be resident after write")
+	}
+
+	f.Close()
+	if _, err := f.Resident(); !errors.Is(err, ErrClosed) {
+		t.Errorf("Resident after close: got %v, want ErrClosed", err)
+	}
+}
+
+func TestReadAtv(t *testing.T) {
+	f, err := Open("testdata/binary.dat")
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer f.Close()
+
+	t.Run("multiple buffers", func(t *testing.T) {
+		bufs := [][]byte{make([]byte, 3), nil, make([]byte, 4)}
+		n, err := f.ReadAtv(bufs, 2)
+		if err != nil {
+			t.Errorf("ReadAtv failed: %v", err)
+		}
+		if n != 7 {
+			t.Errorf("ReadAtv read %d bytes, want 7", n)
+		}
+		if string(bufs[0]) != "CDE" || string(bufs[2]) != "FGHI" {
+			t.Errorf("ReadAtv got %q, %q, want %q, %q", bufs[0], bufs[2], "CDE", "FGHI")
+		}
+	})
+
+	t.Run("exhausted mid-vector", func(t *testing.T) {
+		size := f.Len()
+		bufs := [][]byte{make([]byte, 2), make([]byte, 4), make([]byte, 4)}
+		n, err := f.ReadAtv(bufs, int64(size-3))
+		if err != io.EOF {
+			t.Errorf("ReadAtv past EOF: got %v, want io.EOF", err)
+		}
+		if n != 3 {
+			t.Errorf("ReadAtv read %d bytes, want 3", n)
+		}
+	})
+
+	t.Run("negative offset", func(t *testing.T) {
+		_, err := f.ReadAtv([][]byte{make([]byte, 1)}, -1)
+		if !errors.Is(err, ErrNegativeOffset) {
+			t.Errorf("ReadAtv with negative offset: got %v, want ErrNegativeOffset", err)
+		}
+	})
+}
+
+func TestWriteAtv(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "writeatv.txt")
+
+	f, err := OpenFile(path, os.O_RDWR|os.O_CREATE, 0644, 10)
+	if err != nil {
+		t.Fatalf("OpenFile failed: %v", err)
+	}
+	defer f.Close()
+
+	t.Run("multiple buffers", func(t *testing.T) {
+		n, err := f.WriteAtv([][]byte{[]byte("abc"), []byte("defg")}, 1)
+		if err != nil {
+			t.Errorf("WriteAtv failed: %v", err)
+		}
+		if n != 7 {
+			t.Errorf("WriteAtv wrote %d bytes, want 7", n)
+		}
+		if string(f.Bytes()[1:8]) != "abcdefg" {
+			t.Errorf("WriteAtv content = %q, want %q", f.Bytes()[1:8], "abcdefg")
+		}
+	})
+
+	t.Run("exhausted mid-vector", func(t *testing.T) {
+		n, err := f.WriteAtv([][]byte{[]byte("xy"), []byte("zzzz")}, 6)
+		if !errors.Is(err, ErrWriteOutOfBounds) {
+			t.Errorf("WriteAtv past end: got %v, want ErrWriteOutOfBounds", err)
+		}
+		if n != 4 {
+			t.Errorf("WriteAtv wrote %d bytes, want 4", n)
+		}
+	})
+
+	t.Run("read-only", func(t *testing.T) {
+		f, err := Open("testdata/hello.txt")
+		if err != nil {
+			t.Fatalf("Open failed: %v", err)
+		}
+		defer f.Close()
+
+		_, err = f.WriteAtv([][]byte{[]byte("x")}, 0)
+		if !errors.Is(err, ErrReadOnly) {
+			t.Errorf("WriteAtv on read-only file: got %v, want ErrReadOnly", err)
+		}
+	})
+}
+
+func TestSnapshotTo(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "source.txt")
+
+	f, err := OpenFile(path, os.O_RDWR|os.O_CREATE, 0644, 12)
+	if err != nil {
+		t.Fatalf("OpenFile failed: %v", err)
+	}
+	defer f.Close()
+
+	f.WriteString("checkpoint-1")
+
+	snap := filepath.Join(dir, "snapshot.txt")
+	if err := f.SnapshotTo(snap, 0600); err != nil {
+		t.Fatalf("SnapshotTo failed: %v", err)
+	}
+
+	// Later writes must not affect the snapshot.
+	f.WriteAt([]byte("2"), 11)
+
+	data, err := os.ReadFile(snap)
+	if err != nil {
+		t.Fatalf("ReadFile failed: %v", err)
+	}
+	if string(data) != "checkpoint-1" {
+		t.Errorf("snapshot content = %q, want %q", data, "checkpoint-1")
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("ReadDir failed: %v", err)
+	}
+	if len(entries) != 2 {
+		t.Errorf("directory has %d entries, want 2 (no leftover temp files)", len(entries))
+	}
+
+	t.Run("missing directory", func(t *testing.T) {
+		err := f.SnapshotTo(filepath.Join(dir, "missing", "snapshot.txt"), 0600)
+		if err == nil {
+			t.Error("SnapshotTo should fail for a missing directory")
+		}
+	})
+
+	t.Run("after close", func(t *testing.T) {
+		f.Close()
+		if err := f.SnapshotTo(snap, 0600); !errors.Is(err, ErrClosed) {
+			t.Errorf("SnapshotTo after close: got %v, want ErrClosed", err)
+		}
+	})
+}
+
+func TestSetReadOnly(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "readonly.txt")
+
+	f, err := OpenFile(path, os.O_RDWR|os.O_CREATE, 0644, 10)
+	if err != nil {
+		t.Fatalf("OpenFile failed: %v", err)
+	}
+	defer f.Close()
+
+	if f.ReadOnly() {
+		t.Error("ReadOnly() = true for a writable file")
+	}
+
+	f.WriteString("init")
+
+	if err := f.SetReadOnly(); err != nil {
+		t.Fatalf("SetReadOnly failed: %v", err)
+	}
+	if !f.ReadOnly() {
+		t.Error("ReadOnly() = false after SetReadOnly")
+	}
+
+	if _, err := f.Write([]byte("x")); !errors.Is(err, ErrReadOnly) {
+		t.Errorf("Write after SetReadOnly: got %v, want ErrReadOnly", err)
+	}
+	if _, err := f.WriteAt([]byte("x"), 0); !errors.Is(err, ErrReadOnly) {
+		t.Errorf("WriteAt after SetReadOnly: got %v, want ErrReadOnly", err)
+	}
+
+	// Data written before the downgrade is still readable.
+	buf := make([]byte, 4)
+	if _, err := f.ReadAt(buf, 0); err != nil {
+		t.Fatalf("ReadAt failed: %v", err)
+	}
+	if string(buf) != "init" {
+		t.Errorf("ReadAt got %q, want %q", buf, "init")
+	}
+
+	if err := f.SetReadOnly(); err != nil {
+		t.Errorf("second SetReadOnly failed: %v", err)
+	}
+
+	f.Close()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("ReadFile failed: %v", err)
+	}
+	if !strings.HasPrefix(string(data), "init") {
+		t.Errorf("file content = %q, want prefix %q", data, "init")
+	}
+
+	if err := f.SetReadOnly(); !errors.Is(err, ErrClosed) {
+		t.Errorf("SetReadOnly after close: got %v, want ErrClosed", err)
+	}
+}
+
+func TestDirtyTracking(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dirty.txt")
+
+	f, err := OpenFile(path, os.O_RDWR|os.O_CREATE, 0644, 10)
+	if err != nil {
+		t.Fatalf("OpenFile failed: %v", err)
+	}
+	defer f.Close()
+
+	if f.dirty.Load() {
+		t.Error("freshly opened file is dirty")
+	}
+
+	f.WriteString("hello")
+	if !f.dirty.Load() {
+		t.Error("file is not dirty after Write")
+	}
+
+	if err := f.Sync(); err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+	if f.dirty.Load() {
+		t.Error("file is dirty after Sync")
+	}
+
+	// Close after Sync must not write the file again.
+	past := time.Now().Add(-time.Hour).Truncate(time.Second)
+	if err := os.Chtimes(path, past, past); err != nil {
+		t.Fatalf("Chtimes failed: %v", err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	fi, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("Stat failed: %v", err)
+	}
+	if !fi.ModTime().Equal(past) {
+		t.Errorf("ModTime() = %v after Close, want %v (no write-back)", fi.ModTime(), past)
+	}
+
+	t.Run("WriteAt marks dirty", func(t *testing.T) {
+		f, err := OpenFile(path, os.O_RDWR, 0644, 0)
+		if err != nil {
+			t.Fatalf("OpenFile failed: %v", err)
+		}
+		defer f.Close()
+
+		f.WriteAt([]byte("x"), 0)
+		if !f.dirty.Load() {
+			t.Error("file is not dirty after WriteAt")
+		}
+	})
+
+	t.Run("Bytes marks writable dirty", func(t *testing.T) {
+		f, err := OpenFile(path, os.O_RDWR, 0644, 0)
+		if err != nil {
+			t.Fatalf("OpenFile failed: %v", err)
+		}
+		defer f.Close()
+
+		f.Bytes()
+		if !f.dirty.Load() {
+			t.Error("writable file is not dirty after Bytes")
+		}
+	})
+}
+
+func TestGeneration(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "generation.txt")
+
+	f, err := OpenFile(path, os.O_RDWR|os.O_CREATE, 0644, 10)
+	if err != nil {
+		t.Fatalf("OpenFile failed: %v", err)
+	}
+	defer f.Close()
+
+	gen := f.Generation()
+
+	// Plain I/O never remaps the file.
+	f.WriteString("hello")
+	f.Sync()
+	f.ReadAt(make([]byte, 5), 0)
+
+	if got := f.Generation(); got != gen {
+		t.Errorf("Generation() = %d after plain I/O, want %d", got, gen)
+	}
+}
+
+func TestMultiReaderAt(t *testing.T) {
+	dir := t.TempDir()
+
+	var files []*MmapFile
+	for i, content := range []string{"Hello, ", "", "mmap ", "world!"} {
+		path := filepath.Join(dir, fmt.Sprintf("shard%d.txt", i))
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("WriteFile failed: %v", err)
+		}
+
+		f, err := Open(path)
+		if err != nil {
+			t.Fatalf("Open failed: %v", err)
+		}
+		defer f.Close()
+
+		files = append(files, f)
+	}
+
+	mr := NewMultiReaderAt(files...)
+	const want = "Hello, mmap world!"
+
+	t.Run("whole stream", func(t *testing.T) {
+		buf := make([]byte, len(want))
+		n, err := mr.ReadAt(buf, 0)
+		if err != nil {
+			t.Errorf("ReadAt failed: %v", err)
+		}
+		if n != len(want) || string(buf) != want {
+			t.Errorf("ReadAt got %q, want %q", buf[:n], want)
+		}
+	})
+
+	t.Run("across boundary", func(t *testing.T) {
+		buf := make([]byte, 8)
+		n, err := mr.ReadAt(buf, 5)
+		if err != nil {
+			t.Errorf("ReadAt failed: %v", err)
+		}
+		if string(buf[:n]) != want[5:13] {
+			t.Errorf("ReadAt got %q, want %q", buf[:n], want[5:13])
+		}
+	})
+
+	t.Run("past end", func(t *testing.T) {
+		buf := make([]byte, 10)
+		n, err := mr.ReadAt(buf, int64(len(want)-3))
+		if err != io.EOF {
+			t.Errorf("ReadAt past end: got %v, want io.EOF", err)
+		}
+		if string(buf[:n]) != "ld!" {
+			t.Errorf("ReadAt got %q, want %q", buf[:n], "ld!")
+		}
+
+		n, err = mr.ReadAt(buf, int64(len(want)+10))
+		if n != 0 || err != io.EOF {
+			t.Errorf("ReadAt beyond end: got n=%d, err=%v, want n=0, err=EOF", n, err)
+		}
+	})
+
+	t.Run("negative offset", func(t *testing.T) {
+		_, err := mr.ReadAt(make([]byte, 1), -1)
+		if !errors.Is(err, ErrNegativeOffset) {
+			t.Errorf("ReadAt with negative offset: got %v, want ErrNegativeOffset", err)
+		}
+	})
+
+	t.Run("with io.SectionReader", func(t *testing.T) {
+		data, err := io.ReadAll(io.NewSectionReader(mr, 0, int64(len(want))))
+		if err != nil {
+			t.Fatalf("ReadAll failed: %v", err)
+		}
+		if string(data) != want {
+			t.Errorf("ReadAll got %q, want %q", data, want)
+		}
+	})
+
+	t.Run("member resized after construction", func(t *testing.T) {
+		a, err := OpenFile(filepath.Join(dir, "grow-a.txt"), os.O_RDWR|os.O_CREATE, 0644, 3)
+		if err != nil {
+			t.Fatalf("OpenFile failed: %v", err)
+		}
+		defer a.Close()
+		b, err := OpenFile(filepath.Join(dir, "grow-b.txt"), os.O_RDWR|os.O_CREATE, 0644, 3)
+		if err != nil {
+			t.Fatalf("OpenFile failed: %v", err)
+		}
+		defer b.Close()
+
+		if _, err := a.WriteAt([]byte("abc"), 0); err != nil {
+			t.Fatalf("WriteAt failed: %v", err)
+		}
+		if _, err := b.WriteAt([]byte("def"), 0); err != nil {
+			t.Fatalf("WriteAt failed: %v", err)
+		}
+
+		mr := NewMultiReaderAt(a, b)
+		if err := a.Grow(5); err != nil {
+			t.Fatalf("Grow failed: %v", err)
+		}
+
+		buf := make([]byte, 6)
+		n, err := mr.ReadAt(buf, 0)
+		if err != nil {
+			t.Errorf("ReadAt failed: %v", err)
+		}
+		if string(buf[:n]) != "abcdef" {
+			t.Errorf("ReadAt got %q, want %q", buf[:n], "abcdef")
+		}
+	})
+}
+
+func TestDoubleBuffer(t *testing.T) {
+	dir := t.TempDir()
+	frontPath := filepath.Join(dir, "front.bin")
+	backPath := filepath.Join(dir, "back.bin")
+
+	d, err := NewDoubleBuffer(frontPath, backPath, 16)
+	if err != nil {
+		t.Fatalf("NewDoubleBuffer failed: %v", err)
+	}
+	defer d.Close()
+
+	front, back := d.Front(), d.Back()
+	if front == back {
+		t.Fatal("Front and Back return the same file")
+	}
+	if front.Name() != frontPath || back.Name() != backPath {
+		t.Errorf("Front() = %q, Back() = %q, want %q, %q", front.Name(), back.Name(), frontPath, backPath)
+	}
+
+	// the producer fills the back buffer, which the consumer sees after Swap
+	if _, err := d.Back().WriteAt([]byte("batch 1"), 0); err != nil {
+		t.Fatalf("WriteAt failed: %v", err)
+	}
+	d.Swap()
+	if d.Front() != back || d.Back() != front {
+		t.Fatal("Swap did not exchange the buffers")
+	}
+	if got := string(d.Front().Bytes()[:7]); got != "batch 1" {
+		t.Errorf("Front() holds %q, want %q", got, "batch 1")
+	}
+
+	if _, err := d.Back().WriteAt([]byte("batch 2"), 0); err != nil {
+		t.Fatalf("WriteAt failed: %v", err)
+	}
+	d.Swap()
+	if d.Front() != front || d.Back() != back {
+		t.Fatal("a second Swap did not restore the buffers")
+	}
+	if got := string(d.Front().Bytes()[:7]); got != "batch 2" {
+		t.Errorf("Front() holds %q, want %q", got, "batch 2")
+	}
+
+	t.Run("concurrent swaps", func(t *testing.T) {
+		var wg sync.WaitGroup
+		for range 4 {
+			wg.Go(func() {
+				for range 100 {
+					d.Swap()
+					if d.Front() == d.Back() {
+						t.Error("Front and Back return the same file")
+						return
+					}
+				}
+			})
+		}
+		wg.Wait()
+	})
+
+	if err := d.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	if _, err := front.ReadAt(make([]byte, 1), 0); !errors.Is(err, ErrClosed) {
+		t.Errorf("ReadAt after Close: got %v, want ErrClosed", err)
+	}
+	if _, err := back.ReadAt(make([]byte, 1), 0); !errors.Is(err, ErrClosed) {
+		t.Errorf("ReadAt after Close: got %v, want ErrClosed", err)
+	}
+
+	t.Run("existing files of different sizes", func(t *testing.T) {
+		dir := t.TempDir()
+		frontPath := filepath.Join(dir, "front.bin")
+		backPath := filepath.Join(dir, "back.bin")
+		if err := os.WriteFile(frontPath, make([]byte, 64), 0644); err != nil {
+			t.Fatalf("WriteFile failed: %v", err)
+		}
+		if err := os.WriteFile(backPath, make([]byte, 32), 0644); err != nil {
+			t.Fatalf("WriteFile failed: %v", err)
+		}
+
+		if _, err := NewDoubleBuffer(frontPath, backPath, 64); !errors.Is(err, ErrSizeMismatch) {
+			t.Errorf("NewDoubleBuffer: got %v, want ErrSizeMismatch", err)
+		}
+	})
+}
+
+func TestFlush(t *testing.T) {
+	t.Run("writable", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "flush.txt")
+
+		f, err := OpenFile(path, os.O_RDWR|os.O_CREATE, 0644, 10)
+		if err != nil {
+			t.Fatalf("OpenFile failed: %v", err)
+		}
+		defer f.Close()
+
+		f.WriteString("flushed")
+		if err := f.Flush(); err != nil {
+			t.Fatalf("Flush failed: %v", err)
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatalf("ReadFile failed: %v", err)
+		}
+		if !strings.HasPrefix(string(data), "flushed") {
+			t.Errorf("file content = %q, want prefix %q", data, "flushed")
+		}
+	})
+
+	t.Run("read-only", func(t *testing.T) {
+		f, err := Open("testdata/hello.txt")
+		if err != nil {
+			t.Fatalf("Open failed: %v", err)
+		}
+		defer f.Close()
+
+		if err := f.Flush(); err != nil {
+			t.Errorf("Flush on read-only file: got %v, want nil", err)
+		}
+	})
+
+	t.Run("empty", func(t *testing.T) {
+		f, err := Open("testdata/empty.txt")
+		if err != nil {
+			t.Fatalf("Open failed: %v", err)
+		}
+		defer f.Close()
+
+		if err := f.Flush(); err != nil {
+			t.Errorf("Flush on empty file: got %v, want nil", err)
+		}
+	})
+
+	t.Run("closed", func(t *testing.T) {
+		f, err := Open("testdata/hello.txt")
+		if err != nil {
+			t.Fatalf("Open failed: %v", err)
+		}
+		f.Close()
+
+		if err := f.Flush(); !errors.Is(err, ErrClosed) {
+			t.Errorf("Flush after close: got %v, want ErrClosed", err)
+		}
+	})
+
+	t.Run("nil", func(t *testing.T) {
+		var f *MmapFile
+		if err := f.Flush(); !errors.Is(err, ErrClosed) {
+			t.Errorf("Flush on nil file: got %v, want ErrClosed", err)
+		}
+	})
+}
+
+func TestReadAtContext(t *testing.T) {
+	f, err := Open("testdata/binary.dat")
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer f.Close()
+
+	t.Run("completes", func(t *testing.T) {
+		buf := make([]byte, 5)
+		n, err := f.ReadAtContext(context.Background(), buf, 10)
+		if err != nil {
+			t.Errorf("ReadAtContext failed: %v", err)
+		}
+		if n != 5 || string(buf) != "KLMNO" {
+			t.Errorf("ReadAtContext got %q, want %q", buf[:n], "KLMNO")
+		}
+	})
+
+	t.Run("past EOF", func(t *testing.T) {
+		buf := make([]byte, 5)
+		_, err := f.ReadAtContext(context.Background(), buf, int64(f.Len()+1))
+		if err != io.EOF {
+			t.Errorf("ReadAtContext past EOF: got %v, want io.EOF", err)
+		}
+	})
+
+	t.Run("cancelled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		_, err := f.ReadAtContext(ctx, make([]byte, 5), 0)
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("ReadAtContext with cancelled context: got %v, want context.Canceled", err)
+		}
+	})
+
+	t.Run("deadline exceeded while blocked", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "blocked.txt")
+
+		f, err := OpenFile(path, os.O_RDWR|os.O_CREATE, 0644, 10)
+		if err != nil {
+			t.Fatalf("OpenFile failed: %v", err)
+		}
+		defer f.Close()
+
+		// Simulate a stalled read by holding the write lock.
+		f.mu.Lock()
+		defer f.mu.Unlock()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+
+		_, err = f.ReadAtContext(ctx, make([]byte, 5), 0)
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("ReadAtContext while blocked: got %v, want context.DeadlineExceeded", err)
+		}
+	})
+}
+
+func TestWriterAt(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "writerat.txt")
+
+	f, err := OpenFile(path, os.O_RDWR|os.O_CREATE, 0644, 20)
+	if err != nil {
+		t.Fatalf("OpenFile failed: %v", err)
+	}
+	defer f.Close()
+
+	t.Run("concurrent disjoint writers", func(t *testing.T) {
+		var wg sync.WaitGroup
+		for i := range 4 {
+			w := f.WriterAt(int64(i * 5))
+			wg.Go(func() {
+				for j := range 5 {
+					if _, err := w.Write([]byte{byte('a' + i)}); err != nil {
+						t.Errorf("Write %d failed: %v", j, err)
+					}
+				}
+			})
+		}
+		wg.Wait()
+
+		if string(f.Bytes()) != "aaaaabbbbbcccccddddd" {
+			t.Errorf("content = %q, want %q", f.Bytes(), "aaaaabbbbbcccccddddd")
+		}
+	})
+
+	t.Run("cursor unchanged", func(t *testing.T) {
+		f.Seek(3, io.SeekStart)
+		f.WriterAt(0).Write([]byte("x"))
+
+		pos, _ := f.Seek(0, io.SeekCurrent)
+		if pos != 3 {
+			t.Errorf("cursor = %d after WriterAt write, want 3", pos)
+		}
+	})
+
+	t.Run("end of file", func(t *testing.T) {
+		w := f.WriterAt(18)
+		n, err := w.Write([]byte("xyz"))
+		if !errors.Is(err, ErrWriteOutOfBounds) {
+			t.Errorf("Write past end: got %v, want ErrWriteOutOfBounds", err)
+		}
+		if n != 2 {
+			t.Errorf("Write wrote %d bytes, want 2", n)
+		}
+
+		if _, err := w.Write([]byte("x")); !errors.Is(err, ErrWriteOutOfBounds) {
+			t.Errorf("Write at end: got %v, want ErrWriteOutOfBounds", err)
+		}
+	})
+}
+
+func TestReaderAt(t *testing.T) {
+	f, err := Open("testdata/binary.dat")
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer f.Close()
+
+	r1 := f.ReaderAt(0)
+	r2 := f.ReaderAt(10)
+
+	buf := make([]byte, 3)
+	for i, want := range []struct{ r1, r2 string }{
+		{"ABC", "KLM"},
+		{"DEF", "NOP"},
+	} {
+		if _, err := io.ReadFull(r1, buf); err != nil {
+			t.Fatalf("r1 read %d failed: %v", i, err)
+		}
+		if string(buf) != want.r1 {
+			t.Errorf("r1 read %d = %q, want %q", i, buf, want.r1)
+		}
+
+		if _, err := io.ReadFull(r2, buf); err != nil {
+			t.Fatalf("r2 read %d failed: %v", i, err)
+		}
+		if string(buf) != want.r2 {
+			t.Errorf("r2 read %d = %q, want %q", i, buf, want.r2)
+		}
+	}
+
+	t.Run("cursor unchanged", func(t *testing.T) {
+		pos, _ := f.Seek(0, io.SeekCurrent)
+		if pos != 0 {
+			t.Errorf("cursor = %d after ReaderAt reads, want 0", pos)
+		}
+	})
+
+	t.Run("reads to EOF", func(t *testing.T) {
+		data, err := io.ReadAll(f.ReaderAt(int64(f.Len() - 4)))
+		if err != nil {
+			t.Fatalf("ReadAll failed: %v", err)
+		}
+		if string(data) != string(f.Bytes()[f.Len()-4:]) {
+			t.Errorf("ReadAll got %q, want %q", data, f.Bytes()[f.Len()-4:])
+		}
+	})
+}
+
+func TestSliceAt(t *testing.T) {
+	type record struct {
+		ID   int
+		Name string
+	}
+
+	path := filepath.Join(t.TempDir(), "slots.dat")
+	const slotSize = 64
+
+	f, err := OpenFile(path, os.O_RDWR|os.O_CREATE, 0644, 2*slotSize)
+	if err != nil {
+		t.Fatalf("OpenFile failed: %v", err)
+	}
+	defer f.Close()
+
+	records := []record{{1, "first"}, {2, "second"}}
+	for i, rec := range records {
+		w, err := f.SectionWriter(int64(i*slotSize), slotSize)
+		if err != nil {
+			t.Fatalf("SectionWriter failed: %v", err)
+		}
+		if err := gob.NewEncoder(w).Encode(rec); err != nil {
+			t.Fatalf("Encode failed: %v", err)
+		}
+	}
+
+	for i := len(records) - 1; i >= 0; i-- {
+		r, err := f.SliceAt(int64(i*slotSize), slotSize)
+		if err != nil {
+			t.Fatalf("SliceAt failed: %v", err)
+		}
+
+		var got record
+		if err := gob.NewDecoder(r).Decode(&got); err != nil {
+			t.Fatalf("Decode failed: %v", err)
+		}
+		if got != records[i] {
+			t.Errorf("slot %d = %+v, want %+v", i, got, records[i])
+		}
+	}
+
+	t.Run("writer stops at slot end", func(t *testing.T) {
+		w, err := f.SectionWriter(0, 4)
+		if err != nil {
+			t.Fatalf("SectionWriter failed: %v", err)
+		}
+
+		n, err := w.Write([]byte("overflow"))
+		if !errors.Is(err, ErrWriteOutOfBounds) {
+			t.Errorf("Write past slot: got %v, want ErrWriteOutOfBounds", err)
+		}
+		if n != 4 {
+			t.Errorf("Write wrote %d bytes, want 4", n)
+		}
+		if f.Bytes()[4] == 'f' {
+			t.Error("Write spilled past the slot")
+		}
+	})
+
+	t.Run("invalid ranges", func(t *testing.T) {
+		for _, tt := range []struct {
+			off, length int64
+			want        error
+		}{
+			{-1, 10, ErrNegativeOffset},
+			{0, -1, ErrNegativeOffset},
+			{slotSize, 2 * slotSize, ErrOutOfRange},
+			{3 * slotSize, 0, ErrOutOfRange},
+		} {
+			if _, err := f.SliceAt(tt.off, tt.length); !errors.Is(err, tt.want) {
+				t.Errorf("SliceAt(%d, %d): got %v, want %v", tt.off, tt.length, err, tt.want)
+			}
+			if _, err := f.SectionWriter(tt.off, tt.length); !errors.Is(err, tt.want) {
+				t.Errorf("SectionWriter(%d, %d): got %v, want %v", tt.off, tt.length, err, tt.want)
+			}
+		}
+	})
+}
+
+func TestBytesCopy(t *testing.T) {
+	f, err := Open("testdata/binary.dat")
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+
+	data := f.BytesCopy()
+	if !bytes.Equal(data, f.Bytes()) {
+		t.Errorf("BytesCopy() = %q, want %q", data, f.Bytes())
+	}
+	if len(data) > 0 && &data[0] == &f.Bytes()[0] {
+		t.Error("BytesCopy() aliases the mapping")
+	}
+
+	part, err := f.BytesCopyRange(2, 3)
+	if err != nil {
+		t.Fatalf("BytesCopyRange failed: %v", err)
+	}
+	if string(part) != "CDE" {
+		t.Errorf("BytesCopyRange(2, 3) = %q, want %q", part, "CDE")
+	}
+
+	if _, err := f.BytesCopyRange(int64(f.Len()-1), 2); !errors.Is(err, ErrOutOfRange) {
+		t.Errorf("BytesCopyRange past end: got %v, want ErrOutOfRange", err)
+	}
+	if _, err := f.BytesCopyRange(-1, 2); !errors.Is(err, ErrNegativeOffset) {
+		t.Errorf("BytesCopyRange with negative offset: got %v, want ErrNegativeOffset", err)
+	}
+
+	f.Close()
+
+	// The copies outlive the mapping.
+	if !strings.HasPrefix(string(data), "ABCDEFGHIJ") || string(part) != "CDE" {
+		t.Errorf("copies changed after Close: %q, %q", data[:min(10, len(data))], part)
+	}
+
+	if got := f.BytesCopy(); got != nil {
+		t.Errorf("BytesCopy() after close = %q, want nil", got)
+	}
+	if _, err := f.BytesCopyRange(0, 1); !errors.Is(err, ErrClosed) {
+		t.Errorf("BytesCopyRange after close: got %v, want ErrClosed", err)
+	}
+}
+
+func TestNewFromFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "fromfile.txt")
+	if err := os.WriteFile(path, []byte("from an open file"), 0644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+
+	t.Run("owned", func(t *testing.T) {
+		file, err := os.OpenFile(path, os.O_RDWR, 0)
+		if err != nil {
+			t.Fatalf("OpenFile failed: %v", err)
+		}
+
+		f, err := NewFromFile(file, true)
+		if err != nil {
+			t.Fatalf("NewFromFile failed: %v", err)
+		}
+
+		if f.Name() != path {
+			t.Errorf("Name() = %q, want %q", f.Name(), path)
+		}
+		if string(f.Bytes()) != "from an open file" {
+			t.Errorf("Bytes() = %q, want %q", f.Bytes(), "from an open file")
+		}
+		if _, err := f.WriteAt([]byte("FROM"), 0); err != nil {
+			t.Errorf("WriteAt failed: %v", err)
+		}
+
+		if err := f.Close(); err != nil {
+			t.Fatalf("Close failed: %v", err)
+		}
+		if _, err := file.Stat(); !errors.Is(err, os.ErrClosed) {
+			t.Errorf("file.Stat after Close: got %v, want os.ErrClosed", err)
+		}
+	})
+
+	t.Run("borrowed", func(t *testing.T) {
+		file, err := os.Open(path)
+		if err != nil {
+			t.Fatalf("Open failed: %v", err)
+		}
+		defer file.Close()
+
+		f, err := NewFromFile(file, false, WithBorrowedFd())
+		if err != nil {
+			t.Fatalf("NewFromFile failed: %v", err)
+		}
+
+		if string(f.Bytes()) != "FROM an open file" {
+			t.Errorf("Bytes() = %q, want %q", f.Bytes(), "FROM an open file")
+		}
+		if _, err := f.Write([]byte("x")); !errors.Is(err, ErrReadOnly) {
+			t.Errorf("Write on read-only mapping: got %v, want ErrReadOnly", err)
+		}
+
+		if err := f.Close(); err != nil {
+			t.Fatalf("Close failed: %v", err)
+		}
+		if _, err := file.Stat(); err != nil {
+			t.Errorf("borrowed file was closed: %v", err)
+		}
+	})
+
+	t.Run("closed file", func(t *testing.T) {
+		file, err := os.Open(path)
+		if err != nil {
+			t.Fatalf("Open failed: %v", err)
+		}
+		file.Close()
+
+		if _, err := NewFromFile(file, false); err == nil {
+			t.Error("NewFromFile should fail for a closed file")
+		}
+	})
+}
+
+// aferoFile mirrors the afero.File interface, as a representative file
+// system abstraction.
+type aferoFile interface {
+	io.Closer
+	io.Reader
+	io.ReaderAt
+	io.Seeker
+	io.Writer
+	io.WriterAt
+
+	Name() string
+	Readdir(count int) ([]os.FileInfo, error)
+	Readdirnames(n int) ([]string, error)
+	Stat() (os.FileInfo, error)
+	Sync() error
+	Truncate(size int64) error
+	WriteString(s string) (ret int, err error)
+}
+
+var _ aferoFile = File{}
+
+func TestAsFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "afero.txt")
+
+	mf, err := OpenFile(path, os.O_RDWR|os.O_CREATE, 0644, 16)
+	if err != nil {
+		t.Fatalf("OpenFile failed: %v", err)
+	}
+
+	var f aferoFile = mf.AsFile()
+	defer f.Close()
+
+	if f.Name() != path {
+		t.Errorf("Name() = %q, want %q", f.Name(), path)
+	}
+	if _, err := f.WriteString("hello"); err != nil {
+		t.Fatalf("WriteString failed: %v", err)
+	}
+	if err := f.Truncate(5); err != nil {
+		t.Fatalf("Truncate failed: %v", err)
+	}
+	if err := f.Sync(); err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+	if fi, err := f.Stat(); err != nil || fi.Size() != 5 {
+		t.Errorf("Stat() = %v, %v; want size 5", fi, err)
+	}
+
+	if _, err := f.Readdir(-1); !errors.Is(err, ErrUnsupported) {
+		t.Errorf("Readdir: got %v, want ErrUnsupported", err)
+	}
+	if _, err := f.Readdirnames(-1); !errors.Is(err, ErrUnsupported) {
+		t.Errorf("Readdirnames: got %v, want ErrUnsupported", err)
+	}
+}
+
+func TestReader(t *testing.T) {
+	f, err := Open("testdata/hello.txt")
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer f.Close()
+
+	want, err := os.ReadFile("testdata/hello.txt")
+	if err != nil {
+		t.Fatalf("ReadFile failed: %v", err)
+	}
+
+	r1, r2 := f.Reader(), f.Reader()
+	if r1.Size() != int64(len(want)) {
+		t.Errorf("Size() = %d, want %d", r1.Size(), len(want))
+	}
+
+	// readers and the file cursor progress independently
+	buf := make([]byte, 5)
+	r1.Read(buf)
+	f.Seek(3, io.SeekStart)
+	got, err := io.ReadAll(r2)
+	if err != nil || !bytes.Equal(got, want) {
+		t.Errorf("ReadAll(r2) = %q, %v; want %q", got, err, want)
+	}
+	got, err = io.ReadAll(r1)
+	if err != nil || !bytes.Equal(got, want[5:]) {
+		t.Errorf("ReadAll(r1) = %q, %v; want %q", got, err, want[5:])
+	}
+	if pos, _ := f.Seek(0, io.SeekCurrent); pos != 3 {
+		t.Errorf("file offset = %d, want 3", pos)
+	}
+
+	if pos, err := r1.Seek(-3, io.SeekEnd); err != nil || pos != int64(len(want))-3 {
+		t.Errorf("Seek(-3, SeekEnd) = %d, %v; want %d", pos, err, len(want)-3)
+	}
+	if _, err := r1.Seek(-1<<20, io.SeekCurrent); err != ErrNegativeOffset {
+		t.Errorf("Seek before start: got %v, want ErrNegativeOffset", err)
+	}
+	if _, err := r1.Seek(0, 42); err != ErrInvalidWhence {
+		t.Errorf("Seek with bad whence: got %v, want ErrInvalidWhence", err)
+	}
+	if _, err := r1.ReadAt(buf, 0); err != nil || !bytes.Equal(buf, want[:5]) {
+		t.Errorf("ReadAt = %q, %v; want %q", buf, err, want[:5])
+	}
+
+	f.Close()
+	if _, err := r1.Read(buf); err != ErrClosed {
+		t.Errorf("Read after Close: got %v, want ErrClosed", err)
+	}
+	if _, err := r1.Seek(0, io.SeekStart); err != ErrClosed {
+		t.Errorf("Seek after Close: got %v, want ErrClosed", err)
+	}
+}
+
+func TestOpenReadSeeker(t *testing.T) {
+	r, err := OpenReadSeeker("testdata/hello.txt")
+	if err != nil {
+		t.Fatalf("OpenReadSeeker failed: %v", err)
+	}
+	defer r.Close()
+
+	if _, ok := r.(io.Writer); ok {
+		t.Error("ReadOnlyFile implements io.Writer")
+	}
+	if _, ok := r.(io.WriterAt); ok {
+		t.Error("ReadOnlyFile implements io.WriterAt")
+	}
+	if _, ok := r.(*MmapFile); ok {
+		t.Error("ReadOnlyFile can be asserted to *MmapFile")
+	}
+
+	want, err := os.ReadFile("testdata/hello.txt")
+	if err != nil {
+		t.Fatalf("ReadFile failed: %v", err)
+	}
+	if r.Len() != len(want) {
+		t.Errorf("Len() = %d, want %d", r.Len(), len(want))
+	}
+	fi, err := r.Stat()
+	if err != nil || fi.Size() != int64(len(want)) {
+		t.Errorf("Stat() = %v, %v; want size %d", fi, err, len(want))
+	}
+
+	r.Seek(6, io.SeekStart)
+	got, err := io.ReadAll(r)
+	if err != nil || !bytes.Equal(got, want[6:]) {
+		t.Errorf("ReadAll after Seek = %q, %v; want %q", got, err, want[6:])
+	}
+
+	buf := make([]byte, 5)
+	if _, err := r.ReadAt(buf, 0); err != nil || !bytes.Equal(buf, want[:5]) {
+		t.Errorf("ReadAt = %q, %v; want %q", buf, err, want[:5])
+	}
+
+	var out bytes.Buffer
+	if _, err := io.Copy(&out, r); err != nil || !bytes.Equal(out.Bytes(), want) {
+		t.Errorf("io.Copy = %q, %v; want %q", out.Bytes(), err, want)
+	}
+
+	if _, err := OpenReadSeeker("testdata/nonexistent"); err == nil {
+		t.Error("OpenReadSeeker of a missing file succeeded")
+	}
+}
+
+func TestMutableBytes(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "mutable.txt")
+	if err := os.WriteFile(path, []byte("hello world"), 0644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+
+	f, err := OpenFileWith(path, os.O_RDWR, 0, 0, WithWriteThrough())
+	if err != nil {
+		t.Fatalf("OpenFileWith failed: %v", err)
+	}
+	defer f.Close()
+
+	b, mark, err := f.MutableBytes()
+	if err != nil {
+		t.Fatalf("MutableBytes failed: %v", err)
+	}
+	if f.dirty.Load() {
+		t.Error("MutableBytes marked the file as modified")
+	}
+
+	copy(b[6:], "WORLD")
+	mark(6, 5)
+	if !f.dirty.Load() {
+		t.Error("reporting a range did not mark the file as modified")
+	}
+
+	// with write-through, the reported range reaches the file right away,
+	// even on the fallback backend
+	got, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("ReadFile failed: %v", err)
+	}
+	if string(got) != "hello WORLD" {
+		t.Errorf("file holds %q, want %q", got, "hello WORLD")
+	}
+
+	// a range that ends before the start of the file is empty once clipped
+	f.dirty.Store(false)
+	mark(-5, 5)
+	if f.dirty.Load() {
+		t.Error("reporting [-5, 0) marked the file as modified")
+	}
+
+	// out-of-range reports are clipped or ignored
+	mark(-5, 1)
+	mark(8, math.MaxInt64)
+	mark(100, 1)
+
+	f.Close()
+	if _, _, err := f.MutableBytes(); err != ErrClosed {
+		t.Errorf("MutableBytes after Close: got %v, want ErrClosed", err)
+	}
+	mark(0, 1) // no-op once closed
+
+	t.Run("read-only", func(t *testing.T) {
+		ro, err := Open(path)
+		if err != nil {
+			t.Fatalf("Open failed: %v", err)
+		}
+		defer ro.Close()
+
+		if _, _, err := ro.MutableBytes(); err != ErrReadOnly {
+			t.Errorf("got %v, want ErrReadOnly", err)
+		}
+	})
+}
+
+func TestReadEOFBoundary(t *testing.T) {
+	f, err := Open("testdata/hello.txt")
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer f.Close()
+
+	size := f.Len()
+
+	tests := []struct {
+		name    string
+		off     int // where the read starts
+		bufLen  int
+		wantN   int
+		wantErr error
+		nextErr error // of the following Read
+	}{
+		{"ends one byte before EOF", 0, size - 1, size - 1, nil, nil},
+		{"ends exactly at EOF", 0, size, size, nil, io.EOF},
+		{"ends one byte after EOF", 0, size + 1, size, io.EOF, io.EOF},
+		{"last byte exactly", size - 1, 1, 1, nil, io.EOF},
+		{"last byte short", size - 1, 2, 1, io.EOF, io.EOF},
+		{"at EOF", size, 1, 0, io.EOF, io.EOF},
+		{"empty buffer at EOF", size, 0, 0, io.EOF, io.EOF},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf := make([]byte, tt.bufLen)
+
+			f.Seek(int64(tt.off), io.SeekStart)
+			n, err := f.Read(buf)
+			if n != tt.wantN || err != tt.wantErr {
+				t.Errorf("Read() = %d, %v; want %d, %v", n, err, tt.wantN, tt.wantErr)
+			}
+			if _, err := f.Read(make([]byte, 1)); err != tt.nextErr {
+				t.Errorf("next Read() error = %v, want %v", err, tt.nextErr)
+			}
+
+			n, err = f.ReadAt(buf, int64(tt.off))
+			if n != tt.wantN || err != tt.wantErr {
+				t.Errorf("ReadAt() = %d, %v; want %d, %v", n, err, tt.wantN, tt.wantErr)
+			}
+		})
+	}
+
+	t.Run("io.ReadFull", func(t *testing.T) {
+		f.Seek(0, io.SeekStart)
+		if n, err := io.ReadFull(f, make([]byte, size)); n != size || err != nil {
+			t.Errorf("ReadFull of the whole file = %d, %v; want %d, nil", n, err, size)
+		}
+
+		f.Seek(0, io.SeekStart)
+		if n, err := io.ReadFull(f, make([]byte, size+1)); n != size || err != io.ErrUnexpectedEOF {
+			t.Errorf("ReadFull past EOF = %d, %v; want %d, io.ErrUnexpectedEOF", n, err, size)
+		}
+	})
+}
+
+func TestStats(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "stats.txt")
+
+	f, err := OpenFile(path, os.O_RDWR|os.O_CREATE, 0644, 16)
+	if err != nil {
+		t.Fatalf("OpenFile failed: %v", err)
+	}
+	defer f.Close()
+
+	if got := f.Stats(); got != (Stats{}) {
+		t.Errorf("Stats() of a new file = %+v, want zero", got)
+	}
+
+	f.Write([]byte("hello"))
+	f.WriteString(" world")
+	f.WriteAt([]byte("!!"), 14)
+	f.WriteAtv([][]byte{[]byte("ab"), []byte("c")}, 11)
+	f.WriteAt([]byte("overflow"), 12) // writes 4 bytes
+
+	buf := make([]byte, 4)
+	f.Seek(0, io.SeekStart)
+	f.Read(buf)
+	f.ReadAt(buf, 14) // reads 2 bytes
+	f.ReadAtv([][]byte{buf[:1], buf[1:3]}, 0)
+	f.WriteTo(io.Discard)
+
+	if err := f.Sync(); err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+	if err := f.SyncMeta(); err != nil {
+		t.Fatalf("SyncMeta failed: %v", err)
+	}
+
+	want := Stats{
+		Reads:        4,
+		BytesRead:    4 + 2 + 3 + 16,
+		Writes:       5,
+		BytesWritten: 5 + 6 + 2 + 3 + 4,
+		Syncs:        2,
+	}
+	if got := f.Stats(); got != want {
+		t.Errorf("Stats() = %+v, want %+v", got, want)
+	}
+}
+
+func TestSnapshot(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "snapshot.txt")
+	if err := os.WriteFile(path, []byte("before"), 0644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+
+	f, err := OpenFile(path, os.O_RDWR, 0, 0)
+	if err != nil {
+		t.Fatalf("OpenFile failed: %v", err)
+	}
+	defer f.Close()
+
+	snap, err := f.Snapshot()
+	if err != nil {
+		t.Fatalf("Snapshot failed: %v", err)
+	}
+
+	if _, err := f.WriteAt([]byte("after!"), 0); err != nil {
+		t.Fatalf("WriteAt failed: %v", err)
+	}
+	if err := f.Truncate(3); err != nil {
+		t.Fatalf("Truncate failed: %v", err)
+	}
+
+	got, err := io.ReadAll(snap)
+	if err != nil {
+		t.Fatalf("ReadAll failed: %v", err)
+	}
+	if string(got) != "before" {
+		t.Errorf("snapshot reads %q, want %q", got, "before")
+	}
+
+	if _, err := snap.Seek(2, io.SeekStart); err != nil {
+		t.Fatalf("Seek failed: %v", err)
+	}
+	if got, _ := io.ReadAll(snap); string(got) != "fore" {
+		t.Errorf("snapshot reads %q after Seek, want %q", got, "fore")
+	}
+
+	f.Close()
+	if _, err := f.Snapshot(); err != ErrClosed {
+		t.Errorf("Snapshot after Close: got %v, want ErrClosed", err)
+	}
+}
+
+func TestAsSlice(t *testing.T) {
+	if binary.NativeEndian.Uint16([]byte{1, 0}) != 1 {
+		t.Skip("the test data is little-endian")
+	}
+
+	want := []float64{0, 1.5, -2.25, math.Pi, math.Inf(1)}
+	data := make([]byte, 0, 8*len(want))
+	for _, v := range want {
+		data = binary.LittleEndian.AppendUint64(data, math.Float64bits(v))
+	}
+
+	path := filepath.Join(t.TempDir(), "floats.bin")
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+
+	f, err := OpenFile(path, os.O_RDWR, 0, 0)
+	if err != nil {
+		t.Fatalf("OpenFile failed: %v", err)
+	}
+	defer f.Close()
+
+	got, err := AsSlice[float64](f)
+	if err != nil {
+		t.Fatalf("AsSlice failed: %v", err)
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("AsSlice() = %v, want %v", got, want)
+	}
+
+	// assigning to an element writes to the file
+	got[1] = 42
+	if v := math.Float64frombits(binary.LittleEndian.Uint64(f.Bytes()[8:])); v != 42 {
+		t.Errorf("mapping holds %v, want 42", v)
+	}
+
+	if _, err := AsSlice[[3]float64](f); err != ErrPartialRecord {
+		t.Errorf("AsSlice of a partial record: got %v, want ErrPartialRecord", err)
+	}
+	if _, err := AsSlice[struct{}](f); err != ErrUnsupported {
+		t.Errorf("AsSlice of a zero-size type: got %v, want ErrUnsupported", err)
+	}
+
+	t.Run("misaligned", func(t *testing.T) {
+		if !nativeMapping {
+			t.Skip("the fallback backend copies the region into an aligned buffer")
+		}
+
+		g, err := OpenFileAt(path, os.O_RDONLY, 0, 4, 16)
+		if err != nil {
+			t.Fatalf("OpenFileAt failed: %v", err)
+		}
+		defer g.Close()
+
+		if _, err := AsSlice[uint64](g); err != ErrMisaligned {
+			t.Errorf("got %v, want ErrMisaligned", err)
+		}
+	})
+}
+
+func TestAtomics(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "atomic.bin")
+
+	f, err := OpenFile(path, os.O_RDWR|os.O_CREATE, 0644, 64)
+	if err != nil {
+		t.Fatalf("OpenFile failed: %v", err)
+	}
+	defer f.Close()
+
+	var wg sync.WaitGroup
+	for range 8 {
+		wg.Go(func() {
+			for range 1000 {
+				if _, err := f.AddUint64(8, 1); err != nil {
+					t.Errorf("AddUint64 failed: %v", err)
+					return
+				}
+			}
+		})
+	}
+	wg.Wait()
+
+	if v, err := f.LoadUint64(8); err != nil || v != 8000 {
+		t.Errorf("LoadUint64() = %d, %v, want 8000", v, err)
+	}
+
+	if ok, err := f.CompareAndSwapUint64(8, 1, 2); err != nil || ok {
+		t.Errorf("CompareAndSwapUint64 with a stale old = %v, %v, want false", ok, err)
+	}
+	if ok, err := f.CompareAndSwapUint64(8, 8000, 42); err != nil || !ok {
+		t.Errorf("CompareAndSwapUint64 = %v, %v, want true", ok, err)
+	}
+	if got := binary.NativeEndian.Uint64(f.Bytes()[8:]); got != 42 {
+		t.Errorf("mapping holds %d, want 42", got)
+	}
+
+	if err := f.StoreUint32(4, 7); err != nil {
+		t.Fatalf("StoreUint32 failed: %v", err)
+	}
+	if v, err := f.AddUint32(4, 3); err != nil || v != 10 {
+		t.Errorf("AddUint32() = %d, %v, want 10", v, err)
+	}
+	if ok, err := f.CompareAndSwapUint32(4, 10, 11); err != nil || !ok {
+		t.Errorf("CompareAndSwapUint32 = %v, %v, want true", ok, err)
+	}
+	if v, err := f.LoadUint32(4); err != nil || v != 11 {
+		t.Errorf("LoadUint32() = %d, %v, want 11", v, err)
+	}
+
+	if _, err := f.LoadUint64(4); !errors.Is(err, ErrMisaligned) {
+		t.Errorf("LoadUint64 at 4: got %v, want ErrMisaligned", err)
+	}
+	if err := f.StoreUint32(6, 1); !errors.Is(err, ErrMisaligned) {
+		t.Errorf("StoreUint32 at 6: got %v, want ErrMisaligned", err)
+	}
+	if _, err := f.LoadUint64(64); !errors.Is(err, ErrOutOfRange) {
+		t.Errorf("LoadUint64 at the end: got %v, want ErrOutOfRange", err)
+	}
+	if _, err := f.AddUint64(-8, 1); !errors.Is(err, ErrNegativeOffset) {
+		t.Errorf("AddUint64 at -8: got %v, want ErrNegativeOffset", err)
+	}
+
+	t.Run("read-only", func(t *testing.T) {
+		f.Sync()
+
+		ro, err := Open(path)
+		if err != nil {
+			t.Fatalf("Open failed: %v", err)
+		}
+		defer ro.Close()
+
+		if v, err := ro.LoadUint64(8); err != nil || v != 42 {
+			t.Errorf("LoadUint64() = %d, %v, want 42", v, err)
+		}
+		if err := ro.StoreUint64(8, 1); err != ErrReadOnly {
+			t.Errorf("StoreUint64: got %v, want ErrReadOnly", err)
+		}
+	})
+}
+
+func TestOpenReadOnly(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "readonly.txt")
+	if err := os.WriteFile(path, []byte("keep me"), 0644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+
+	f, err := OpenReadOnly(path)
+	if err != nil {
+		t.Fatalf("OpenReadOnly failed: %v", err)
+	}
+	defer f.Close()
+
+	if !f.ReadOnly() {
+		t.Error("ReadOnly() = false, want true")
+	}
+	if _, err := f.Write([]byte("x")); err != ErrReadOnly {
+		t.Errorf("Write: got %v, want ErrReadOnly", err)
+	}
+	if _, err := f.WriteAt([]byte("x"), 0); err != ErrReadOnly {
+		t.Errorf("WriteAt: got %v, want ErrReadOnly", err)
+	}
+	if _, err := f.ReadFrom(strings.NewReader("x")); err != ErrReadOnly {
+		t.Errorf("ReadFrom: got %v, want ErrReadOnly", err)
+	}
+	if err := f.Sync(); err != nil {
+		t.Errorf("Sync: got %v, want nil", err)
+	}
+	if string(f.Bytes()) != "keep me" {
+		t.Errorf("Bytes() = %q, want %q", f.Bytes(), "keep me")
+	}
+
+	if _, err := OpenReadOnly(filepath.Join(t.TempDir(), "missing.txt")); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("OpenReadOnly of a missing file: got %v, want fs.ErrNotExist", err)
+	}
+}
+
+func TestOpenLimited(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "limited.bin")
+	if err := os.WriteFile(path, make([]byte, 4096), 0644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+
+	f, err := OpenLimited(path, 4096)
+	if err != nil {
+		t.Fatalf("OpenLimited at the limit failed: %v", err)
+	}
+	if f.Len() != 4096 {
+		t.Errorf("Len() = %d, want 4096", f.Len())
+	}
+	f.Close()
+
+	if _, err := OpenLimited(path, 4095); !errors.Is(err, ErrFileTooLarge) {
+		t.Errorf("OpenLimited above the limit: got %v, want ErrFileTooLarge", err)
+	}
+
+	t.Run("option", func(t *testing.T) {
+		if _, err := OpenFileWith(path, os.O_RDWR, 0, 0, WithMaxSize(1024)); !errors.Is(err, ErrFileTooLarge) {
+			t.Errorf("OpenFileWith: got %v, want ErrFileTooLarge", err)
+		}
+
+		file, err := os.Open(path)
+		if err != nil {
+			t.Fatalf("Open failed: %v", err)
+		}
+		defer file.Close()
+
+		if _, err := NewFromFile(file, false, WithMaxSize(1024), WithBorrowedFd()); !errors.Is(err, ErrFileTooLarge) {
+			t.Errorf("NewFromFile: got %v, want ErrFileTooLarge", err)
+		}
+	})
+
+	t.Run("checked before resizing", func(t *testing.T) {
+		small := filepath.Join(t.TempDir(), "small.bin")
+		if err := os.WriteFile(small, []byte("hello"), 0644); err != nil {
+			t.Fatalf("WriteFile failed: %v", err)
+		}
+
+		_, err := OpenFileWith(small, os.O_RDWR|os.O_TRUNC, 0644, 1<<30, WithMaxSize(10))
+		if !errors.Is(err, ErrFileTooLarge) {
+			t.Errorf("OpenFileWith with O_TRUNC: got %v, want ErrFileTooLarge", err)
+		}
+
+		got, err := os.ReadFile(small)
+		if err != nil {
+			t.Fatalf("ReadFile failed: %v", err)
+		}
+		if string(got) != "hello" {
+			t.Errorf("file holds %d bytes after the error, want it unchanged", len(got))
+		}
+	})
+}
+
+func TestWithExactSize(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "exact.bin")
+
+	f, err := OpenFileWith(path, os.O_RDWR|os.O_CREATE, 0644, 100, WithExactSize(100))
+	if err != nil {
+		t.Fatalf("OpenFileWith create failed: %v", err)
+	}
+	if f.Len() != 100 {
+		t.Errorf("Len() = %d, want 100", f.Len())
+	}
+	f.Close()
+
+	t.Run("mismatch", func(t *testing.T) {
+		// O_CREATE on an existing non-empty file ignores size
+		_, err := OpenFileWith(path, os.O_RDWR|os.O_CREATE, 0644, 200, WithExactSize(200))
+		if !errors.Is(err, ErrSizeMismatch) {
+			t.Errorf("got %v, want ErrSizeMismatch", err)
+		}
+	})
+
+	t.Run("mismatch leaves the file system alone", func(t *testing.T) {
+		created := filepath.Join(t.TempDir(), "created.bin")
+		if _, err := OpenFileWith(created, os.O_RDWR|os.O_CREATE, 0644, 100, WithExactSize(50)); !errors.Is(err, ErrSizeMismatch) {
+			t.Errorf("OpenFileWith with O_CREATE: got %v, want ErrSizeMismatch", err)
+		}
+		if _, err := os.Stat(created); !errors.Is(err, fs.ErrNotExist) {
+			t.Errorf("Stat of the rejected file: got %v, want fs.ErrNotExist", err)
+		}
+
+		if _, err := OpenFileWith(path, os.O_RDWR|os.O_TRUNC, 0, 50, WithExactSize(60)); !errors.Is(err, ErrSizeMismatch) {
+			t.Errorf("OpenFileWith with O_TRUNC: got %v, want ErrSizeMismatch", err)
+		}
+		if fi, err := os.Stat(path); err != nil || fi.Size() != 100 {
+			t.Errorf("Stat after the rejected O_TRUNC = %v, %v, want 100 bytes", fi, err)
+		}
+	})
+
+	t.Run("match", func(t *testing.T) {
+		f, err := OpenFileWith(path, os.O_RDONLY, 0, 0, WithExactSize(100))
+		if err != nil {
+			t.Fatalf("OpenFileWith failed: %v", err)
+		}
+		f.Close()
+	})
+
+	t.Run("truncate", func(t *testing.T) {
+		f, err := OpenFileWith(path, os.O_RDWR|os.O_TRUNC, 0, 300, WithExactSize(300))
+		if err != nil {
+			t.Fatalf("OpenFileWith with O_TRUNC failed: %v", err)
+		}
+		f.Close()
+	})
+
+	t.Run("empty", func(t *testing.T) {
+		empty := filepath.Join(t.TempDir(), "empty.bin")
+		if err := os.WriteFile(empty, nil, 0644); err != nil {
+			t.Fatalf("WriteFile failed: %v", err)
+		}
+
+		f, err := OpenFileWith(empty, os.O_RDONLY, 0, 0, WithExactSize(0))
+		if err != nil {
+			t.Fatalf("OpenFileWith failed: %v", err)
+		}
+		f.Close()
+
+		if _, err := OpenFileWith(empty, os.O_RDONLY, 0, 0, WithExactSize(1)); !errors.Is(err, ErrSizeMismatch) {
+			t.Errorf("got %v, want ErrSizeMismatch", err)
+		}
+	})
+}
+
+func TestWithCloseChecksum(t *testing.T) {
+	// the header is an 8-byte payload followed by its CRC-32
+	errCorrupt := errors.New("header checksum mismatch")
+	verify := func(b []byte) error {
+		if crc32.ChecksumIEEE(b[:8]) != binary.LittleEndian.Uint32(b[8:]) {
+			return errCorrupt
+		}
+		return nil
+	}
+
+	header := binary.LittleEndian.AppendUint32([]byte("payload!"), crc32.ChecksumIEEE([]byte("payload!")))
+	path := filepath.Join(t.TempDir(), "checked.bin")
+	if err := os.WriteFile(path, append(header, make([]byte, 52)...), 0644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+
+	t.Run("intact", func(t *testing.T) {
+		f, err := OpenFileWith(path, os.O_RDWR, 0, 0, WithCloseChecksum(0, 12, verify))
+		if err != nil {
+			t.Fatalf("OpenFileWith failed: %v", err)
+		}
+		if _, err := f.WriteAt([]byte("body"), 20); err != nil {
+			t.Fatalf("WriteAt failed: %v", err)
+		}
+		if err := f.Close(); err != nil {
+			t.Errorf("Close failed: %v", err)
+		}
+	})
+
+	t.Run("corrupted", func(t *testing.T) {
+		f, err := OpenFileWith(path, os.O_RDWR, 0, 0, WithCloseChecksum(0, 12, verify))
+		if err != nil {
+			t.Fatalf("OpenFileWith failed: %v", err)
+		}
+		if _, err := f.WriteAt([]byte("garbage"), 0); err != nil {
+			t.Fatalf("WriteAt failed: %v", err)
+		}
+		if err := f.Close(); !errors.Is(err, errCorrupt) {
+			t.Errorf("Close: got %v, want %v", err, errCorrupt)
+		}
+
+		// the file is closed regardless
+		if _, err := f.ReadAt(make([]byte, 1), 0); !errors.Is(err, ErrClosed) {
+			t.Errorf("ReadAt after Close: got %v, want ErrClosed", err)
+		}
+		if !nativeMapping {
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatalf("ReadFile failed: %v", err)
+			}
+			if !bytes.Equal(data[:12], header) {
+				t.Error("the corrupted header was written back")
+			}
+		}
+	})
+
+	t.Run("region past the end", func(t *testing.T) {
+		var got []byte
+		f, err := OpenFileWith(path, os.O_RDONLY, 0, 0, WithCloseChecksum(56, 100, func(b []byte) error {
+			got = bytes.Clone(b)
+			return nil
+		}))
+		if err != nil {
+			t.Fatalf("OpenFileWith failed: %v", err)
+		}
+		if err := f.Close(); err != nil {
+			t.Fatalf("Close failed: %v", err)
+		}
+		if len(got) != 8 {
+			t.Errorf("verify got %d bytes, want the 8 up to the end", len(got))
+		}
+	})
+}
+
+func TestCloseNoSync(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "nosync.txt")
+	if err := os.WriteFile(path, []byte("original"), 0644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+
+	f, err := OpenFile(path, os.O_RDWR, 0, 0)
+	if err != nil {
+		t.Fatalf("OpenFile failed: %v", err)
+	}
+	if _, err := f.WriteAt([]byte("modified"), 0); err != nil {
+		t.Fatalf("WriteAt failed: %v", err)
+	}
+	if err := f.CloseNoSync(); err != nil {
+		t.Fatalf("CloseNoSync failed: %v", err)
+	}
+	if _, err := f.ReadAt(make([]byte, 1), 0); !errors.Is(err, ErrClosed) {
+		t.Errorf("ReadAt after CloseNoSync: got %v, want ErrClosed", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("ReadFile failed: %v", err)
+	}
+
+	// a shared mapping writes to the page cache directly, while the fallback
+	// backend never writes its in-memory copy back
+	want := "modified"
+	if !nativeMapping {
+		want = "original"
+	}
+	if string(data) != want {
+		t.Errorf("file holds %q after CloseNoSync, want %q", data, want)
+	}
+
+	if err := f.CloseNoSync(); err != nil {
+		t.Errorf("second CloseNoSync failed: %v", err)
+	}
+}
+
+func TestRemove(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "remove.bin")
+
+	f, err := OpenFile(path, os.O_RDWR|os.O_CREATE, 0644, 16)
+	if err != nil {
+		t.Fatalf("OpenFile failed: %v", err)
+	}
+
+	if err := f.Remove(); err != nil {
+		t.Fatalf("Remove failed: %v", err)
+	}
+	if _, err := os.Stat(path); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Stat after Remove: got %v, want fs.ErrNotExist", err)
+	}
+	if f.Len() != 0 {
+		t.Errorf("Len() after Remove = %d, want 0", f.Len())
+	}
+
+	if err := f.Remove(); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("second Remove: got %v, want fs.ErrNotExist", err)
+	}
+}
+
+func TestReopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "reopen.txt")
+	if err := os.WriteFile(path, []byte("first"), 0644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+
+	f, err := OpenFileWith(path, os.O_RDWR, 0, 0, WithZeroFillReads())
+	if err != nil {
+		t.Fatalf("OpenFileWith failed: %v", err)
+	}
+	defer f.Close()
+
+	if err := f.Reopen(); err != ErrNotClosed {
+		t.Errorf("Reopen of an open file: got %v, want ErrNotClosed", err)
+	}
+
+	f.Seek(3, io.SeekStart)
+	gen := f.Generation()
+	if err := f.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	// the file changes while the handle is closed
+	if err := os.WriteFile(path, []byte("second"), 0644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+
+	if err := f.Reopen(); err != nil {
+		t.Fatalf("Reopen failed: %v", err)
+	}
+	if f.Generation() == gen {
+		t.Error("Generation() was not incremented by Reopen")
+	}
+	if pos, _ := f.Seek(0, io.SeekCurrent); pos != 0 {
+		t.Errorf("offset after Reopen = %d, want 0", pos)
+	}
+	if got := string(f.Bytes()); got != "second" {
+		t.Errorf("Bytes() = %q, want %q", got, "second")
+	}
+
+	// the access mode and options are kept
+	if _, err := f.WriteAt([]byte("S"), 0); err != nil {
+		t.Errorf("WriteAt after Reopen failed: %v", err)
+	}
+	buf := make([]byte, 8)
+	if n, err := f.ReadAt(buf, 0); n != 8 || err != nil {
+		t.Errorf("ReadAt past the end = %d, %v; want 8, nil (zero-filled)", n, err)
+	}
+
+	if err := f.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	got, err := os.ReadFile(path)
+	if err != nil || string(got) != "Second" {
+		t.Errorf("file holds %q, %v; want %q", got, err, "Second")
+	}
+
+	t.Run("removed", func(t *testing.T) {
+		os.Remove(path)
+		if err := f.Reopen(); !errors.Is(err, fs.ErrNotExist) {
+			t.Errorf("Reopen of a removed file: got %v, want fs.ErrNotExist", err)
+		}
+	})
+
+	t.Run("region at offset zero", func(t *testing.T) {
+		regionPath := filepath.Join(t.TempDir(), "region.bin")
+		if err := os.WriteFile(regionPath, []byte("header and payload"), 0644); err != nil {
+			t.Fatalf("WriteFile failed: %v", err)
+		}
+
+		r, err := OpenFileAt(regionPath, os.O_RDONLY, 0, 0, 6)
+		if err != nil {
+			t.Fatalf("OpenFileAt failed: %v", err)
+		}
+		r.Close()
+
+		if err := r.Reopen(); !errors.Is(err, ErrUnsupported) {
+			t.Errorf("Reopen of a region: got %v, want ErrUnsupported", err)
+		}
+	})
+}
+
+func TestCopyFile(t *testing.T) {
+	tempDir := t.TempDir()
+	content := bytes.Repeat([]byte("copy me! "), 1000)
+
+	src := filepath.Join(tempDir, "src.bin")
+	if err := os.WriteFile(src, content, 0644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+
+	t.Run("new destination", func(t *testing.T) {
+		dst := filepath.Join(tempDir, "dst.bin")
+
+		n, err := CopyFile(dst, src, 0644)
+		if err != nil {
+			t.Fatalf("CopyFile failed: %v", err)
+		}
+		if n != int64(len(content)) {
+			t.Errorf("CopyFile copied %d bytes, want %d", n, len(content))
+		}
+
+		got, err := os.ReadFile(dst)
+		if err != nil {
+			t.Fatalf("ReadFile failed: %v", err)
+		}
+		if !bytes.Equal(got, content) {
+			t.Error("destination content mismatch")
+		}
+	})
+
+	t.Run("larger destination", func(t *testing.T) {
+		dst := filepath.Join(tempDir, "larger.bin")
+		if err := os.WriteFile(dst, make([]byte, 2*len(content)), 0644); err != nil {
+			t.Fatalf("WriteFile failed: %v", err)
+		}
+
+		if _, err := CopyFile(dst, src, 0644); err != nil {
+			t.Fatalf("CopyFile failed: %v", err)
+		}
+
+		got, err := os.ReadFile(dst)
+		if err != nil {
+			t.Fatalf("ReadFile failed: %v", err)
+		}
+		if !bytes.Equal(got, content) {
+			t.Errorf("destination has %d bytes, want %d", len(got), len(content))
+		}
+	})
+
+	t.Run("empty source", func(t *testing.T) {
+		empty := filepath.Join(tempDir, "empty.bin")
+		if err := os.WriteFile(empty, nil, 0644); err != nil {
+			t.Fatalf("WriteFile failed: %v", err)
+		}
+
+		dst := filepath.Join(tempDir, "larger.bin")
+		n, err := CopyFile(dst, empty, 0644)
+		if err != nil {
+			t.Fatalf("CopyFile failed: %v", err)
+		}
+		if n != 0 {
+			t.Errorf("CopyFile copied %d bytes, want 0", n)
+		}
+
+		fi, err := os.Stat(dst)
+		if err != nil {
+			t.Fatalf("Stat failed: %v", err)
+		}
+		if fi.Size() != 0 {
+			t.Errorf("destination size = %d, want 0", fi.Size())
+		}
+	})
+
+	t.Run("missing source", func(t *testing.T) {
+		dst := filepath.Join(tempDir, "never.bin")
+		if _, err := CopyFile(dst, filepath.Join(tempDir, "missing.bin"), 0644); err == nil {
+			t.Error("CopyFile should fail for a missing source")
+		}
+		if _, err := os.Stat(dst); !os.IsNotExist(err) {
+			t.Error("destination should not be created")
+		}
+	})
+}
+
+func TestCopyRangeBetween(t *testing.T) {
+	dir := t.TempDir()
+	srcPath := filepath.Join(dir, "src.log")
+	if err := os.WriteFile(srcPath, []byte("0123456789"), 0644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+
+	src, err := Open(srcPath)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer src.Close()
+
+	dst, err := OpenFile(filepath.Join(dir, "dst.log"), os.O_RDWR|os.O_CREATE, 0644, 8)
+	if err != nil {
+		t.Fatalf("OpenFile failed: %v", err)
+	}
+	defer dst.Close()
+
+	n, err := CopyRangeBetween(dst, 2, src, 3, 4)
+	if err != nil || n != 4 {
+		t.Fatalf("CopyRangeBetween = %d, %v; want 4, nil", n, err)
+	}
+	if got := string(dst.Bytes()[2:6]); got != "3456" {
+		t.Errorf("dst holds %q, want %q", got, "3456")
+	}
+	if hw := dst.HighWater(); hw != 6 {
+		t.Errorf("dst.HighWater() = %d, want 6", hw)
+	}
+
+	tests := []struct {
+		name                   string
+		dstOff, srcOff, length int64
+		want                   error
+	}{
+		{"past end of src", 0, 8, 4, ErrOutOfRange},
+		{"past end of dst", 6, 0, 4, ErrWriteOutOfBounds},
+		{"negative src offset", 0, -1, 1, ErrNegativeOffset},
+		{"negative dst offset", -1, 0, 1, ErrNegativeOffset},
+		{"negative length", 0, 0, -1, ErrNegativeOffset},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			n, err := CopyRangeBetween(dst, tt.dstOff, src, tt.srcOff, tt.length)
+			if n != 0 || err != tt.want {
+				t.Errorf("CopyRangeBetween = %d, %v; want 0, %v", n, err, tt.want)
+			}
+		})
+	}
+
+	t.Run("same file", func(t *testing.T) {
+		copy(dst.Bytes(), "abcdefgh")
+		if _, err := CopyRangeBetween(dst, 2, dst, 0, 6); err != nil {
+			t.Fatalf("CopyRangeBetween failed: %v", err)
+		}
+		if got := string(dst.Bytes()); got != "ababcdef" {
+			t.Errorf("dst holds %q, want %q", got, "ababcdef")
+		}
+	})
+
+	t.Run("read-only dst", func(t *testing.T) {
+		if _, err := CopyRangeBetween(src, 0, dst, 0, 1); err != ErrReadOnly {
+			t.Errorf("got %v, want ErrReadOnly", err)
+		}
+	})
+
+	t.Run("concurrent opposite directions", func(t *testing.T) {
+		other, err := OpenFile(filepath.Join(dir, "other.log"), os.O_RDWR|os.O_CREATE, 0644, 8)
+		if err != nil {
+			t.Fatalf("OpenFile failed: %v", err)
+		}
+		defer other.Close()
+
+		var wg sync.WaitGroup
+		for i := range 8 {
+			a, b := dst, other
+			if i%2 == 1 {
+				a, b = b, a
+			}
+			wg.Go(func() {
+				for range 100 {
+					if _, err := CopyRangeBetween(a, 0, b, 0, 8); err != nil {
+						t.Errorf("CopyRangeBetween failed: %v", err)
+						return
+					}
+				}
+			})
+		}
+		wg.Wait()
+	})
+}
+
+func TestReadAll(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "readall.txt")
+	if err := os.WriteFile(path, []byte("read all of me"), 0644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+
+	f, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+
+	if _, err := f.Seek(5, io.SeekStart); err != nil {
+		t.Fatalf("Seek failed: %v", err)
+	}
+
+	got, err := f.ReadAll()
+	if err != nil {
+		t.Fatalf("ReadAll failed: %v", err)
+	}
+	if string(got) != "read all of me" {
+		t.Errorf("ReadAll() = %q, want %q", got, "read all of me")
+	}
+
+	if pos, _ := f.Seek(0, io.SeekCurrent); pos != 5 {
+		t.Errorf("offset after ReadAll = %d, want 5", pos)
+	}
+
+	f.Close()
+
+	// the copy outlives the mapping
+	if string(got) != "read all of me" {
+		t.Errorf("ReadAll() after Close = %q, want %q", got, "read all of me")
+	}
+
+	if _, err := f.ReadAll(); !errors.Is(err, ErrClosed) {
+		t.Errorf("ReadAll after Close: got %v, want ErrClosed", err)
+	}
+
+	t.Run("empty", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "empty.txt")
+		if err := os.WriteFile(path, nil, 0644); err != nil {
+			t.Fatalf("WriteFile failed: %v", err)
+		}
+
+		f, err := Open(path)
+		if err != nil {
+			t.Fatalf("Open failed: %v", err)
+		}
+		defer f.Close()
+
+		got, err := f.ReadAll()
+		if err != nil {
+			t.Fatalf("ReadAll failed: %v", err)
+		}
+		if got == nil || len(got) != 0 {
+			t.Errorf("ReadAll() = %#v, want empty non-nil slice", got)
+		}
+	})
+
+	t.Run("write-only", func(t *testing.T) {
+		f, err := OpenFile(path, os.O_WRONLY, 0, 0)
+		if err != nil {
+			t.Fatalf("OpenFile failed: %v", err)
+		}
+		defer f.Close()
+
+		if _, err := f.ReadAll(); !errors.Is(err, ErrWriteOnly) {
+			t.Errorf("got %v, want ErrWriteOnly", err)
+		}
+	})
+}
+
+func TestPeek(t *testing.T) {
+	f, err := Open("testdata/hello.txt")
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer f.Close()
+
+	want := string(f.Bytes())
+
+	b, err := f.Peek(5)
+	if err != nil {
+		t.Fatalf("Peek failed: %v", err)
+	}
+	if string(b) != want[:5] {
+		t.Errorf("Peek(5) = %q, want %q", b, want[:5])
+	}
+	if pos, _ := f.Seek(0, io.SeekCurrent); pos != 0 {
+		t.Errorf("offset after Peek = %d, want 0", pos)
+	}
+
+	if _, err := f.Seek(-3, io.SeekEnd); err != nil {
+		t.Fatalf("Seek failed: %v", err)
+	}
+
+	b, err = f.Peek(10)
+	if err != io.EOF {
+		t.Errorf("Peek past end: got err %v, want io.EOF", err)
+	}
+	if string(b) != want[len(want)-3:] {
+		t.Errorf("Peek(10) = %q, want %q", b, want[len(want)-3:])
+	}
+
+	t.Run("short peek is capped", func(t *testing.T) {
+		// the mapping extends past the logical length, so an append to an
+		// uncapped result would write into it
+		path := filepath.Join(t.TempDir(), "peek.bin")
+		g, err := OpenFile(path, os.O_RDWR|os.O_CREATE, 0644, 16)
+		if err != nil {
+			t.Fatalf("OpenFile failed: %v", err)
+		}
+		defer g.Close()
+
+		if err := g.SetLen(8); err != nil {
+			t.Fatalf("SetLen failed: %v", err)
+		}
+		if _, err := g.Seek(5, io.SeekStart); err != nil {
+			t.Fatalf("Seek failed: %v", err)
+		}
+
+		b, err := g.Peek(10)
+		if err != io.EOF || len(b) != 3 {
+			t.Fatalf("Peek(10) = %d bytes, %v, want 3, io.EOF", len(b), err)
+		}
+		if cap(b) != 3 {
+			t.Errorf("cap(Peek(10)) = %d, want 3", cap(b))
+		}
+	})
+
+	if b, err := f.Peek(0); err != nil || len(b) != 0 {
+		t.Errorf("Peek(0) = %q, %v; want empty, nil", b, err)
+	}
+	if _, err := f.Peek(-1); !errors.Is(err, ErrNegativeCount) {
+		t.Errorf("Peek(-1): got %v, want ErrNegativeCount", err)
+	}
+
+	if _, err := f.Seek(0, io.SeekEnd); err != nil {
+		t.Fatalf("Seek failed: %v", err)
+	}
+	if b, err := f.Peek(1); err != io.EOF || len(b) != 0 {
+		t.Errorf("Peek at end = %q, %v; want empty, io.EOF", b, err)
+	}
+
+	f.Close()
+	if _, err := f.Peek(1); !errors.Is(err, ErrClosed) {
+		t.Errorf("Peek after Close: got %v, want ErrClosed", err)
+	}
+}
+
+func TestLockRange(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "lock.bin")
+	if err := os.WriteFile(path, make([]byte, 4096), 0644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+
+	f1, err := OpenFile(path, os.O_RDWR, 0, 0)
+	if err != nil {
+		t.Fatalf("OpenFile failed: %v", err)
+	}
+	defer f1.Close()
+
+	f2, err := OpenFile(path, os.O_RDWR, 0, 0)
+	if err != nil {
+		t.Fatalf("OpenFile failed: %v", err)
+	}
+	defer f2.Close()
+
+	if err := f1.LockRange(0, 100, true); err != nil {
+		if errors.Is(err, ErrUnsupported) {
+			t.Skip("range locks not supported")
+		}
+		t.Fatalf("LockRange failed: %v", err)
+	}
+
+	// a disjoint range does not conflict
+	if err := f2.LockRange(100, 100, true); err != nil {
+		t.Fatalf("LockRange on disjoint range failed: %v", err)
+	}
+	if err := f2.UnlockRange(100, 100); err != nil {
+		t.Fatalf("UnlockRange failed: %v", err)
+	}
+
+	// classic fcntl locks are per-process, so only descriptor-owned locks
+	// conflict between two files within the same process
+	if runtime.GOOS == "linux" || runtime.GOOS == "windows" {
+		acquired := make(chan error, 1)
+		go func() {
+			acquired <- f2.LockRange(50, 10, true)
+		}()
+
+		select {
+		case err := <-acquired:
+			t.Fatalf("LockRange on a locked range returned early: %v", err)
+		case <-time.After(100 * time.Millisecond):
+		}
+
+		if err := f1.UnlockRange(0, 100); err != nil {
+			t.Fatalf("UnlockRange failed: %v", err)
+		}
+
+		select {
+		case err := <-acquired:
+			if err != nil {
+				t.Fatalf("LockRange after unlock failed: %v", err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("LockRange did not return after the range was unlocked")
+		}
+
+		if err := f2.UnlockRange(50, 10); err != nil {
+			t.Fatalf("UnlockRange failed: %v", err)
+		}
+	} else if err := f1.UnlockRange(0, 100); err != nil {
+		t.Fatalf("UnlockRange failed: %v", err)
+	}
+
+	t.Run("shared", func(t *testing.T) {
+		if err := f1.LockRange(0, 0, false); err != nil {
+			t.Fatalf("LockRange shared failed: %v", err)
+		}
+		if err := f2.LockRange(0, 0, false); err != nil {
+			t.Fatalf("second shared LockRange failed: %v", err)
+		}
+		if err := f1.UnlockRange(0, 0); err != nil {
+			t.Errorf("UnlockRange failed: %v", err)
+		}
+		if err := f2.UnlockRange(0, 0); err != nil {
+			t.Errorf("UnlockRange failed: %v", err)
+		}
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		if err := f1.LockRange(-1, 10, true); !errors.Is(err, ErrNegativeOffset) {
+			t.Errorf("got %v, want ErrNegativeOffset", err)
+		}
+		if err := f1.LockRange(0, -1, true); !errors.Is(err, ErrNegativeOffset) {
+			t.Errorf("got %v, want ErrNegativeOffset", err)
+		}
+	})
+
+	t.Run("closed", func(t *testing.T) {
+		f, err := Open(path)
+		if err != nil {
+			t.Fatalf("Open failed: %v", err)
+		}
+		f.Close()
+
+		if err := f.LockRange(0, 10, false); !errors.Is(err, ErrClosed) {
+			t.Errorf("got %v, want ErrClosed", err)
+		}
+	})
+}
+
+func TestZero(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "secret.bin")
+	if err := os.WriteFile(path, []byte("top secret"), 0600); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+
+	f, err := OpenFile(path, os.O_RDWR, 0, 0)
+	if err != nil {
+		t.Fatalf("OpenFile failed: %v", err)
+	}
+
+	if err := f.Zero(); err != nil {
+		t.Fatalf("Zero failed: %v", err)
+	}
+	if !bytes.Equal(f.Bytes(), make([]byte, 10)) {
+		t.Errorf("Bytes() after Zero = %q, want all zeros", f.Bytes())
+	}
+	if err := f.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("ReadFile failed: %v", err)
+	}
+	if !bytes.Equal(data, make([]byte, 10)) {
+		t.Errorf("file content after Zero = %q, want all zeros", data)
+	}
+
+	if err := f.Zero(); !errors.Is(err, ErrClosed) {
+		t.Errorf("Zero after Close: got %v, want ErrClosed", err)
+	}
+
+	t.Run("read-only", func(t *testing.T) {
+		f, err := Open(path)
+		if err != nil {
+			t.Fatalf("Open failed: %v", err)
+		}
+		defer f.Close()
+
+		if err := f.Zero(); !errors.Is(err, ErrReadOnly) {
+			t.Errorf("got %v, want ErrReadOnly", err)
+		}
+	})
+}
+
+func TestView(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "view.bin")
+
+	// 4-byte magic, then a header with two little-endian uint32 fields
+	content := []byte{'M', 'A', 'G', 'C', 1, 0, 0, 0, 0, 1, 0, 0}
+	if err := os.WriteFile(path, content, 0644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+
+	f, err := OpenFile(path, os.O_RDWR, 0, 0)
+	if err != nil {
+		t.Fatalf("OpenFile failed: %v", err)
+	}
+	defer f.Close()
+
+	v, err := f.View(4, 8)
+	if err != nil {
+		t.Fatalf("View failed: %v", err)
+	}
+	if v.Offset() != 4 || v.Len() != 8 {
+		t.Errorf("Offset(), Len() = %d, %d; want 4, 8", v.Offset(), v.Len())
+	}
+
+	if got, err := v.Uint32(0, binary.LittleEndian); err != nil || got != 1 {
+		t.Errorf("Uint32(0) = %d, %v; want 1, nil", got, err)
+	}
+	if got, err := v.Uint32(4, binary.LittleEndian); err != nil || got != 256 {
+		t.Errorf("Uint32(4) = %d, %v; want 256, nil", got, err)
+	}
+
+	if err := v.WriteUint32(4, 0xCAFEBABE, binary.BigEndian); err != nil {
+		t.Fatalf("WriteUint32 failed: %v", err)
+	}
+	if got, err := v.Bytes(4, 4); err != nil || !bytes.Equal(got, []byte{0xCA, 0xFE, 0xBA, 0xBE}) {
+		t.Errorf("Bytes(4, 4) = %x, %v; want cafebabe, nil", got, err)
+	}
+	if string(f.Bytes()[:4]) != "MAGC" {
+		t.Errorf("write through view modified bytes outside it: %q", f.Bytes()[:4])
+	}
+
+	t.Run("bounds", func(t *testing.T) {
+		if _, err := v.Uint32(5, binary.LittleEndian); !errors.Is(err, ErrOutOfRange) {
+			t.Errorf("Uint32 past end: got %v, want ErrOutOfRange", err)
+		}
+		if err := v.WriteUint32(8, 0, binary.LittleEndian); !errors.Is(err, ErrOutOfRange) {
+			t.Errorf("WriteUint32 past end: got %v, want ErrOutOfRange", err)
+		}
+		if _, err := v.Bytes(-1, 1); !errors.Is(err, ErrNegativeOffset) {
+			t.Errorf("Bytes with negative offset: got %v, want ErrNegativeOffset", err)
+		}
+		if _, err := f.View(8, 8); !errors.Is(err, ErrOutOfRange) {
+			t.Errorf("View past end: got %v, want ErrOutOfRange", err)
+		}
+	})
+
+	t.Run("read-only", func(t *testing.T) {
+		ro, err := Open(path)
+		if err != nil {
+			t.Fatalf("Open failed: %v", err)
+		}
+		defer ro.Close()
+
+		v, err := ro.View(0, 4)
+		if err != nil {
+			t.Fatalf("View failed: %v", err)
+		}
+		if err := v.WriteUint32(0, 0, binary.LittleEndian); !errors.Is(err, ErrReadOnly) {
+			t.Errorf("got %v, want ErrReadOnly", err)
+		}
+	})
+
+	t.Run("stale", func(t *testing.T) {
+		f.mu.Lock()
+		f.gen++ // simulate a remap
+		f.mu.Unlock()
+
+		if _, err := v.Uint32(0, binary.LittleEndian); !errors.Is(err, ErrStaleView) {
+			t.Errorf("got %v, want ErrStaleView", err)
+		}
+	})
+
+	t.Run("closed", func(t *testing.T) {
+		v, err := f.View(0, 4)
+		if err != nil {
+			t.Fatalf("View failed: %v", err)
+		}
+		f.Close()
+
+		if _, err := v.Bytes(0, 4); !errors.Is(err, ErrClosed) {
+			t.Errorf("got %v, want ErrClosed", err)
+		}
+	})
+}
+
+func TestRefresh(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "growing.log")
+	if err := os.WriteFile(path, nil, 0644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+
+	f, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer f.Close()
+
+	appender, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatalf("OpenFile failed: %v", err)
+	}
+	defer appender.Close()
+
+	var want string
+	for _, line := range []string{"first line\n", "second line\n", strings.Repeat("x", 10000) + "\n"} {
+		if _, err := appender.WriteString(line); err != nil {
+			t.Fatalf("WriteString failed: %v", err)
+		}
+		want += line
+
+		gen := f.Generation()
+		grew, err := f.Refresh()
+		if err != nil {
+			t.Fatalf("Refresh failed: %v", err)
+		}
+		if !grew {
+			t.Fatal("Refresh() = false after the file grew")
+		}
+		if f.Len() != len(want) {
+			t.Errorf("Len() = %d, want %d", f.Len(), len(want))
+		}
+		if string(f.Bytes()) != want {
+			t.Error("Bytes() does not match the file after Refresh")
+		}
+		if f.Generation() == gen {
+			t.Error("Generation() was not incremented by Refresh")
+		}
+	}
+
+	gen := f.Generation()
+	if grew, err := f.Refresh(); err != nil || grew {
+		t.Errorf("Refresh() without growth = %v, %v; want false, nil", grew, err)
+	}
+	if f.Generation() != gen {
+		t.Error("Generation() changed without a remap")
+	}
+
+	t.Run("writable", func(t *testing.T) {
+		f, err := OpenFile(path, os.O_RDWR, 0, 0)
+		if err != nil {
+			t.Fatalf("OpenFile failed: %v", err)
+		}
+		defer f.Close()
+
+		if _, err := f.Refresh(); !errors.Is(err, ErrUnsupported) {
+			t.Errorf("got %v, want ErrUnsupported", err)
+		}
+	})
+
+	t.Run("closed", func(t *testing.T) {
+		f, err := Open(path)
+		if err != nil {
+			t.Fatalf("Open failed: %v", err)
+		}
+		f.Close()
+
+		if _, err := f.Refresh(); !errors.Is(err, ErrClosed) {
+			t.Errorf("got %v, want ErrClosed", err)
+		}
+	})
+}
+
+func TestByteAt(t *testing.T) {
+	f, err := Open("testdata/hello.txt")
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer f.Close()
+
+	data := f.Bytes()
+	for _, off := range []int64{0, 1, int64(len(data)) - 1} {
+		c, err := f.ByteAt(off)
+		if err != nil {
+			t.Fatalf("ByteAt(%d) failed: %v", off, err)
+		}
+		if c != data[off] {
+			t.Errorf("ByteAt(%d) = %q, want %q", off, c, data[off])
+		}
+	}
+
+	if _, err := f.ByteAt(int64(len(data))); err != io.EOF {
+		t.Errorf("ByteAt at end: got %v, want io.EOF", err)
+	}
+	if _, err := f.ByteAt(math.MaxInt64); err != io.EOF {
+		t.Errorf("ByteAt past end: got %v, want io.EOF", err)
+	}
+	if _, err := f.ByteAt(-1); !errors.Is(err, ErrNegativeOffset) {
+		t.Errorf("ByteAt(-1): got %v, want ErrNegativeOffset", err)
+	}
+
+	f.Close()
+	if _, err := f.ByteAt(0); !errors.Is(err, ErrClosed) {
+		t.Errorf("ByteAt after Close: got %v, want ErrClosed", err)
+	}
+}
+
+func TestWithNoReserve(t *testing.T) {
+	if strconv.IntSize < 64 {
+		t.Skip("requires a 64-bit address space")
+	}
+	if !nativeMapping {
+		t.Skip("the fallback backend reads the whole file into memory")
+	}
+	if testing.Short() {
+		t.Skip("skipping large sparse mapping in short mode")
+	}
+
+	const size int64 = 8 << 30 // 8 GiB, far more than the test needs to touch
+
+	for _, tc := range []struct {
+		name string
+		opts []Option
+	}{
+		{"shared", []Option{WithNoReserve()}},
+		{"private", []Option{WithNoReserve(), WithPrivate()}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "sparse.bin")
+
+			f, err := OpenFileWith(path, os.O_RDWR|os.O_CREATE, 0644, size, tc.opts...)
+			if err != nil {
+				t.Skipf("cannot create sparse file: %v", err)
+			}
+			defer f.Close()
+
+			if int64(f.Len()) != size {
+				t.Fatalf("Len() = %d, want %d", f.Len(), size)
+			}
+
+			for _, off := range []int64{0, size / 2, size - 1} {
+				if _, err := f.WriteAt([]byte{0xAA}, off); err != nil {
+					t.Fatalf("WriteAt(%d) failed: %v", off, err)
+				}
+				if c, err := f.ByteAt(off); err != nil || c != 0xAA {
+					t.Errorf("ByteAt(%d) = %#x, %v; want 0xaa, nil", off, c, err)
+				}
+			}
+		})
+	}
+}
+
+func TestPointer(t *testing.T) {
+	f, err := Open("testdata/hello.txt")
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer f.Close()
+
+	ptr, n, err := f.Pointer()
+	if err != nil {
+		t.Fatalf("Pointer failed: %v", err)
+	}
+	if n != f.Len() {
+		t.Errorf("Pointer length = %d, want %d", n, f.Len())
+	}
+	if got := unsafe.Slice((*byte)(ptr), n); !bytes.Equal(got, f.Bytes()) {
+		t.Error("memory at Pointer does not match Bytes()")
+	}
+
+	t.Run("empty", func(t *testing.T) {
+		f, err := Open("testdata/empty.txt")
+		if err != nil {
+			t.Fatalf("Open failed: %v", err)
+		}
+		defer f.Close()
+
+		if _, _, err := f.Pointer(); !errors.Is(err, ErrEmpty) {
+			t.Errorf("got %v, want ErrEmpty", err)
+		}
+	})
+
+	f.Close()
+	if _, _, err := f.Pointer(); !errors.Is(err, ErrClosed) {
+		t.Errorf("Pointer after Close: got %v, want ErrClosed", err)
+	}
+}
+
+func TestIsMapped(t *testing.T) {
+	f, err := Open("testdata/hello.txt")
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+
+	if got := f.IsMapped(); got != nativeMapping {
+		t.Errorf("IsMapped() = %v, want %v", got, nativeMapping)
+	}
+
+	f.Close()
+	if f.IsMapped() {
+		t.Error("IsMapped() = true after Close")
+	}
+
+	empty, err := Open("testdata/empty.txt")
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer empty.Close()
+
+	if empty.IsMapped() {
+		t.Error("IsMapped() = true for an empty file")
+	}
+}
+
+func TestNewMemory(t *testing.T) {
+	const size = 32
+
+	fileBacked, err := OpenFile(filepath.Join(t.TempDir(), "file.bin"), os.O_RDWR|os.O_CREATE, 0644, size)
+	if err != nil {
+		t.Fatalf("OpenFile failed: %v", err)
+	}
+	defer fileBacked.Close()
+
+	mem := NewMemory(size)
+	defer mem.Close()
+
+	// the same sequence of operations yields the same results on both
+	type result struct {
+		n   int64
+		err error
+		buf string
+	}
+	ops := []struct {
+		name string
+		op   func(f *MmapFile) result
+	}{
+		{"Write", func(f *MmapFile) result {
+			n, err := f.Write([]byte("hello, world"))
+			return result{int64(n), err, ""}
+		}},
+		{"Seek current", func(f *MmapFile) result {
+			n, err := f.Seek(-5, io.SeekCurrent)
+			return result{n, err, ""}
+		}},
+		{"Read", func(f *MmapFile) result {
+			buf := make([]byte, 5)
+			n, err := f.Read(buf)
+			return result{int64(n), err, string(buf[:n])}
+		}},
+		{"WriteAt", func(f *MmapFile) result {
+			n, err := f.WriteAt([]byte("tail"), size-4)
+			return result{int64(n), err, ""}
+		}},
+		{"WriteAt past end", func(f *MmapFile) result {
+			n, err := f.WriteAt([]byte("overflow"), size-4)
+			return result{int64(n), err, ""}
+		}},
+		{"Seek end", func(f *MmapFile) result {
+			n, err := f.Seek(-4, io.SeekEnd)
+			return result{n, err, ""}
+		}},
+		{"Read to EOF", func(f *MmapFile) result {
+			buf := make([]byte, 8)
+			n, err := f.Read(buf)
+			return result{int64(n), err, string(buf[:n])}
+		}},
+		{"Read at EOF", func(f *MmapFile) result {
+			n, err := f.Read(make([]byte, 1))
+			return result{int64(n), err, ""}
+		}},
+		{"Seek negative", func(f *MmapFile) result {
+			n, err := f.Seek(-1, io.SeekStart)
+			return result{n, err, ""}
+		}},
+		{"ReadAt", func(f *MmapFile) result {
+			buf := make([]byte, size)
+			n, err := f.ReadAt(buf, 0)
+			return result{int64(n), err, string(buf[:n])}
+		}},
+		{"Len", func(f *MmapFile) result {
+			return result{int64(f.Len()), nil, ""}
+		}},
+	}
+
+	for _, tt := range ops {
+		want, got := tt.op(fileBacked), tt.op(mem)
+		if got.n != want.n || !errors.Is(got.err, want.err) || got.buf != want.buf {
+			t.Errorf("%s on memory = %+v, file-backed = %+v", tt.name, got, want)
+		}
+	}
+
+	t.Run("no file", func(t *testing.T) {
+		if got := mem.Name(); got != "<memory>" {
+			t.Errorf("Name() = %q, want %q", got, "<memory>")
+		}
+
+		fi, err := mem.Stat()
+		if err != nil {
+			t.Fatalf("Stat failed: %v", err)
+		}
+		if fi.Size() != size || fi.Name() != "<memory>" || !fi.Mode().IsRegular() {
+			t.Errorf("Stat() = %q, %d, %v", fi.Name(), fi.Size(), fi.Mode())
+		}
+
+		if err := mem.Sync(); err != nil {
+			t.Errorf("Sync failed: %v", err)
+		}
+		if err := mem.SyncMeta(); err != nil {
+			t.Errorf("SyncMeta failed: %v", err)
+		}
+		if err := mem.Prefetch(0, size); err != nil {
+			t.Errorf("Prefetch failed: %v", err)
+		}
+		if err := mem.FlushAndEvict(0, size); err != nil {
+			t.Errorf("FlushAndEvict failed: %v", err)
+		}
+		if mem.IsMapped() || mem.IsShared() {
+			t.Error("a memory file reports a mapping")
+		}
+		if err := mem.Truncate(size * 2); !errors.Is(err, ErrUnsupported) {
+			t.Errorf("Truncate: got %v, want ErrUnsupported", err)
+		}
+		if err := mem.Rename(filepath.Join(t.TempDir(), "renamed")); !errors.Is(err, ErrUnsupported) {
+			t.Errorf("Rename: got %v, want ErrUnsupported", err)
+		}
+	})
+
+	t.Run("close", func(t *testing.T) {
+		m := NewMemory(8)
+		if err := m.SetReadOnly(); err != nil {
+			t.Fatalf("SetReadOnly failed: %v", err)
+		}
+		if _, err := m.WriteAt([]byte("x"), 0); !errors.Is(err, ErrReadOnly) {
+			t.Errorf("WriteAt after SetReadOnly: got %v, want ErrReadOnly", err)
+		}
+		if err := m.Close(); err != nil {
+			t.Fatalf("Close failed: %v", err)
+		}
+		if _, err := m.ReadAt(make([]byte, 1), 0); !errors.Is(err, ErrClosed) {
+			t.Errorf("ReadAt after Close: got %v, want ErrClosed", err)
+		}
+	})
+}
+
+// recordingBackend is a [Backend] that records the calls made to it.
+type recordingBackend struct {
+	calls []string
+}
+
+func (b *recordingBackend) Map(file *os.File, off, size int64) ([]byte, error) {
+	b.calls = append(b.calls, fmt.Sprintf("Map(%d, %d)", off, size))
+	data := make([]byte, size)
+	_, err := file.ReadAt(data, off)
+
+	return data, err
+}
+
+func (b *recordingBackend) Flush(file *os.File, off int64, data []byte) error {
+	b.calls = append(b.calls, fmt.Sprintf("Flush(%d, %q)", off, data))
+	_, err := file.WriteAt(data, off)
+
+	return err
+}
+
+func (b *recordingBackend) Unmap(data []byte) error {
+	b.calls = append(b.calls, fmt.Sprintf("Unmap(%d)", len(data)))
+
+	return nil
+}
+
+func TestWithBackend(t *testing.T) {
+	if nativeMapping {
+		t.Skip("backends only apply to the fallback backend")
+	}
+
+	path := filepath.Join(t.TempDir(), "backend.txt")
+	if err := os.WriteFile(path, []byte("hello world"), 0644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+
+	b := &recordingBackend{}
+	f, err := OpenFileWith(path, os.O_RDWR, 0, 0, WithBackend(b))
+	if err != nil {
+		t.Fatalf("OpenFileWith failed: %v", err)
+	}
+	if got := string(f.Bytes()); got != "hello world" {
+		t.Errorf("Bytes() = %q, want %q", got, "hello world")
+	}
+
+	if _, err := f.WriteAt([]byte("HELLO"), 0); err != nil {
+		t.Fatalf("WriteAt failed: %v", err)
+	}
+	if err := f.Sync(); err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	want := []string{`Map(0, 11)`, `Flush(0, "HELLO world")`, `Unmap(11)`}
+	if !slices.Equal(b.calls, want) {
+		t.Errorf("backend calls = %q, want %q", b.calls, want)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("ReadFile failed: %v", err)
+	}
+	if string(data) != "HELLO world" {
+		t.Errorf("file holds %q, want %q", data, "HELLO world")
+	}
+}
+
+func TestIsShared(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "shared.bin")
+
+	t.Run("default", func(t *testing.T) {
+		f, err := OpenFile(path, os.O_RDWR|os.O_CREATE, 0644, 64)
+		if err != nil {
+			t.Fatalf("OpenFile failed: %v", err)
+		}
+		defer f.Close()
+
+		if got := f.IsShared(); got != nativeMapping {
+			t.Errorf("IsShared() = %v, want %v", got, nativeMapping)
+		}
+	})
+
+	t.Run("read-only", func(t *testing.T) {
+		f, err := Open(path)
+		if err != nil {
+			t.Fatalf("Open failed: %v", err)
+		}
+		defer f.Close()
+
+		if got := f.IsShared(); got != nativeMapping {
+			t.Errorf("IsShared() = %v, want %v", got, nativeMapping)
+		}
+	})
+
+	t.Run("private", func(t *testing.T) {
+		f, err := OpenFileWith(path, os.O_RDWR, 0, 0, WithPrivate())
+		if err != nil {
+			t.Fatalf("OpenFileWith failed: %v", err)
+		}
+		defer f.Close()
+
+		if f.IsShared() {
+			t.Error("IsShared() = true for a private mapping")
+		}
+	})
+
+	t.Run("overlay", func(t *testing.T) {
+		f, err := OpenFile(path, os.O_RDWR, 0, 0)
+		if err != nil {
+			t.Fatalf("OpenFile failed: %v", err)
+		}
+		defer f.Close()
+
+		o, err := f.Overlay()
+		if err != nil {
+			t.Fatalf("Overlay failed: %v", err)
+		}
+		defer o.Close()
+
+		if o.IsShared() {
+			t.Error("IsShared() = true for an overlay")
+		}
+	})
+
+	t.Run("closed", func(t *testing.T) {
+		f, err := Open(path)
+		if err != nil {
+			t.Fatalf("Open failed: %v", err)
+		}
+		f.Close()
+
+		if f.IsShared() {
+			t.Error("IsShared() = true after Close")
+		}
+	})
+}
+
+func TestOpenShared(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "shared.db")
+	if err := os.WriteFile(path, []byte("shared contents"), 0644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+
+	a, err := OpenShared(path, os.O_RDWR)
+	if err != nil {
+		t.Fatalf("OpenShared failed: %v", err)
+	}
+	b, err := OpenShared(path, os.O_RDONLY)
+	if err != nil {
+		t.Fatalf("OpenShared failed: %v", err)
+	}
+
+	if a.entry.f != b.entry.f {
+		t.Error("handles to the same path do not share an MmapFile")
+	}
+
+	if _, err := a.WriteAt([]byte("SHARED"), 0); err != nil {
+		t.Fatalf("WriteAt failed: %v", err)
+	}
+	buf := make([]byte, 6)
+	if _, err := b.ReadAt(buf, 0); err != nil || string(buf) != "SHARED" {
+		t.Errorf("ReadAt through the other handle = %q, %v, want %q", buf, err, "SHARED")
+	}
+
+	t.Run("hard link", func(t *testing.T) {
+		link := filepath.Join(dir, "link.db")
+		if err := os.Link(path, link); err != nil {
+			t.Skipf("Link failed: %v", err)
+		}
+
+		c, err := OpenShared(link, os.O_RDONLY)
+		if err != nil {
+			t.Fatalf("OpenShared failed: %v", err)
+		}
+		defer c.Close()
+
+		if c.entry.f != a.entry.f {
+			t.Error("a hard link to the file does not share its mapping")
+		}
+	})
+
+	// the mapping outlives all but the last handle
+	if err := a.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	if err := a.Close(); !errors.Is(err, ErrClosed) {
+		t.Errorf("second Close: got %v, want ErrClosed", err)
+	}
+	if _, err := a.WriteAt([]byte("x"), 0); !errors.Is(err, ErrClosed) {
+		t.Errorf("WriteAt through a closed handle: got %v, want ErrClosed", err)
+	}
+	if _, err := a.ReadAt(buf, 0); !errors.Is(err, ErrClosed) {
+		t.Errorf("ReadAt through a closed handle: got %v, want ErrClosed", err)
+	}
+	if _, err := b.WriteAt([]byte("x"), 0); !errors.Is(err, ErrReadOnly) {
+		t.Errorf("WriteAt through a read-only handle: got %v, want ErrReadOnly", err)
+	}
+	if err := b.Sync(); !errors.Is(err, ErrReadOnly) {
+		t.Errorf("Sync through a read-only handle: got %v, want ErrReadOnly", err)
+	}
+	if !b.ReadOnly() || a.ReadOnly() {
+		t.Errorf("ReadOnly() = %v, %v, want true for the read-only handle only", b.ReadOnly(), a.ReadOnly())
+	}
+	if _, err := b.ReadAt(buf, 0); err != nil {
+		t.Errorf("ReadAt after closing the other handle failed: %v", err)
+	}
+
+	if err := b.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	if _, err := b.ReadAt(buf, 0); !errors.Is(err, ErrClosed) {
+		t.Errorf("ReadAt after closing the last handle: got %v, want ErrClosed", err)
+	}
+
+	t.Run("reopen after close", func(t *testing.T) {
+		c, err := OpenShared(path, os.O_RDONLY)
+		if err != nil {
+			t.Fatalf("OpenShared failed: %v", err)
+		}
+		defer c.Close()
+
+		if c.entry.f == a.entry.f {
+			t.Error("OpenShared returned a closed file")
+		}
+		got := make([]byte, c.Len())
+		if _, err := c.ReadAt(got, 0); err != nil || string(got) != "SHARED contents" {
+			t.Errorf("ReadAt() = %q, %v, want %q", got, err, "SHARED contents")
+		}
+
+		if _, err := OpenShared(path, os.O_RDWR); !errors.Is(err, ErrReadOnly) {
+			t.Errorf("OpenShared writable over a read-only mapping: got %v, want ErrReadOnly", err)
+		}
+	})
+
+	t.Run("nonexistent", func(t *testing.T) {
+		if _, err := OpenShared(filepath.Join(dir, "missing.db"), os.O_RDONLY); !errors.Is(err, fs.ErrNotExist) {
+			t.Errorf("OpenShared of a missing file: got %v, want fs.ErrNotExist", err)
+		}
+	})
+
+	t.Run("lifecycle methods go through the refcount", func(t *testing.T) {
+		c, err := OpenShared(path, os.O_RDONLY)
+		if err != nil {
+			t.Fatalf("OpenShared failed: %v", err)
+		}
+		d, err := OpenShared(path, os.O_RDONLY)
+		if err != nil {
+			t.Fatalf("OpenShared failed: %v", err)
+		}
+
+		if err := c.Remove(); !errors.Is(err, ErrInUse) {
+			t.Errorf("Remove with another handle open: got %v, want ErrInUse", err)
+		}
+		if err := c.Reopen(); !errors.Is(err, ErrUnsupported) {
+			t.Errorf("Reopen: got %v, want ErrUnsupported", err)
+		}
+		if err := c.CloseNoSync(); err != nil {
+			t.Fatalf("CloseNoSync failed: %v", err)
+		}
+		if _, err := d.ReadAt(buf, 0); err != nil {
+			t.Errorf("ReadAt after CloseNoSync of the other handle failed: %v", err)
+		}
+
+		if err := d.Remove(); err != nil {
+			t.Fatalf("Remove of the last handle failed: %v", err)
+		}
+		if _, err := os.Stat(path); !errors.Is(err, fs.ErrNotExist) {
+			t.Errorf("Stat after Remove: got %v, want fs.ErrNotExist", err)
+		}
+		if err := d.Remove(); !errors.Is(err, ErrClosed) {
+			t.Errorf("second Remove: got %v, want ErrClosed", err)
+		}
+	})
+}
+
+func TestExclusiveWriteAt(t *testing.T) {
+	const size = 64 << 10
+
+	path := filepath.Join(t.TempDir(), "exclusive.bin")
+	f, err := OpenFileWith(path, os.O_RDWR|os.O_CREATE, 0644, size, WithExclusiveWriteAt())
+	if err != nil {
+		t.Fatalf("OpenFileWith failed: %v", err)
+	}
+	defer f.Close()
+
+	// every writer overwrites the same region with its own byte, so any
+	// read must observe a single writer's pattern
+	var wg sync.WaitGroup
+	errs := make(chan error, 16)
+
+	for w := range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			buf := bytes.Repeat([]byte{byte('a' + w)}, size)
+			for range 50 {
+				if _, err := f.WriteAt(buf, 0); err != nil {
+					errs <- err
+					return
+				}
+				if _, err := f.WriteAtv([][]byte{buf[:size/2], buf[size/2:]}, 0); err != nil {
+					errs <- err
+					return
+				}
+			}
+		}()
+	}
+
+	for range 4 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			buf := make([]byte, size)
+			for range 100 {
+				if _, err := f.ReadAt(buf, 0); err != nil {
+					errs <- err
+					return
+				}
+				if bytes.Count(buf, buf[:1]) != size {
+					errs <- fmt.Errorf("read observed interleaved writes")
+					return
+				}
+			}
+		}()
+	}
+
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Error(err)
+	}
+}
+
+func TestReadFromExact(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "exact.txt")
+	if err := os.WriteFile(path, bytes.Repeat([]byte("stale "), 100), 0644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+
+	f, err := OpenFile(path, os.O_RDWR, 0, 0)
+	if err != nil {
+		t.Fatalf("OpenFile failed: %v", err)
+	}
+
+	gen := f.Generation()
+	n, err := f.ReadFromExact(strings.NewReader("fresh content"))
+	if err != nil {
+		t.Fatalf("ReadFromExact failed: %v", err)
+	}
+	if n != 13 {
+		t.Errorf("ReadFromExact read %d bytes, want 13", n)
+	}
+	if f.Len() != 13 {
+		t.Errorf("Len() = %d, want 13", f.Len())
+	}
+	if string(f.Bytes()) != "fresh content" {
+		t.Errorf("Bytes() = %q, want %q", f.Bytes(), "fresh content")
+	}
+	if f.Generation() == gen {
+		t.Error("Generation() was not incremented by truncation")
+	}
+
+	if err := f.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("ReadFile failed: %v", err)
+	}
+	if string(data) != "fresh content" {
+		t.Errorf("file content = %q, want %q", data, "fresh content")
+	}
+
+	t.Run("empty reader", func(t *testing.T) {
+		f, err := OpenFile(path, os.O_RDWR, 0, 0)
+		if err != nil {
+			t.Fatalf("OpenFile failed: %v", err)
+		}
+		defer f.Close()
+
+		if _, err := f.ReadFromExact(strings.NewReader("")); err != nil {
+			t.Fatalf("ReadFromExact failed: %v", err)
+		}
+		if f.Len() != 0 {
+			t.Errorf("Len() = %d, want 0", f.Len())
+		}
+
+		fi, err := os.Stat(path)
+		if err != nil {
+			t.Fatalf("Stat failed: %v", err)
+		}
+		if fi.Size() != 0 {
+			t.Errorf("file size = %d, want 0", fi.Size())
+		}
+	})
+
+	t.Run("too much data", func(t *testing.T) {
+		if err := os.WriteFile(path, []byte("tiny"), 0644); err != nil {
+			t.Fatalf("WriteFile failed: %v", err)
+		}
+
+		f, err := OpenFile(path, os.O_RDWR, 0, 0)
+		if err != nil {
+			t.Fatalf("OpenFile failed: %v", err)
+		}
+		defer f.Close()
+
+		if _, err := f.ReadFromExact(strings.NewReader("far too large")); !errors.Is(err, ErrWriteOutOfBounds) {
+			t.Errorf("got %v, want ErrWriteOutOfBounds", err)
+		}
+		if f.Len() != 4 {
+			t.Errorf("Len() = %d, want 4", f.Len())
+		}
+	})
+
+	t.Run("private", func(t *testing.T) {
+		f, err := OpenFileWith(path, os.O_RDWR, 0, 0, WithPrivate())
+		if err != nil {
+			t.Fatalf("OpenFileWith failed: %v", err)
+		}
+		defer f.Close()
+
+		if _, err := f.ReadFromExact(strings.NewReader("x")); !errors.Is(err, ErrUnsupported) {
+			t.Errorf("got %v, want ErrUnsupported", err)
+		}
+	})
+
+	t.Run("read-only", func(t *testing.T) {
+		f, err := Open(path)
+		if err != nil {
+			t.Fatalf("Open failed: %v", err)
+		}
+		defer f.Close()
+
+		if _, err := f.ReadFromExact(strings.NewReader("x")); !errors.Is(err, ErrReadOnly) {
+			t.Errorf("got %v, want ErrReadOnly", err)
+		}
+	})
+}
+
+func TestOpenFileAt(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "container.bin")
+
+	// an unaligned payload, with a header and trailer around it
+	header := bytes.Repeat([]byte{'H'}, os.Getpagesize()+123)
+	payload := []byte("payload at an unaligned offset")
+	trailer := []byte("TRAILER")
+
+	var content []byte
+	content = append(content, header...)
+	content = append(content, payload...)
+	content = append(content, trailer...)
+	if err := os.WriteFile(path, content, 0644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+
+	off, length := int64(len(header)), int64(len(payload))
+
+	f, err := OpenFileAt(path, os.O_RDWR, 0, off, length)
+	if err != nil {
+		t.Fatalf("OpenFileAt failed: %v", err)
+	}
+
+	if f.Len() != len(payload) {
+		t.Errorf("Len() = %d, want %d", f.Len(), len(payload))
+	}
+	if !bytes.Equal(f.Bytes(), payload) {
+		t.Errorf("Bytes() = %q, want %q", f.Bytes(), payload)
+	}
+
+	buf := make([]byte, 7)
+	if _, err := f.Read(buf); err != nil || string(buf) != "payload" {
+		t.Errorf("Read() = %q, %v; want %q, nil", buf, err, "payload")
+	}
+	if _, err := f.ReadAt(buf[:2], 8); err != nil || string(buf[:2]) != "at" {
+		t.Errorf("ReadAt(8) = %q, %v; want %q, nil", buf[:2], err, "at")
+	}
+	if _, err := f.ReadAt(buf, length-3); err != io.EOF {
+		t.Errorf("ReadAt past end: got %v, want io.EOF", err)
+	}
+
+	if _, err := f.WriteAt([]byte("PAYLOAD"), 0); err != nil {
+		t.Fatalf("WriteAt failed: %v", err)
+	}
+	if _, err := f.WriteAt([]byte("overflow"), length-1); !errors.Is(err, ErrWriteOutOfBounds) {
+		t.Errorf("WriteAt past end: got %v, want ErrWriteOutOfBounds", err)
+	}
+
+	if err := f.Prefetch(0, length); err != nil {
+		t.Errorf("Prefetch failed: %v", err)
+	}
+	if _, err := f.Resident(); err != nil && !errors.Is(err, ErrUnsupported) {
+		t.Errorf("Resident failed: %v", err)
+	}
+	if err := f.LockRange(0, length, true); err != nil && !errors.Is(err, ErrUnsupported) {
+		t.Errorf("LockRange failed: %v", err)
+	} else if err == nil {
+		f.UnlockRange(0, length)
+	}
+
+	var out bytes.Buffer
+	if _, err := f.WriteTo(&out); err != nil || !strings.HasPrefix(out.String(), "PAYLOAD") {
+		t.Errorf("WriteTo = %q, %v; want prefix %q", out.String(), err, "PAYLOAD")
+	}
+
+	if err := f.Sync(); err != nil {
+		t.Errorf("Sync failed: %v", err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("ReadFile failed: %v", err)
+	}
+
+	want := bytes.Clone(content)
+	copy(want[off:], "PAYLOAD")
+	want[off+length-1] = 'o' // partial write past the end
+	if !bytes.Equal(data, want) {
+		t.Error("file content mismatch; the write went outside the payload")
+	}
+
+	t.Run("file destination", func(t *testing.T) {
+		f, err := OpenFileAt(path, os.O_RDONLY, 0, off, length)
+		if err != nil {
+			t.Fatalf("OpenFileAt failed: %v", err)
+		}
+		defer f.Close()
+
+		dstPath := filepath.Join(t.TempDir(), "payload.bin")
+		dst, err := os.Create(dstPath)
+		if err != nil {
+			t.Fatalf("Create failed: %v", err)
+		}
+		defer dst.Close()
+
+		if _, err := f.WriteTo(dst); err != nil {
+			t.Fatalf("WriteTo failed: %v", err)
+		}
+
+		got, err := os.ReadFile(dstPath)
+		if err != nil {
+			t.Fatalf("ReadFile failed: %v", err)
+		}
+		if !bytes.Equal(got, f.Bytes()) {
+			t.Errorf("WriteTo wrote %q, want %q", got, f.Bytes())
+		}
+	})
+
+	t.Run("out of range", func(t *testing.T) {
+		if _, err := OpenFileAt(path, os.O_RDONLY, 0, off, int64(len(content))); !errors.Is(err, ErrOutOfRange) {
+			t.Errorf("got %v, want ErrOutOfRange", err)
+		}
+		if _, err := OpenFileAt(path, os.O_RDONLY, 0, -1, 1); !errors.Is(err, ErrNegativeOffset) {
+			t.Errorf("got %v, want ErrNegativeOffset", err)
+		}
+		if _, err := OpenFileAt(path, os.O_RDWR|os.O_TRUNC, 0, 0, 1); err == nil {
+			t.Error("OpenFileAt should reject O_TRUNC")
+		}
+	})
+
+	t.Run("create", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "new.bin")
+
+		f, err := OpenFileAt(path, os.O_RDWR|os.O_CREATE, 0644, 1000, 24)
+		if err != nil {
+			t.Fatalf("OpenFileAt failed: %v", err)
+		}
+		if _, err := f.WriteAt([]byte("tail"), 20); err != nil {
+			t.Fatalf("WriteAt failed: %v", err)
+		}
+		if err := f.Close(); err != nil {
+			t.Fatalf("Close failed: %v", err)
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatalf("ReadFile failed: %v", err)
+		}
+		if len(data) != 1024 || string(data[1020:]) != "tail" {
+			t.Errorf("file has %d bytes ending in %q, want 1024 ending in %q", len(data), data[len(data)-4:], "tail")
+		}
+	})
+}
+
+func TestHash(t *testing.T) {
+	f, err := Open("testdata/binary.dat")
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	n, err := f.Hash(h)
+	if err != nil {
+		t.Fatalf("Hash failed: %v", err)
+	}
+	if n != int64(f.Len()) {
+		t.Errorf("Hash hashed %d bytes, want %d", n, f.Len())
+	}
+
+	want := sha256.Sum256(f.Bytes())
+	if !bytes.Equal(h.Sum(nil), want[:]) {
+		t.Errorf("Hash sum = %x, want %x", h.Sum(nil), want)
+	}
+
+	f.Close()
+	if _, err := f.Hash(sha256.New()); !errors.Is(err, ErrClosed) {
+		t.Errorf("Hash after Close: got %v, want ErrClosed", err)
+	}
+}
+
+func TestRecords(t *testing.T) {
+	const recordSize = 12
+
+	// records of a big-endian uint32 id followed by an 8-byte name
+	path := filepath.Join(t.TempDir(), "records.idx")
+	var content []byte
+	for i := range 100 {
+		content = binary.BigEndian.AppendUint32(content, uint32(i*10))
+		content = fmt.Appendf(content, "rec%05d", i)
+	}
+	if err := os.WriteFile(path, content, 0644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+
+	f, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer f.Close()
+
+	count := 0
+	err = f.Records(recordSize, func(index int, rec []byte) bool {
+		if index != count {
+			t.Errorf("index = %d, want %d", index, count)
+		}
+		if len(rec) != recordSize || cap(rec) != recordSize {
+			t.Errorf("record %d has len %d, cap %d; want %d", index, len(rec), cap(rec), recordSize)
+		}
+		if id := binary.BigEndian.Uint32(rec); id != uint32(index*10) {
+			t.Errorf("record %d id = %d, want %d", index, id, index*10)
+		}
+		if name, want := string(rec[4:]), fmt.Sprintf("rec%05d", index); name != want {
+			t.Errorf("record %d name = %q, want %q", index, name, want)
+		}
+		count++
+		return true
+	})
+	if err != nil {
+		t.Fatalf("Records failed: %v", err)
+	}
+	if count != 100 {
+		t.Errorf("yielded %d records, want 100", count)
+	}
+
+	t.Run("stop early", func(t *testing.T) {
+		count := 0
+		if err := f.Records(recordSize, func(int, []byte) bool {
+			count++
+			return count < 3
+		}); err != nil {
+			t.Fatalf("Records failed: %v", err)
+		}
+		if count != 3 {
+			t.Errorf("yielded %d records, want 3", count)
+		}
+	})
+
+	t.Run("partial record", func(t *testing.T) {
+		called := false
+		err := f.Records(7, func(int, []byte) bool {
+			called = true
+			return true
+		})
+		if !errors.Is(err, ErrPartialRecord) {
+			t.Errorf("got %v, want ErrPartialRecord", err)
+		}
+		if called {
+			t.Error("yield was called despite a partial record")
+		}
+	})
+
+	t.Run("invalid size", func(t *testing.T) {
+		if err := f.Records(0, func(int, []byte) bool { return true }); err == nil {
+			t.Error("Records should fail for a zero record size")
+		}
+	})
+}
+
+func TestNotRegularFile(t *testing.T) {
+	t.Run("directory", func(t *testing.T) {
+		if _, err := Open(t.TempDir()); !errors.Is(err, ErrNotRegularFile) {
+			t.Errorf("got %v, want ErrNotRegularFile", err)
+		}
+		if _, err := OpenFileWith(t.TempDir(), os.O_RDONLY, 0, 0, WithAllowSpecial()); !errors.Is(err, ErrNotRegularFile) {
+			t.Errorf("with WithAllowSpecial: got %v, want ErrNotRegularFile", err)
+		}
+	})
+
+	t.Run("device", func(t *testing.T) {
+		if runtime.GOOS == "windows" {
+			t.Skip("no /dev/null on Windows")
+		}
+		if _, err := os.Stat("/dev/null"); err != nil {
+			t.Skipf("/dev/null not available: %v", err)
+		}
+
+		if _, err := Open("/dev/null"); !errors.Is(err, ErrNotRegularFile) {
+			t.Errorf("got %v, want ErrNotRegularFile", err)
+		}
+
+		file, err := os.Open("/dev/null")
+		if err != nil {
+			t.Fatalf("Open failed: %v", err)
+		}
+		defer file.Close()
+
+		if _, err := NewFromFile(file, false); !errors.Is(err, ErrNotRegularFile) {
+			t.Errorf("NewFromFile: got %v, want ErrNotRegularFile", err)
+		}
+	})
+
+	t.Run("allow special", func(t *testing.T) {
+		if !nativeMapping || runtime.GOOS != "linux" {
+			t.Skip("mapping /dev/zero requires Linux")
+		}
+
+		f, err := OpenFileWith("/dev/zero", os.O_RDWR, 0, 4096, WithAllowSpecial(), WithPrivate())
+		if err != nil {
+			t.Fatalf("OpenFileWith failed: %v", err)
+		}
+		defer f.Close()
+
+		if f.Len() != 4096 {
+			t.Errorf("Len() = %d, want 4096", f.Len())
+		}
+		if _, err := f.WriteAt([]byte("scratch"), 0); err != nil {
+			t.Errorf("WriteAt failed: %v", err)
+		}
+	})
+}
+
+func TestWithZeroFillReads(t *testing.T) {
+	pageSize := os.Getpagesize()
+
+	path := filepath.Join(t.TempDir(), "arena.bin")
+	if err := os.WriteFile(path, []byte("written"), 0644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+
+	t.Run("default", func(t *testing.T) {
+		f, err := Open(path)
+		if err != nil {
+			t.Fatalf("Open failed: %v", err)
+		}
+		defer f.Close()
+
+		buf := make([]byte, 16)
+		if n, err := f.ReadAt(buf, 0); n != 7 || err != io.EOF {
+			t.Errorf("ReadAt across the end = %d, %v; want 7, io.EOF", n, err)
+		}
+		if _, err := f.ReadAt(buf, 100); err != io.EOF {
+			t.Errorf("ReadAt past the end: got %v, want io.EOF", err)
+		}
+	})
+
+	t.Run("zero fill", func(t *testing.T) {
+		f, err := OpenFileWith(path, os.O_RDONLY, 0, 0, WithZeroFillReads())
+		if err != nil {
+			t.Fatalf("OpenFileWith failed: %v", err)
+		}
+		defer f.Close()
+
+		if f.Len() != 7 {
+			t.Errorf("Len() = %d, want 7", f.Len())
+		}
+
+		buf := bytes.Repeat([]byte{0xFF}, 16)
+		n, err := f.ReadAt(buf, 0)
+		if n != 16 || err != nil {
+			t.Errorf("ReadAt across the end = %d, %v; want 16, nil", n, err)
+		}
+		if want := append([]byte("written"), make([]byte, 9)...); !bytes.Equal(buf, want) {
+			t.Errorf("ReadAt = %q, want %q", buf, want)
+		}
+
+		buf = bytes.Repeat([]byte{0xFF}, 16)
+		if n, err := f.ReadAt(buf, 100); n != 16 || err != nil || !bytes.Equal(buf, make([]byte, 16)) {
+			t.Errorf("ReadAt past the end = %q, %d, %v; want zeros, 16, nil", buf, n, err)
+		}
+
+		// the capacity of the mapping is the end of the page
+		n, err = f.ReadAt(buf, int64(pageSize-10))
+		if n != 10 || err != io.EOF {
+			t.Errorf("ReadAt across the capacity = %d, %v; want 10, io.EOF", n, err)
+		}
+		if _, err := f.ReadAt(buf, int64(pageSize)); err != io.EOF {
+			t.Errorf("ReadAt at the capacity: got %v, want io.EOF", err)
+		}
+
+		data, err := io.ReadAll(f)
+		if err != nil {
+			t.Fatalf("ReadAll failed: %v", err)
+		}
+		if len(data) != pageSize || string(data[:7]) != "written" {
+			t.Errorf("Read consumed %d bytes starting %q, want %d starting %q", len(data), data[:min(7, len(data))], pageSize, "written")
+		}
+	})
+}
+
+func TestPages(t *testing.T) {
+	pageSize := PageSize()
+	if pageSize <= 0 || pageSize&(pageSize-1) != 0 {
+		t.Fatalf("PageSize() = %d, want a positive power of two", pageSize)
+	}
+
+	for _, size := range []int{0, 1, pageSize - 1, pageSize, pageSize + 1, 3 * pageSize} {
+		path := filepath.Join(t.TempDir(), fmt.Sprintf("pages_%d.bin", size))
+		if err := os.WriteFile(path, make([]byte, size), 0644); err != nil {
+			t.Fatalf("WriteFile failed: %v", err)
+		}
+
+		f, err := Open(path)
+		if err != nil {
+			t.Fatalf("Open failed: %v", err)
+		}
+
+		want := int(math.Ceil(float64(f.Len()) / float64(pageSize)))
+		if got := f.Pages(); got != want {
+			t.Errorf("Pages() for %d bytes = %d, want %d", size, got, want)
+		}
+
+		f.Close()
+	}
+}
+
+func TestTruncateGrow(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "resize.bin")
+	if err := os.WriteFile(path, []byte("0123456789"), 0644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+
+	f, err := OpenFile(path, os.O_RDWR, 0, 0)
+	if err != nil {
+		t.Fatalf("OpenFile failed: %v", err)
+	}
+	defer f.Close()
+
+	gen := f.Generation()
+	if err := f.Grow(5); err != nil {
+		t.Fatalf("Grow failed: %v", err)
+	}
+	if f.Len() != 15 {
+		t.Errorf("Len() after Grow = %d, want 15", f.Len())
+	}
+	if !bytes.Equal(f.Bytes(), append([]byte("0123456789"), make([]byte, 5)...)) {
+		t.Errorf("Bytes() after Grow = %q", f.Bytes())
+	}
+	if f.Generation() == gen {
+		t.Error("Generation() was not incremented by Grow")
+	}
+
+	if _, err := f.WriteAt([]byte("ABCDE"), 10); err != nil {
+		t.Fatalf("WriteAt into grown region failed: %v", err)
+	}
+
+	if err := f.Truncate(12); err != nil {
+		t.Fatalf("Truncate failed: %v", err)
+	}
+	if string(f.Bytes()) != "0123456789AB" {
+		t.Errorf("Bytes() after Truncate = %q, want %q", f.Bytes(), "0123456789AB")
+	}
+
+	gen = f.Generation()
+	if err := f.Truncate(12); err != nil {
+		t.Fatalf("Truncate to the same size failed: %v", err)
+	}
+	if f.Generation() != gen {
+		t.Error("Generation() changed without a remap")
+	}
+
+	if err := f.Truncate(0); err != nil {
+		t.Fatalf("Truncate to zero failed: %v", err)
+	}
+	if f.Len() != 0 {
+		t.Errorf("Len() after Truncate(0) = %d, want 0", f.Len())
+	}
+	if err := f.Grow(3); err != nil {
+		t.Fatalf("Grow from empty failed: %v", err)
+	}
+	if _, err := f.WriteAt([]byte("xyz"), 0); err != nil {
+		t.Fatalf("WriteAt failed: %v", err)
+	}
+
+	if err := f.Sync(); err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("ReadFile failed: %v", err)
+	}
+	if string(data) != "xyz" {
+		t.Errorf("file content = %q, want %q", data, "xyz")
+	}
+
+	t.Run("invalid", func(t *testing.T) {
+		if err := f.Truncate(-1); !errors.Is(err, ErrNegativeOffset) {
+			t.Errorf("Truncate(-1): got %v, want ErrNegativeOffset", err)
+		}
+		if err := f.Grow(-1); !errors.Is(err, ErrNegativeCount) {
+			t.Errorf("Grow(-1): got %v, want ErrNegativeCount", err)
+		}
+		if err := f.Grow(math.MaxInt64); !errors.Is(err, ErrOffsetTooLarge) {
+			t.Errorf("Grow(MaxInt64): got %v, want ErrOffsetTooLarge", err)
+		}
+	})
+
+	t.Run("read-only", func(t *testing.T) {
+		ro, err := Open(path)
+		if err != nil {
+			t.Fatalf("Open failed: %v", err)
+		}
+		defer ro.Close()
+
+		if err := ro.Grow(1); !errors.Is(err, ErrReadOnly) {
+			t.Errorf("got %v, want ErrReadOnly", err)
+		}
+	})
+}
+
+func TestResizeConcurrent(t *testing.T) {
+	if runtime.GOARCH == "wasm" {
+		t.Skip("the busy workers starve the resizer without goroutine preemption")
+	}
+
+	pageSize := int64(PageSize())
+
+	path := filepath.Join(t.TempDir(), "concurrent.bin")
+	f, err := OpenFile(path, os.O_RDWR|os.O_CREATE, 0644, pageSize)
+	if err != nil {
+		t.Fatalf("OpenFile failed: %v", err)
+	}
+	defer f.Close()
+
+	// one goroutine keeps remapping the file while others sync, read, and
+	// write it; every operation must see either the old or the new mapping
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer close(done)
+
+		for i := range 200 {
+			var err error
+			if i%2 == 0 {
+				err = f.Grow(4 * pageSize)
+			} else {
+				err = f.Truncate(pageSize)
+			}
+			if err != nil {
+				t.Errorf("resize failed: %v", err)
+				return
+			}
+		}
+	}()
+
+	worker := func(op func() error) {
+		defer wg.Done()
+
+		for {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			if err := op(); err != nil {
+				t.Error(err)
+				return
+			}
+		}
+	}
+
+	wg.Add(4)
+	go worker(f.Sync)
+	go worker(f.SyncMeta)
+	buf := make([]byte, 2*pageSize)
+	go worker(func() error {
+		if _, err := f.ReadAt(buf, pageSize/2); err != nil && err != io.EOF {
+			return fmt.Errorf("ReadAt failed: %w", err)
+		}
+		return nil
+	})
+	go worker(func() error {
+		if _, err := f.WriteAt([]byte("data"), pageSize-4); err != nil {
+			return fmt.Errorf("WriteAt failed: %w", err)
+		}
+		if err := f.Prefetch(0, 0); err != nil {
+			return fmt.Errorf("Prefetch failed: %w", err)
+		}
+		return nil
+	})
+
+	wg.Wait()
+}
+
+func TestWriteAtIfChanged(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cdc.txt")
+	if err := os.WriteFile(path, []byte("hello world"), 0644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+
+	f, err := OpenFile(path, os.O_RDWR, 0, 0)
+	if err != nil {
+		t.Fatalf("OpenFile failed: %v", err)
+	}
+	defer f.Close()
+
+	tests := []struct {
+		name        string
+		data        string
+		off         int64
+		wantChanged bool
+		wantN       int
+		wantErr     error
+		wantDirty   bool
+	}{
+		{"identical", "world", 6, false, 5, nil, false},
+		{"identical past end", "world!", 6, false, 5, ErrWriteOutOfBounds, false},
+		{"out of bounds", "x", 11, false, 0, ErrWriteOutOfBounds, false},
+		{"negative offset", "x", -1, false, 0, ErrNegativeOffset, false},
+		{"differing", "WORLD", 6, true, 5, nil, true},
+		{"identical tail past end", "Dx", 10, false, 1, ErrWriteOutOfBounds, false},
+		{"differing tail past end", "dx", 10, true, 1, ErrWriteOutOfBounds, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f.dirty.Store(false)
+			before := f.Stats()
+
+			changed, n, err := f.WriteAtIfChanged([]byte(tt.data), tt.off)
+			if changed != tt.wantChanged || n != tt.wantN || err != tt.wantErr {
+				t.Errorf("WriteAtIfChanged(%q, %d) = %v, %d, %v; want %v, %d, %v",
+					tt.data, tt.off, changed, n, err, tt.wantChanged, tt.wantN, tt.wantErr)
+			}
+			if f.dirty.Load() != tt.wantDirty {
+				t.Errorf("dirty = %v, want %v", f.dirty.Load(), tt.wantDirty)
+			}
+
+			// only a change is counted as a write
+			var wantBytes int64
+			if tt.wantChanged {
+				wantBytes = int64(tt.wantN)
+			}
+			if got := f.Stats().BytesWritten - before.BytesWritten; got != wantBytes {
+				t.Errorf("BytesWritten grew by %d, want %d", got, wantBytes)
+			}
+		})
+	}
+
+	if got := string(f.Bytes()); got != "hello WORLd" {
+		t.Errorf("Bytes() = %q, want %q", got, "hello WORLd")
+	}
+
+	t.Run("unchanged write keeps the high-water mark", func(t *testing.T) {
+		g, err := OpenFile(filepath.Join(t.TempDir(), "hw.bin"), os.O_RDWR|os.O_CREATE, 0644, 16)
+		if err != nil {
+			t.Fatalf("OpenFile failed: %v", err)
+		}
+		defer g.Close()
+
+		if changed, _, err := g.WriteAtIfChanged(make([]byte, 8), 8); changed || err != nil {
+			t.Fatalf("WriteAtIfChanged of zeros = %v, %v, want false, nil", changed, err)
+		}
+		if hw := g.HighWater(); hw != 0 {
+			t.Errorf("HighWater() = %d after an unchanged write, want 0", hw)
+		}
+	})
+}
+
+func TestHighWater(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "highwater.bin")
+
+	f, err := OpenFile(path, os.O_RDWR|os.O_CREATE, 0644, 100)
+	if err != nil {
+		t.Fatalf("OpenFile failed: %v", err)
+	}
+	defer f.Close()
+
+	if hw := f.HighWater(); hw != 0 {
+		t.Errorf("HighWater() of a new file = %d, want 0", hw)
+	}
+
+	tests := []struct {
+		off    int64
+		data   string
+		wantN  int
+		wantHW int64
+	}{
+		{40, "later", 5, 45},
+		{10, "earlier", 7, 45}, // out of order, below the mark
+		{45, "next", 4, 49},
+		{0, "", 0, 49},
+		{98, "past end", 2, 100}, // only the bytes that fit count
+	}
+
+	for _, tt := range tests {
+		n, hw, err := f.WriteAtHW([]byte(tt.data), tt.off)
+		if err != nil && err != ErrWriteOutOfBounds {
+			t.Fatalf("WriteAtHW(%q, %d) failed: %v", tt.data, tt.off, err)
+		}
+		if n != tt.wantN || hw != tt.wantHW {
+			t.Errorf("WriteAtHW(%q, %d) = %d, %d; want %d, %d", tt.data, tt.off, n, hw, tt.wantN, tt.wantHW)
+		}
+	}
+
+	if err := f.Truncate(60); err != nil {
+		t.Fatalf("Truncate failed: %v", err)
+	}
+	if hw := f.HighWater(); hw != 60 {
+		t.Errorf("HighWater() after Truncate = %d, want 60", hw)
+	}
+
+	// other writes raise the mark too
+	f.Seek(0, io.SeekStart)
+	f.Write([]byte("head"))
+	f.WriteAtv([][]byte{[]byte("ab"), []byte("cd")}, 56)
+	if hw := f.HighWater(); hw != 60 {
+		t.Errorf("HighWater() = %d, want 60", hw)
+	}
+}
+
+func TestWithBytes(t *testing.T) {
+	pageSize := int64(PageSize())
+
+	path := filepath.Join(t.TempDir(), "withbytes.bin")
+	f, err := OpenFile(path, os.O_RDWR|os.O_CREATE, 0644, pageSize)
+	if err != nil {
+		t.Fatalf("OpenFile failed: %v", err)
+	}
+	defer f.Close()
+
+	// fn sees a consistent slice while another goroutine keeps growing the
+	// file; run with -race to catch accesses to an unmapped slice
+	var wg sync.WaitGroup
+	wg.Go(func() {
+		for range 50 {
+			if err := f.Grow(pageSize); err != nil {
+				t.Errorf("Grow failed: %v", err)
+				return
+			}
+		}
+	})
+
+	for range 4 {
+		wg.Go(func() {
+			for range 200 {
+				err := f.WithBytes(func(b []byte) error {
+					if int64(len(b))%pageSize != 0 {
+						return fmt.Errorf("len(b) = %d, want a multiple of %d", len(b), pageSize)
+					}
+					if b[len(b)-1] != 0 {
+						return fmt.Errorf("last byte = %d, want 0", b[len(b)-1])
+					}
+					return nil
+				})
+				if err != nil {
+					t.Errorf("WithBytes failed: %v", err)
+					return
+				}
+			}
+		})
+	}
+	wg.Wait()
+
+	errStop := errors.New("stop")
+	if err := f.WithBytes(func([]byte) error { return errStop }); err != errStop {
+		t.Errorf("WithBytes returned %v, want the error of fn", err)
+	}
+
+	f.Close()
+	if err := f.WithBytes(func([]byte) error { return nil }); err != ErrClosed {
+		t.Errorf("WithBytes after Close: got %v, want ErrClosed", err)
+	}
+}
+
+func TestDecompressSection(t *testing.T) {
+	payload := bytes.Repeat([]byte("compressible payload "), 100)
+
+	var comp bytes.Buffer
+	zw := gzip.NewWriter(&comp)
+	if _, err := zw.Write(payload); err != nil {
+		t.Fatalf("gzip Write failed: %v", err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("gzip Close failed: %v", err)
+	}
+
+	header := []byte("HDR:")
+	content := append(append(append([]byte{}, header...), comp.Bytes()...), "TRAILER"...)
+	path := filepath.Join(t.TempDir(), "container.bin")
+	if err := os.WriteFile(path, content, 0644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+
+	f, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer f.Close()
+
+	off, compLen := int64(len(header)), int64(comp.Len())
+
+	r, err := f.DecompressSection(off, compLen, Gzip)
+	if err != nil {
+		t.Fatalf("DecompressSection failed: %v", err)
+	}
+	got, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("ReadAll failed: %v", err)
+	}
+	if !bytes.Equal(got, payload) {
+		t.Errorf("decompressed %d bytes, want %d matching bytes", len(got), len(payload))
+	}
+
+	t.Run("corrupt", func(t *testing.T) {
+		if _, err := f.DecompressSection(0, compLen, Gzip); !errors.Is(err, gzip.ErrHeader) {
+			t.Errorf("got %v, want gzip.ErrHeader", err)
+		}
+	})
+
+	t.Run("out of range", func(t *testing.T) {
+		if _, err := f.DecompressSection(off, int64(f.Len()), Gzip); !errors.Is(err, ErrOutOfRange) {
+			t.Errorf("got %v, want ErrOutOfRange", err)
+		}
+		if _, err := f.DecompressSection(-1, compLen, Gzip); !errors.Is(err, ErrNegativeOffset) {
+			t.Errorf("got %v, want ErrNegativeOffset", err)
+		}
+	})
+
+	t.Run("unregistered", func(t *testing.T) {
+		if _, err := f.DecompressSection(off, compLen, Compression(255)); !errors.Is(err, ErrUnsupported) {
+			t.Errorf("got %v, want ErrUnsupported", err)
+		}
+	})
+
+	t.Run("custom", func(t *testing.T) {
+		const identity Compression = 200
+		RegisterDecompressor(identity, func(r io.Reader) (io.Reader, error) { return r, nil })
+		defer RegisterDecompressor(identity, nil)
+
+		r, err := f.DecompressSection(0, int64(len(header)), identity)
+		if err != nil {
+			t.Fatalf("DecompressSection failed: %v", err)
+		}
+		got, _ := io.ReadAll(r)
+		if !bytes.Equal(got, header) {
+			t.Errorf("got %q, want %q", got, header)
+		}
+	})
+}
+
+func TestWithGrowIncrement(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "grow.bin")
+
+	f, err := OpenFileWith(path, os.O_RDWR|os.O_CREATE, 0644, 0, WithGrowIncrement(100))
+	if err != nil {
+		t.Fatalf("OpenFileWith failed: %v", err)
+	}
+	defer f.Close()
+
+	if _, err := f.Write([]byte("hello")); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	if f.Len() != 5 || f.Capacity() != 105 {
+		t.Errorf("Len(), Capacity() = %d, %d; want 5, 105", f.Len(), f.Capacity())
+	}
+	gen := f.Generation()
+
+	// writes within the headroom do not remap
+	if _, err := f.WriteString(", world"); err != nil {
+		t.Fatalf("WriteString failed: %v", err)
+	}
+	if _, err := f.WriteAt([]byte("!"), 20); err != nil {
+		t.Fatalf("WriteAt failed: %v", err)
+	}
+	if f.Len() != 21 || f.Capacity() != 105 {
+		t.Errorf("Len(), Capacity() = %d, %d; want 21, 105", f.Len(), f.Capacity())
+	}
+	if f.Generation() != gen {
+		t.Error("write within capacity remapped the file")
+	}
+	want := append([]byte("hello, world"), make([]byte, 9)...)
+	want[20] = '!'
+	if got := f.Bytes(); !bytes.Equal(got, want) || cap(got) != len(got) {
+		t.Errorf("Bytes() = %q (cap %d), want %q", got, cap(got), want)
+	}
+
+	// a write past the capacity remaps, with fresh headroom
+	if _, err := f.WriteAtv([][]byte{[]byte("ab"), []byte("cd")}, 200); err != nil {
+		t.Fatalf("WriteAtv failed: %v", err)
+	}
+	if f.Len() != 204 || f.Capacity() != 304 {
+		t.Errorf("Len(), Capacity() = %d, %d; want 204, 304", f.Len(), f.Capacity())
+	}
+	if f.Generation() == gen {
+		t.Error("write past capacity did not remap the file")
+	}
+
+	if _, err := f.ReadAt(make([]byte, 1), 204); err != io.EOF {
+		t.Errorf("ReadAt past Len: got %v, want io.EOF", err)
+	}
+
+	if err := f.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("ReadFile failed: %v", err)
+	}
+	if len(data) != 204 || string(data[200:]) != "abcd" {
+		t.Errorf("file after Close has %d bytes ending in %q, want 204 ending in %q", len(data), data[200:], "abcd")
+	}
+
+	t.Run("Truncate drops headroom", func(t *testing.T) {
+		f, err := OpenFileWith(path, os.O_RDWR, 0, 0, WithGrowIncrement(1<<10))
+		if err != nil {
+			t.Fatalf("OpenFileWith failed: %v", err)
+		}
+		defer f.Close()
+
+		if _, err := f.WriteAt([]byte("x"), 204); err != nil {
+			t.Fatalf("WriteAt failed: %v", err)
+		}
+		if err := f.Truncate(int64(f.Len())); err != nil {
+			t.Fatalf("Truncate failed: %v", err)
+		}
+		if f.Capacity() != 205 {
+			t.Errorf("Capacity() = %d, want 205", f.Capacity())
+		}
+		if fi, err := os.Stat(path); err != nil || fi.Size() != 205 {
+			t.Errorf("file size = %v (%v), want 205", fi.Size(), err)
+		}
+	})
+
+	t.Run("without option", func(t *testing.T) {
+		f, err := OpenFile(path, os.O_RDWR, 0, 0)
+		if err != nil {
+			t.Fatalf("OpenFile failed: %v", err)
+		}
+		defer f.Close()
+
+		if f.Capacity() != int64(f.Len()) {
+			t.Errorf("Capacity() = %d, want Len() = %d", f.Capacity(), f.Len())
+		}
+		if _, err := f.WriteAt([]byte("x"), int64(f.Len())); !errors.Is(err, ErrWriteOutOfBounds) {
+			t.Errorf("got %v, want ErrWriteOutOfBounds", err)
+		}
+	})
+
+	t.Run("private", func(t *testing.T) {
+		f, err := OpenFileWith(path, os.O_RDWR, 0, 0, WithPrivate(), WithGrowIncrement(100))
+		if err != nil {
+			t.Fatalf("OpenFileWith failed: %v", err)
+		}
+		defer f.Close()
+
+		if _, err := f.WriteAt([]byte("x"), int64(f.Len())); !errors.Is(err, ErrUnsupported) {
+			t.Errorf("got %v, want ErrUnsupported", err)
+		}
+	})
+}
+
+func TestSetLen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "setlen.bin")
+	f, err := OpenFile(path, os.O_RDWR|os.O_CREATE, 0644, 64)
+	if err != nil {
+		t.Fatalf("OpenFile failed: %v", err)
+	}
+	defer f.Close()
+
+	if _, err := f.WriteAt([]byte("meaningful data"), 0); err != nil {
+		t.Fatalf("WriteAt failed: %v", err)
+	}
+	v, err := f.View(10, 20)
+	if err != nil {
+		t.Fatalf("View failed: %v", err)
+	}
+	gen := f.Generation()
+
+	if err := f.SetLen(15); err != nil {
+		t.Fatalf("SetLen failed: %v", err)
+	}
+	if f.Generation() == gen {
+		t.Error("shrinking with SetLen did not increment Generation")
+	}
+	if _, err := v.Bytes(0, 20); !errors.Is(err, ErrStaleView) {
+		t.Errorf("View.Bytes past the new length: got %v, want ErrStaleView", err)
+	}
+	if f.Len() != 15 {
+		t.Errorf("Len() = %d, want 15", f.Len())
+	}
+	if f.Capacity() != 64 {
+		t.Errorf("Capacity() = %d, want 64", f.Capacity())
+	}
+	if got := string(f.Bytes()); got != "meaningful data" {
+		t.Errorf("Bytes() = %q, want %q", got, "meaningful data")
+	}
+
+	var buf bytes.Buffer
+	if n, err := f.WriteTo(&buf); n != 15 || err != nil {
+		t.Errorf("WriteTo() = %d, %v, want 15, nil", n, err)
+	}
+	if buf.String() != "meaningful data" {
+		t.Errorf("WriteTo wrote %q, want %q", buf.String(), "meaningful data")
+	}
+
+	if off, err := f.Seek(0, io.SeekEnd); off != 15 || err != nil {
+		t.Errorf("Seek(0, io.SeekEnd) = %d, %v, want 15, nil", off, err)
+	}
+	if _, err := f.ReadAt(make([]byte, 1), 15); err != io.EOF {
+		t.Errorf("ReadAt at the logical end: got %v, want io.EOF", err)
+	}
+	if _, err := f.WriteAt([]byte("x"), 15); !errors.Is(err, ErrWriteOutOfBounds) {
+		t.Errorf("WriteAt past the logical end: got %v, want ErrWriteOutOfBounds", err)
+	}
+
+	// the file and the rest of the mapping are left alone
+	fi, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("Stat failed: %v", err)
+	}
+	if fi.Size() != 64 {
+		t.Errorf("file size after SetLen = %d, want 64", fi.Size())
+	}
+	if err := f.SetLen(64); err != nil {
+		t.Fatalf("SetLen back to the capacity failed: %v", err)
+	}
+	if f.Len() != 64 || string(f.Bytes()[:15]) != "meaningful data" {
+		t.Errorf("after extending, Len() = %d, Bytes() = %q", f.Len(), f.Bytes()[:15])
+	}
+
+	if err := f.SetLen(65); !errors.Is(err, ErrOutOfRange) {
+		t.Errorf("SetLen past the capacity: got %v, want ErrOutOfRange", err)
+	}
+	if err := f.SetLen(-1); !errors.Is(err, ErrNegativeCount) {
+		t.Errorf("SetLen negative: got %v, want ErrNegativeCount", err)
+	}
+}
+
+func TestFindAll(t *testing.T) {
+	content := "abcXYZdefXYZXYZghiXYXYZ"
+	path := filepath.Join(t.TempDir(), "corpus.txt")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+
+	f, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer f.Close()
+
+	tests := []struct {
+		pattern string
+		n       int
+		want    []int64
+	}{
+		{"XYZ", -1, []int64{3, 9, 12, 20}},
+		{"XYZ", 2, []int64{3, 9}},
+		{"XYZ", 0, nil},
+		{"abc", -1, []int64{0}},
+		{"YXY", -1, []int64{19}},
+		{"nope", -1, nil},
+		{"", -1, nil},
+		{content + "!", -1, nil},
+	}
+
+	for _, tt := range tests {
+		got, err := f.FindAll([]byte(tt.pattern), tt.n)
+		if err != nil {
+			t.Fatalf("FindAll(%q, %d) failed: %v", tt.pattern, tt.n, err)
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("FindAll(%q, %d) = %v, want %v", tt.pattern, tt.n, got, tt.want)
+		}
+	}
+
+	t.Run("non-overlapping", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "aaaa.txt")
+		if err := os.WriteFile(path, []byte("aaaaa"), 0644); err != nil {
+			t.Fatalf("WriteFile failed: %v", err)
+		}
+
+		f, err := Open(path)
+		if err != nil {
+			t.Fatalf("Open failed: %v", err)
+		}
+		defer f.Close()
+
+		got, _ := f.FindAll([]byte("aa"), -1)
+		if want := []int64{0, 2}; !slices.Equal(got, want) {
+			t.Errorf("FindAll = %v, want %v", got, want)
+		}
+	})
+}
+
+func TestCreateEmpty(t *testing.T) {
+	dir := t.TempDir()
+
+	t.Run("without growth", func(t *testing.T) {
+		path := filepath.Join(dir, "new.bin")
+		if _, err := OpenFile(path, os.O_RDWR|os.O_CREATE, 0644, 0); !errors.Is(err, ErrInvalidSize) {
+			t.Errorf("got %v, want ErrInvalidSize", err)
+		}
+		if _, err := os.Stat(path); !errors.Is(err, fs.ErrNotExist) {
+			t.Errorf("rejected open created the file: %v", err)
+		}
+
+		if err := os.WriteFile(path, nil, 0644); err != nil {
+			t.Fatalf("WriteFile failed: %v", err)
+		}
+		if _, err := OpenFile(path, os.O_RDWR|os.O_CREATE, 0644, 0); !errors.Is(err, ErrInvalidSize) {
+			t.Errorf("existing empty file: got %v, want ErrInvalidSize", err)
+		}
+	})
+
+	t.Run("existing non-empty", func(t *testing.T) {
+		path := filepath.Join(dir, "existing.bin")
+		if err := os.WriteFile(path, []byte("data"), 0644); err != nil {
+			t.Fatalf("WriteFile failed: %v", err)
+		}
+
+		f, err := OpenFile(path, os.O_RDWR|os.O_CREATE, 0644, 0)
+		if err != nil {
+			t.Fatalf("OpenFile failed: %v", err)
+		}
+		defer f.Close()
+
+		if f.Len() != 4 {
+			t.Errorf("Len() = %d, want 4", f.Len())
+		}
+	})
+
+	t.Run("read-only", func(t *testing.T) {
+		f, err := OpenFile(filepath.Join(dir, "readonly.bin"), os.O_RDONLY|os.O_CREATE, 0644, 0)
+		if err != nil {
+			t.Fatalf("OpenFile failed: %v", err)
+		}
+		f.Close()
+	})
+
+	t.Run("with growth", func(t *testing.T) {
+		path := filepath.Join(dir, "growable.bin")
+
+		f, err := OpenFileWith(path, os.O_RDWR|os.O_CREATE, 0644, 0, WithGrowIncrement(64))
+		if err != nil {
+			t.Fatalf("OpenFileWith failed: %v", err)
+		}
+		if f.Len() != 0 {
+			t.Errorf("Len() = %d, want 0", f.Len())
+		}
+
+		if _, err := f.Write([]byte("first write")); err != nil {
+			t.Fatalf("Write failed: %v", err)
+		}
+		if err := f.Close(); err != nil {
+			t.Fatalf("Close failed: %v", err)
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatalf("ReadFile failed: %v", err)
+		}
+		if string(data) != "first write" {
+			t.Errorf("file content = %q, want %q", data, "first write")
+		}
+	})
+}
+
+func TestWithShared(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "shared.bin")
+	if err := os.WriteFile(path, []byte("contended"), 0644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+
+	f, err := OpenFileWith(path, os.O_RDWR, 0, 0, WithShared(false))
+	if !nativeMapping {
+		if !errors.Is(err, ErrUnsupported) {
+			t.Errorf("got %v, want ErrUnsupported", err)
+		}
+		return
+	}
+	if err != nil {
+		t.Fatalf("OpenFileWith failed: %v", err)
+	}
+
+	if ok, err := f.IsExclusive(); !ok || err != nil {
+		t.Errorf("IsExclusive() = %v, %v; want true, nil", ok, err)
+	}
+
+	if _, err := OpenFileWith(path, os.O_RDWR, 0, 0, WithShared(false)); !errors.Is(err, ErrLocked) {
+		t.Errorf("second exclusive open: got %v, want ErrLocked", err)
+	}
+
+	// only Windows enforces the lock against plain opens
+	g, err := Open(path)
+	if runtime.GOOS == "windows" {
+		if err == nil {
+			g.Close()
+			t.Error("shared open of an exclusively opened file should fail on Windows")
+		}
+	} else if err != nil {
+		t.Errorf("shared open failed: %v", err)
+	} else {
+		if ok, _ := g.IsExclusive(); ok {
+			t.Error("IsExclusive() = true for a shared open")
+		}
+		g.Close()
+	}
+
+	if err := f.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	if _, err := f.IsExclusive(); !errors.Is(err, ErrClosed) {
+		t.Errorf("IsExclusive after Close: got %v, want ErrClosed", err)
+	}
+
+	f, err = OpenFileWith(path, os.O_RDONLY, 0, 0, WithShared(false))
+	if err != nil {
+		t.Fatalf("exclusive open after Close failed: %v", err)
+	}
+	f.Close()
+}
+
+func TestReadStringN(t *testing.T) {
+	// a length-prefixed record: 5, "hello", 3, "abc"
+	path := filepath.Join(t.TempDir(), "tlv.bin")
+	if err := os.WriteFile(path, []byte("\x05hello\x03abc"), 0644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+
+	f, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer f.Close()
+
+	var got []string
+	for _, read := range []func(int) (string, error){f.ReadStringN, f.ReadStringNCopy} {
+		var n [1]byte
+		if _, err := f.Read(n[:]); err != nil {
+			t.Fatalf("Read failed: %v", err)
+		}
+
+		s, err := read(int(n[0]))
+		if err != nil {
+			t.Fatalf("read(%d) failed: %v", n[0], err)
+		}
+		got = append(got, s)
+	}
+	if want := []string{"hello", "abc"}; !slices.Equal(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	if s, err := f.ReadStringN(1); s != "" || err != io.EOF {
+		t.Errorf("ReadStringN at EOF = %q, %v; want \"\", io.EOF", s, err)
+	}
+
+	t.Run("short", func(t *testing.T) {
+		f.Seek(7, io.SeekStart)
+		if _, err := f.ReadStringN(4); err != io.ErrUnexpectedEOF {
+			t.Errorf("got %v, want io.ErrUnexpectedEOF", err)
+		}
+		if _, err := f.ReadStringNCopy(4); err != io.ErrUnexpectedEOF {
+			t.Errorf("copy: got %v, want io.ErrUnexpectedEOF", err)
+		}
+		if off, _ := f.Seek(0, io.SeekCurrent); off != 7 {
+			t.Errorf("offset after short read = %d, want 7", off)
+		}
+	})
+
+	t.Run("zero and negative", func(t *testing.T) {
+		if s, err := f.ReadStringN(0); s != "" || err != nil {
+			t.Errorf("ReadStringN(0) = %q, %v; want \"\", nil", s, err)
+		}
+		if _, err := f.ReadStringN(-1); !errors.Is(err, ErrNegativeCount) {
+			t.Errorf("got %v, want ErrNegativeCount", err)
+		}
+	})
+}
+
+func TestSyncThrottled(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "throttled.log")
+
+	f, err := OpenFile(path, os.O_RDWR|os.O_CREATE, 0644, 64)
+	if err != nil {
+		t.Fatalf("OpenFile failed: %v", err)
+	}
+	defer f.Close()
+
+	if _, err := f.Write([]byte("record 1")); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	if err := f.SyncThrottled(time.Hour); err != nil {
+		t.Fatalf("first SyncThrottled failed: %v", err)
+	}
+	first := f.lastSync.Load()
+	if first == 0 {
+		t.Fatal("first SyncThrottled did not flush")
+	}
+
+	if _, err := f.Write([]byte("record 2")); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	if err := f.SyncThrottled(time.Hour); err != nil {
+		t.Fatalf("throttled SyncThrottled failed: %v", err)
+	}
+	if f.lastSync.Load() != first {
+		t.Error("SyncThrottled flushed within the interval")
+	}
+
+	if err := f.SyncThrottled(0); err != nil {
+		t.Fatalf("SyncThrottled(0) failed: %v", err)
+	}
+	if f.lastSync.Load() == first {
+		t.Error("SyncThrottled(0) did not flush")
+	}
+
+	t.Run("closed", func(t *testing.T) {
+		g, err := OpenFile(filepath.Join(t.TempDir(), "closed.log"), os.O_RDWR|os.O_CREATE, 0644, 8)
+		if err != nil {
+			t.Fatalf("OpenFile failed: %v", err)
+		}
+		g.Close()
+
+		if err := g.SyncThrottled(time.Hour); !errors.Is(err, ErrClosed) {
+			t.Errorf("got %v, want ErrClosed", err)
+		}
+		// the failed flush does not count towards the interval
+		if err := g.SyncThrottled(time.Hour); !errors.Is(err, ErrClosed) {
+			t.Errorf("retry: got %v, want ErrClosed", err)
+		}
+	})
+}
+
+func TestRename(t *testing.T) {
+	dir := t.TempDir()
+	oldPath := filepath.Join(dir, "old.bin")
+	newPath := filepath.Join(dir, "new.bin")
+	if err := os.WriteFile(oldPath, []byte("still here"), 0644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+
+	f, err := OpenFile(oldPath, os.O_RDWR, 0, 0)
+	if err != nil {
+		t.Fatalf("OpenFile failed: %v", err)
+	}
+	defer f.Close()
+
+	if err := f.Rename(newPath); err != nil {
+		t.Fatalf("Rename failed: %v", err)
+	}
+
+	if f.Name() != newPath {
+		t.Errorf("Name() = %q, want %q", f.Name(), newPath)
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		t.Fatalf("Stat failed: %v", err)
+	}
+	if fi.Name() != "new.bin" || fi.Size() != 10 {
+		t.Errorf("Stat() = %q, %d bytes; want %q, 10 bytes", fi.Name(), fi.Size(), "new.bin")
+	}
+	if _, err := os.Stat(oldPath); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Stat(old path): got %v, want fs.ErrNotExist", err)
+	}
+
+	buf := make([]byte, 10)
+	if _, err := f.ReadAt(buf, 0); err != nil || string(buf) != "still here" {
+		t.Errorf("ReadAt after Rename = %q, %v; want %q", buf, err, "still here")
+	}
+	if _, err := f.WriteAt([]byte("STILL"), 0); err != nil {
+		t.Fatalf("WriteAt after Rename failed: %v", err)
+	}
+	if err := f.Sync(); err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+	if data, _ := os.ReadFile(newPath); string(data) != "STILL here" {
+		t.Errorf("renamed file content = %q, want %q", data, "STILL here")
+	}
+
+	t.Run("missing target dir", func(t *testing.T) {
+		if err := f.Rename(filepath.Join(dir, "missing", "x.bin")); err == nil {
+			t.Error("Rename into a missing directory should fail")
+		}
+		if f.Name() != newPath {
+			t.Errorf("Name() after failed Rename = %q, want %q", f.Name(), newPath)
+		}
+	})
+}
+
+func TestDump(t *testing.T) {
+	f, err := Open("testdata/hello.txt")
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer f.Close()
+
+	// the golden file is the output of `xxd testdata/hello.txt`
+	golden, err := os.ReadFile("testdata/hello.txt.xxd")
+	if err != nil {
+		t.Fatalf("ReadFile failed: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := f.Dump(&buf, 0, -1); err != nil {
+		t.Fatalf("Dump failed: %v", err)
+	}
+	if buf.String() != string(golden) {
+		t.Errorf("Dump output differs from golden file:\ngot:\n%s\nwant:\n%s", buf.String(), golden)
+	}
+
+	tests := []struct {
+		name        string
+		off, length int64
+		want        string
+	}{
+		{
+			name: "region",
+			off:  7, length: 20,
+			want: "00000007: 576f 726c 6421 0a54 6869 7320 6973 2061  World!.This is a\n" +
+				"00000017: 2074 6573                                 tes\n",
+		},
+		{
+			name: "clamped",
+			off:  168, length: 100,
+			want: "000000a8: 646f 672e 0a                             dog..\n",
+		},
+		{name: "past end", off: 1000, length: 10, want: ""},
+		{name: "empty", off: 3, length: 0, want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := f.Dump(&buf, tt.off, tt.length); err != nil {
+				t.Fatalf("Dump failed: %v", err)
+			}
+			if buf.String() != tt.want {
+				t.Errorf("Dump(%d, %d) =\n%s\nwant:\n%s", tt.off, tt.length, buf.String(), tt.want)
+			}
+		})
+	}
+
+	if err := f.Dump(io.Discard, -1, 1); !errors.Is(err, ErrNegativeOffset) {
+		t.Errorf("got %v, want ErrNegativeOffset", err)
+	}
+}
+
+func TestFadvise(t *testing.T) {
+	f, err := Open("testdata/hello.txt")
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer f.Close()
+
+	err = f.Fadvise(0, 0, FadvSequential)
+	if errors.Is(err, ErrUnsupported) {
+		if runtime.GOOS == "linux" && runtime.GOARCH == "amd64" {
+			t.Fatal("Fadvise should be supported on linux/amd64")
+		}
+		t.Skip("fadvise is not supported on this platform")
+	}
+	if err != nil {
+		t.Fatalf("Fadvise(FadvSequential) failed: %v", err)
+	}
+
+	if err := f.Fadvise(0, int64(f.Len()), FadvDontNeed); err != nil {
+		t.Errorf("Fadvise(FadvDontNeed) failed: %v", err)
+	}
+	if err := f.Fadvise(0, 0, 1000); err == nil {
+		t.Error("Fadvise with invalid advice should fail")
+	}
+	if err := f.Fadvise(-1, 0, FadvNormal); !errors.Is(err, ErrNegativeOffset) {
+		t.Errorf("got %v, want ErrNegativeOffset", err)
+	}
+
+	f.Close()
+	if err := f.Fadvise(0, 0, FadvNormal); !errors.Is(err, ErrClosed) {
+		t.Errorf("after Close: got %v, want ErrClosed", err)
+	}
+}
+
+func TestOverlay(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "base.img")
+	content := []byte("base image contents")
+	if err := os.WriteFile(path, content, 0644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+
+	base, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer base.Close()
+
+	o1, err := base.Overlay()
+	if err != nil {
+		t.Fatalf("Overlay failed: %v", err)
+	}
+	defer o1.Close()
+
+	o2, err := base.Overlay()
+	if err != nil {
+		t.Fatalf("second Overlay failed: %v", err)
+	}
+	defer o2.Close()
+
+	if o1.ReadOnly() {
+		t.Error("overlay of a read-only file is read-only")
+	}
+	if !bytes.Equal(o1.Bytes(), content) {
+		t.Errorf("overlay Bytes() = %q, want %q", o1.Bytes(), content)
+	}
+
+	if _, err := o1.WriteAt([]byte("BASE"), 0); err != nil {
+		t.Fatalf("WriteAt on overlay failed: %v", err)
+	}
+	if _, err := o2.WriteAt([]byte("IMAGE"), 5); err != nil {
+		t.Fatalf("WriteAt on second overlay failed: %v", err)
+	}
+	if err := o1.Sync(); err != nil {
+		t.Fatalf("Sync on overlay failed: %v", err)
+	}
+
+	if got := string(o1.Bytes()); got != "BASE image contents" {
+		t.Errorf("overlay Bytes() = %q, want %q", got, "BASE image contents")
+	}
+	if got := string(o2.Bytes()); got != "base IMAGE contents" {
+		t.Errorf("second overlay Bytes() = %q, want %q", got, "base IMAGE contents")
+	}
+	if !bytes.Equal(base.Bytes(), content) {
+		t.Errorf("base Bytes() = %q, want %q", base.Bytes(), content)
+	}
+	if data, _ := os.ReadFile(path); !bytes.Equal(data, content) {
+		t.Errorf("file content = %q, want %q", data, content)
+	}
+
+	// the overlay outlives its base
+	base.Close()
+	if _, err := o1.Stat(); err != nil {
+		t.Errorf("Stat on overlay after base Close failed: %v", err)
+	}
+	if got := string(o1.Bytes()); got != "BASE image contents" {
+		t.Errorf("overlay Bytes() after base Close = %q", got)
+	}
+	if _, err := base.Overlay(); !errors.Is(err, ErrClosed) {
+		t.Errorf("Overlay on closed file: got %v, want ErrClosed", err)
+	}
+}
+
+func TestWithNoWriteBack(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.bin")
+	content := []byte("on-disk contents")
+	if err := os.WriteFile(path, content, 0644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+
+	f, err := OpenFileWith(path, os.O_RDWR, 0, 0, WithNoWriteBack())
+	if err != nil {
+		t.Fatalf("OpenFileWith failed: %v", err)
+	}
+
+	if _, err := f.WriteAt([]byte("IN-MEMORY"), 0); err != nil {
+		t.Fatalf("WriteAt failed: %v", err)
+	}
+	if got := string(f.Bytes()); got != "IN-MEMORYontents" {
+		t.Errorf("Bytes() = %q, want %q", got, "IN-MEMORYontents")
+	}
+	if err := f.Sync(); err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+	if data, _ := os.ReadFile(path); !bytes.Equal(data, content) {
+		t.Errorf("file content after Sync = %q, want %q", data, content)
+	}
+
+	if err := f.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	if data, _ := os.ReadFile(path); !bytes.Equal(data, content) {
+		t.Errorf("file content after Close = %q, want %q", data, content)
+	}
+}
+
+func TestMapInfo(t *testing.T) {
+	f, err := Open("testdata/hello.txt")
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer f.Close()
+
+	info, err := f.MapInfo()
+	if !nativeMapping {
+		if !errors.Is(err, ErrUnsupported) {
+			t.Errorf("got %v, want ErrUnsupported", err)
+		}
+		return
+	}
+	if err != nil {
+		t.Fatalf("MapInfo failed: %v", err)
+	}
+
+	path := filepath.Join(t.TempDir(), "private.bin")
+	if err := os.WriteFile(path, []byte("data"), 0644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+	p, err := OpenFileWith(path, os.O_RDWR, 0, 0, WithPrivate())
+	if err != nil {
+		t.Fatalf("OpenFileWith failed: %v", err)
+	}
+	defer p.Close()
+
+	pinfo, err := p.MapInfo()
+	if err != nil {
+		t.Fatalf("MapInfo failed: %v", err)
+	}
+	if info == pinfo {
+		t.Errorf("read-only and private mappings report the same MapInfo %+v", info)
+	}
+
+	p.Close()
+	if _, err := p.MapInfo(); !errors.Is(err, ErrClosed) {
+		t.Errorf("after Close: got %v, want ErrClosed", err)
+	}
+}
+
+func TestWithWriteThrough(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "journal.bin")
+
+	f, err := OpenFileWith(path, os.O_RDWR|os.O_CREATE, 0644, 32, WithWriteThrough())
+	if err != nil {
+		t.Fatalf("OpenFileWith failed: %v", err)
+	}
+	defer f.Close()
+
+	if _, err := f.Write([]byte("write")); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	if _, err := f.WriteAt([]byte("at"), 8); err != nil {
+		t.Fatalf("WriteAt failed: %v", err)
+	}
+	if _, err := f.WriteAtv([][]byte{[]byte("vec"), []byte("tor")}, 12); err != nil {
+		t.Fatalf("WriteAtv failed: %v", err)
+	}
+	f.Seek(20, io.SeekStart)
+	if _, err := f.ReadFrom(strings.NewReader("from")); err != nil {
+		t.Fatalf("ReadFrom failed: %v", err)
+	}
+	v, err := f.View(24, 4)
+	if err != nil {
+		t.Fatalf("View failed: %v", err)
+	}
+	if err := v.WriteUint32(0, 0x74696577, binary.BigEndian); err != nil {
+		t.Fatalf("WriteUint32 failed: %v", err)
+	}
+
+	// simulate a crash: read the file without syncing or closing f
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("ReadFile failed: %v", err)
+	}
+	want := "write\x00\x00\x00at\x00\x00vector\x00\x00fromtiew\x00\x00\x00\x00"
+	if string(data) != want {
+		t.Errorf("file content before Sync = %q, want %q", data, want)
+	}
 }
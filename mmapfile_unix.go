@@ -3,12 +3,19 @@
 package mmapfile
 
 import (
+	"errors"
 	"fmt"
+	"io"
 	"os"
 	"runtime"
+	"sync/atomic"
 	"syscall"
+	"unsafe"
 )
 
+// nativeMapping is true, as the file is mapped with mmap(2).
+const nativeMapping = true
+
 // Open memory-maps the named file for reading.
 // The returned MmapFile implements io.ReadSeeker and io.ReaderAt.
 func Open(name string) (*MmapFile, error) {
@@ -19,23 +26,51 @@ func Open(name string) (*MmapFile, error) {
 //
 // Supported flags:
 //   - [os.O_RDONLY]: Open for reading only
+//   - [os.O_WRONLY]: Open for writing only (see below)
 //   - [os.O_RDWR]: Open for reading and writing
 //   - [os.O_CREATE]: Create the file if it doesn't exist (requires size > 0)
+//   - [os.O_EXCL]: Used with [os.O_CREATE], file must not exist
 //   - [os.O_TRUNC]: Truncate the file to the specified size
 //
 // The size parameter is used when creating a new file or when [os.O_TRUNC] is
 // specified. For existing files opened without [os.O_TRUNC], size is ignored
 // and the file's current size is used.
+// Creating a writable file with a size of 0, or opening an empty one with
+// [os.O_CREATE], returns [ErrInvalidSize], as nothing could be written to it;
+// pass [WithGrowIncrement] to [OpenFileWith] to start empty and grow on write.
+//
+// Directories, devices, sockets, and other non-regular files are rejected
+// with [ErrNotRegularFile]; see [WithAllowSpecial].
+//
+// With [os.O_WRONLY], the file is still mapped read-write, since there is no
+// write-only memory protection, so read permission on the file is required.
+// However, [MmapFile.Read], [MmapFile.ReadAt], and related methods return
+// [ErrWriteOnly].
 //
 // Note: [os.O_APPEND] is not supported as mmap does not support growing files.
 func OpenFile(name string, flag int, perm os.FileMode, size int64) (*MmapFile, error) {
+	return OpenFileWith(name, flag, perm, size)
+}
+
+// OpenFileWith is like [OpenFile], but additionally applies the given
+// [Option]s to control how the file is mapped.
+func OpenFileWith(name string, flag int, perm os.FileMode, size int64, opts ...Option) (*MmapFile, error) {
+	o := newOptions(opts)
+	o.borrowed = false // the file opened here is always owned
+
 	writable := flag&os.O_RDWR != 0 || flag&os.O_WRONLY != 0
+	writeOnly := flag&(os.O_RDWR|os.O_WRONLY) == os.O_WRONLY
 	create := flag&os.O_CREATE != 0
 	trunc := flag&os.O_TRUNC != 0
 
 	if flag&os.O_APPEND != 0 {
 		return nil, fmt.Errorf("mmapfile: O_APPEND is not supported")
 	}
+	if create && writable {
+		if err := checkCreateSize(name, size, o); err != nil {
+			return nil, err
+		}
+	}
 
 	osFlag := os.O_RDONLY
 	if writable {
@@ -44,8 +79,13 @@ func OpenFile(name string, flag int, perm os.FileMode, size int64) (*MmapFile, e
 	if create {
 		osFlag |= os.O_CREATE
 	}
+	if flag&os.O_EXCL != 0 {
+		osFlag |= os.O_EXCL
+	}
+
+	created := createsFile(name, osFlag)
 
-	f, err := os.OpenFile(name, osFlag, perm)
+	f, err := openFile(name, osFlag, perm, o.unshared)
 	if err != nil {
 		return nil, err
 	}
@@ -56,63 +96,377 @@ func OpenFile(name string, flag int, perm os.FileMode, size int64) (*MmapFile, e
 		return nil, err
 	}
 
-	fileSize := fi.Size()
+	if err := checkMode(fi, o); err != nil {
+		_ = f.Close()
+		return nil, err
+	}
 
-	if create && fileSize == 0 && size > 0 {
-		if err := f.Truncate(size); err != nil {
+	fileSize, err := openSize(fi, create, trunc, size, o)
+	if err != nil {
+		_ = f.Close()
+		if created {
+			_ = os.Remove(name)
+		}
+		return nil, err
+	}
+
+	if fi.Mode().IsRegular() && fileSize != fi.Size() {
+		if err := f.Truncate(fileSize); err != nil {
+			_ = f.Close()
 			return nil, fmt.Errorf("mmapfile: failed to set file size: %w", err)
 		}
-		fileSize = size
-	} else if trunc && size > 0 {
-		if err := f.Truncate(size); err != nil {
-			return nil, fmt.Errorf("mmapfile: failed to truncate file: %w", err)
+	}
+
+	mf, err := mapFile(f, name, writable, writeOnly, 0, fileSize, o)
+	if err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+
+	return mf, nil
+}
+
+// OpenTemp creates a new temporary file of the given size in dir, maps it for
+// reading and writing, and unlinks it right away, so its storage is released
+// automatically once the returned [MmapFile] is closed, even if the process
+// crashes.
+//
+// If dir is the empty string, [os.TempDir] is used. As the file has no name
+// in the file system, [Name] only reports the name it was created with, and
+// [Remove] returns an error satisfying errors.Is(err, fs.ErrNotExist).
+//
+// OpenTemp is only available on Unix platforms.
+func OpenTemp(dir string, size int64, opts ...Option) (*MmapFile, error) {
+	if size < 0 {
+		return nil, ErrNegativeOffset
+	}
+
+	o := newOptions(opts)
+	o.borrowed = false // the file created here is always owned
+
+	f, err := os.CreateTemp(dir, "mmapfile-*")
+	if err != nil {
+		return nil, err
+	}
+
+	name := f.Name()
+	if err := os.Remove(name); err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+
+	if err := f.Truncate(size); err != nil {
+		_ = f.Close()
+		return nil, fmt.Errorf("mmapfile: failed to set file size: %w", err)
+	}
+
+	mf, err := mapFile(f, name, true, false, 0, size, o)
+	if err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+
+	return mf, nil
+}
+
+// openFile opens the named file like [os.OpenFile]. If unshared is true, it
+// also takes an exclusive flock(2) lock on it without blocking, failing with
+// [ErrLocked] if another exclusive opener holds the lock.
+func openFile(name string, flag int, perm os.FileMode, unshared bool) (*os.File, error) {
+	f, err := os.OpenFile(name, flag, perm)
+	if err != nil || !unshared {
+		return f, err
+	}
+
+	rc, err := f.SyscallConn()
+	if err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+
+	var lockErr error
+	if err := rc.Control(func(fd uintptr) {
+		for {
+			lockErr = syscall.Flock(int(fd), syscall.LOCK_EX|syscall.LOCK_NB)
+			if lockErr != syscall.EINTR {
+				return
+			}
 		}
-		fileSize = size
+	}); err != nil {
+		_ = f.Close()
+		return nil, err
 	}
 
-	if fileSize == 0 {
-		return &MmapFile{
-			data:     nil,
-			name:     name,
-			writable: writable,
-			platform: &fileHolder{file: f},
-		}, nil
+	switch {
+	case lockErr == syscall.EWOULDBLOCK:
+		_ = f.Close()
+		return nil, fmt.Errorf("%w: %s", ErrLocked, name)
+	case lockErr != nil:
+		_ = f.Close()
+		return nil, fmt.Errorf("mmapfile: flock failed: %w", lockErr)
 	}
 
-	if fileSize < 0 {
-		return nil, fmt.Errorf("mmapfile: file %q has negative size", name)
+	return f, nil
+}
+
+// dupFile duplicates the file descriptor of file with dup(2).
+func dupFile(file *os.File) (*os.File, error) {
+	rc, err := file.SyscallConn()
+	if err != nil {
+		return nil, err
+	}
+
+	nfd := -1
+	var dupErr error
+	if err := rc.Control(func(fd uintptr) {
+		nfd, dupErr = syscall.Dup(int(fd))
+	}); err != nil {
+		return nil, err
 	}
-	if fileSize != int64(int(fileSize)) {
-		return nil, fmt.Errorf("mmapfile: file %q is too large", name)
+	if dupErr != nil {
+		return nil, fmt.Errorf("mmapfile: dup failed: %w", dupErr)
 	}
+	syscall.CloseOnExec(nfd)
+
+	return os.NewFile(uintptr(nfd), file.Name()), nil
+}
 
+// sysMmap is the mmap(2) wrapper.
+//
+// It is a variable so tests can simulate a kernel without
+// MAP_SHARED_VALIDATE.
+var sysMmap = syscall.Mmap
+
+// noSharedValidate records that the kernel rejected MAP_SHARED_VALIDATE, so
+// that later mappings use MAP_SHARED right away.
+var noSharedValidate atomic.Bool
+
+// newMapInfo returns the mmap(2) protection and flags for a mapping with the
+// given settings.
+func newMapInfo(writable bool, o options) MapInfo {
 	prot := syscall.PROT_READ
 	if writable {
 		prot |= syscall.PROT_WRITE
 	}
 
-	data, err := syscall.Mmap(int(f.Fd()), 0, int(fileSize), prot, syscall.MAP_SHARED)
+	flags := syscall.MAP_SHARED
+	if o.private {
+		flags = syscall.MAP_PRIVATE
+	} else if o.validate && mapSharedValidate != 0 && !noSharedValidate.Load() {
+		flags = mapSharedValidate
+	}
+	if o.populate {
+		flags |= mapPopulate
+	}
+	if o.noReserve {
+		flags |= mapNoReserve
+	}
+
+	return MapInfo{Prot: prot, Flags: flags}
+}
+
+// mapFile maps the size bytes of file starting at offset off. On success, the
+// returned [MmapFile] owns file; on failure, closing file is up to the caller.
+func mapFile(file *os.File, name string, writable, writeOnly bool, off, size int64, o options) (*MmapFile, error) {
+	if err := o.checkSize(size); err != nil {
+		return nil, err
+	}
+
+	holder := &fileHolder{file: file, borrowed: o.borrowed}
+
+	if size == 0 {
+		mf := &MmapFile{
+			data:      nil,
+			base:      off,
+			name:      name,
+			writable:  writable,
+			writeOnly: writeOnly,
+			private:   o.private,
+			exclusive: o.exclusive,
+			zeroFill:  o.zeroFill,
+			unshared:  o.unshared,
+			writeThru: o.writeThrough,
+			info:      newMapInfo(writable, o),
+			growBy:    o.growIncrement,
+			opts:      o,
+			platform:  holder,
+		}
+		runtime.SetFinalizer(mf, (*MmapFile).Close)
+
+		return mf, nil
+	}
+
+	if size < 0 {
+		return nil, fmt.Errorf("mmapfile: file %q has negative size", name)
+	}
+	if size > maxInt {
+		return nil, fmt.Errorf("%w: file %q is %d bytes", ErrAddressSpaceExhausted, name, size)
+	}
+
+	data, err := mmap(file, off, size, writable, o)
 	if err != nil {
-		return nil, fmt.Errorf("mmapfile: mmap failed: %w", err)
+		return nil, err
 	}
 
 	mf := &MmapFile{
-		data:     data,
-		name:     name,
-		writable: writable,
+		data:      data,
+		base:      off,
+		name:      name,
+		writable:  writable,
+		writeOnly: writeOnly,
+		private:   o.private,
+		exclusive: o.exclusive,
+		zeroFill:  o.zeroFill,
+		unshared:  o.unshared,
+		writeThru: o.writeThrough,
+		info:      newMapInfo(writable, o),
+		growBy:    o.growIncrement,
+		opts:      o,
 	}
 
 	runtime.SetFinalizer(mf, (*MmapFile).Close)
 
-	mf.platform = &fileHolder{file: f}
+	mf.platform = holder
 
 	return mf, nil
 }
 
+// mmap maps the size bytes of file starting at offset off according to o.
+//
+// The mapping itself starts at the page boundary at or before off; the
+// returned slice starts at off and extends to the end of the mapping.
+func mmap(file *os.File, off, size int64, writable bool, o options) ([]byte, error) {
+	info := newMapInfo(writable, o)
+
+	adjust := off % mapAlign()
+	if size > int64(maxInt)-adjust {
+		return nil, ErrAddressSpaceExhausted
+	}
+
+	data, err := sysMmap(int(file.Fd()), off-adjust, int(adjust+size), info.Prot, info.Flags)
+	if mapSharedValidate != 0 && info.Flags&mapSharedValidate == mapSharedValidate && errors.Is(err, syscall.EINVAL) {
+		// the kernel may predate MAP_SHARED_VALIDATE, which is only known
+		// once MAP_SHARED succeeds, as EINVAL also covers a bad offset or size
+		flags := info.Flags&^mapSharedValidate | syscall.MAP_SHARED
+		data, err = sysMmap(int(file.Fd()), off-adjust, int(adjust+size), info.Prot, flags)
+		if err == nil {
+			noSharedValidate.Store(true)
+		}
+	}
+	if errors.Is(err, syscall.ENOMEM) {
+		// the address space is exhausted or fragmented, e.g. on 32-bit
+		// platforms, or limited by RLIMIT_AS or vm.max_map_count
+		return nil, fmt.Errorf("mmapfile: mmap failed: %w: %w", ErrAddressSpaceExhausted, err)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("mmapfile: mmap failed: %w", err)
+	}
+
+	// access pattern hints are best-effort
+	switch o.access {
+	case accessSequential:
+		_ = madvise(data, syscall.MADV_SEQUENTIAL)
+	case accessRandom:
+		_ = madvise(data, syscall.MADV_RANDOM)
+	}
+
+	if o.populate && mapPopulate == 0 {
+		_ = prefetch(data)
+	}
+
+	if o.verify {
+		if err := verify(data); err != nil {
+			_ = syscall.Munmap(data)
+			return nil, err
+		}
+	}
+
+	return data[adjust:], nil
+}
+
+// mapAlign returns the alignment required of mapping offsets.
+func mapAlign() int64 {
+	return int64(PageSize())
+}
+
+// remap replaces the read-only mapping with one of file at the given size.
+//
+// The caller must hold f.mu.
+func (f *MmapFile) remap(file *os.File, size int64) error {
+	data, err := mmap(file, f.base, size, false, options{private: f.private})
+	if err != nil {
+		return err
+	}
+
+	old, _ := f.mapping()
+	f.data = data
+
+	if len(old) == 0 {
+		return nil
+	}
+
+	if err := syscall.Munmap(old); err != nil {
+		return fmt.Errorf("mmapfile: munmap failed: %w", err)
+	}
+
+	return nil
+}
+
+// resize truncates or extends file to size and replaces the mapping with one
+// of the new size.
+//
+// The caller must hold f.mu.
+func (f *MmapFile) resize(file *os.File, size int64) error {
+	if err := file.Truncate(f.base + size); err != nil {
+		return fmt.Errorf("mmapfile: failed to truncate file: %w", err)
+	}
+
+	var data []byte
+	if size > 0 {
+		var err error
+		data, err = mmap(file, f.base, size, f.writable, options{private: f.private})
+		if err != nil {
+			// the old mapping is still valid up to the new size
+			f.data = f.data[:min(int64(len(f.data)), size)]
+			return err
+		}
+	}
+
+	old, _ := f.mapping()
+	f.data = data
+
+	if len(old) == 0 {
+		return nil
+	}
+
+	if err := syscall.Munmap(old); err != nil {
+		return fmt.Errorf("mmapfile: munmap failed: %w", err)
+	}
+
+	return nil
+}
+
+// writeThrough is a no-op, as writes to a shared mapping already reach the
+// page cache of the file.
+func (f *MmapFile) writeThrough(off int64, n int) error {
+	return nil
+}
+
 // Close closes the memory-mapped file.
 //
+// Close unmaps the file without calling msync(2): changes to a shared mapping
+// are already in the page cache, and the kernel writes them back to the file
+// in its own time. Call [Sync] first if they must be durable once Close
+// returns. Changes to a private mapping are discarded.
+//
 // After Close, the [MmapFile] should not be used.
 func (f *MmapFile) Close() error {
+	return f.close(true)
+}
+
+// close implements [Close] and [CloseNoSync], which are the same here, as
+// closing never writes the mapping back itself.
+func (f *MmapFile) close(_ bool) error {
 	f.mu.Lock()
 	defer f.mu.Unlock()
 
@@ -121,49 +475,224 @@ func (f *MmapFile) Close() error {
 	}
 	f.closed = true
 
-	var err error
+	err := f.closeCheck()
+
+	runtime.SetFinalizer(f, nil)
+
+	m, _ := f.mapping()
+	size := int64(len(f.data))
+	f.data = nil
+
+	if len(m) > 0 && !f.memory {
+		if munErr := syscall.Munmap(m); munErr != nil && err == nil {
+			err = munErr
+		}
+	}
 
+	// the file is closed only once it is no longer mapped, so that it can be
+	// trimmed to its logical size first
 	if fh, ok := f.platform.(*fileHolder); ok && fh.file != nil {
-		if cErr := fh.file.Close(); cErr != nil {
-			err = cErr
+		if tErr := f.trim(fh.file, size); tErr != nil && err == nil {
+			err = tErr
+		}
+		if !fh.borrowed {
+			if cErr := fh.file.Close(); cErr != nil && err == nil {
+				err = cErr
+			}
 		}
 		f.platform = nil
 	}
 
-	runtime.SetFinalizer(f, nil)
+	return err
+}
 
-	if len(f.data) == 0 {
-		f.data = nil
-		return err
-	}
+// Sync flushes changes to the underlying file.
+//
+// Sync calls msync(2) with MS_SYNC over the mapping and blocks until the
+// modified pages have been written to the file. It does not guarantee that
+// file metadata (e.g. the modification time) is persisted; use [SyncMeta] for
+// that.
+//
+// This is a no-op for read-only files.
+func (f *MmapFile) Sync() error {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
 
-	data := f.data
-	f.data = nil
+	if f.closed {
+		return ErrClosed
+	}
+	if !f.writable || f.private || f.memory || len(f.data) == 0 {
+		return nil
+	}
 
-	if munErr := syscall.Munmap(data); munErr != nil && err == nil {
-		err = munErr
+	m, _ := f.mapping()
+	f.dirty.Store(false)
+	if err := msync(m, syscall.MS_SYNC); err != nil {
+		f.dirty.Store(true)
+		return err
 	}
+	f.stats.syncs.Add(1)
 
-	return err
+	return nil
 }
 
-// Sync flushes changes to the underlying file.
+// SyncMeta is like [Sync], but additionally calls fsync(2) on the underlying
+// file, so that both the data and the file metadata are durable once it
+// returns.
 //
 // This is a no-op for read-only files.
-func (f *MmapFile) Sync() error {
+func (f *MmapFile) SyncMeta() error {
 	f.mu.RLock()
 	defer f.mu.RUnlock()
 
 	if f.closed {
 		return ErrClosed
 	}
-	if !f.writable || len(f.data) == 0 {
+	if !f.writable || f.private || f.memory {
 		return nil
 	}
 
+	if len(f.data) > 0 {
+		m, _ := f.mapping()
+		f.dirty.Store(false)
+		if err := msync(m, syscall.MS_SYNC); err != nil {
+			f.dirty.Store(true)
+			return err
+		}
+		f.stats.syncs.Add(1)
+	}
+
 	if fh, ok := f.platform.(*fileHolder); ok && fh.file != nil {
 		return fh.file.Sync()
 	}
 
 	return nil
 }
+
+// flushAndEvict implements [FlushAndEvict] over b, a page-aligned region of
+// the mapping.
+//
+// The caller must hold f.mu.
+func (f *MmapFile) flushAndEvict(b []byte) error {
+	if f.writable && f.private {
+		return nil
+	}
+
+	if f.writable {
+		if err := msync(b, syscall.MS_SYNC); err != nil {
+			return err
+		}
+		f.stats.syncs.Add(1)
+	}
+
+	return madvise(b, syscall.MADV_DONTNEED)
+}
+
+// msync issues msync(2) over b, which must start on a page boundary.
+func msync(b []byte, flags int) error {
+	_, _, errno := syscall.Syscall(sysMsync, uintptr(unsafe.Pointer(&b[0])), uintptr(len(b)), uintptr(flags))
+	if errno != 0 {
+		return fmt.Errorf("mmapfile: msync failed: %w", errno)
+	}
+
+	return nil
+}
+
+// prefetch advises the kernel to read ahead the pages backing b.
+func prefetch(b []byte) error {
+	return madvise(b, syscall.MADV_WILLNEED)
+}
+
+// madvise issues madvise(2) over b, which must start on a page boundary.
+func madvise(b []byte, advice int) error {
+	_, _, errno := syscall.Syscall(syscall.SYS_MADVISE, uintptr(unsafe.Pointer(&b[0])), uintptr(len(b)), uintptr(advice))
+	if errno != 0 {
+		return fmt.Errorf("mmapfile: madvise failed: %w", errno)
+	}
+
+	return nil
+}
+
+// resident reports the page residency of b using mincore(2).
+func resident(b []byte) ([]bool, error) {
+	pageSize := PageSize()
+	vec := make([]byte, (len(b)+pageSize-1)/pageSize)
+
+	_, _, errno := syscall.Syscall(syscall.SYS_MINCORE, uintptr(unsafe.Pointer(&b[0])), uintptr(len(b)), uintptr(unsafe.Pointer(&vec[0])))
+	if errno != 0 {
+		return nil, fmt.Errorf("mmapfile: mincore failed: %w", errno)
+	}
+
+	pages := make([]bool, len(vec))
+	for i, v := range vec {
+		pages[i] = v&1 != 0
+	}
+
+	return pages, nil
+}
+
+// setReadOnly changes the protection of the mapping to PROT_READ.
+//
+// The caller must hold f.mu.
+func (f *MmapFile) setReadOnly() error {
+	if len(f.data) == 0 {
+		return nil
+	}
+
+	m, _ := f.mapping()
+	_, _, errno := syscall.Syscall(syscall.SYS_MPROTECT, uintptr(unsafe.Pointer(&m[0])), uintptr(len(m)), syscall.PROT_READ)
+	if errno != 0 {
+		return fmt.Errorf("mmapfile: mprotect failed: %w", errno)
+	}
+
+	return nil
+}
+
+// lockRange places an fcntl(2) record lock over [off, off+length) of file,
+// waiting for any conflicting lock to be released.
+func lockRange(file *os.File, off, length int64, exclusive bool) error {
+	var typ int16 = syscall.F_RDLCK
+	if exclusive {
+		typ = syscall.F_WRLCK
+	}
+
+	return fcntlLock(file, typ, off, length)
+}
+
+// unlockRange releases the fcntl(2) record lock over [off, off+length) of
+// file.
+func unlockRange(file *os.File, off, length int64) error {
+	return fcntlLock(file, syscall.F_UNLCK, off, length)
+}
+
+// fcntlLock issues a blocking fcntl(2) lock command of the given type.
+func fcntlLock(file *os.File, typ int16, off, length int64) error {
+	rc, err := file.SyscallConn()
+	if err != nil {
+		return err
+	}
+
+	lk := syscall.Flock_t{
+		Type:   typ,
+		Whence: io.SeekStart,
+		Start:  off,
+		Len:    length,
+	}
+
+	var lockErr error
+	if err := rc.Control(func(fd uintptr) {
+		for {
+			lockErr = syscall.FcntlFlock(fd, fcntlSetLockWait, &lk)
+			if lockErr != syscall.EINTR {
+				return
+			}
+		}
+	}); err != nil {
+		return err
+	}
+	if lockErr != nil {
+		return fmt.Errorf("mmapfile: fcntl lock failed: %w", lockErr)
+	}
+
+	return nil
+}
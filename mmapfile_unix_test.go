@@ -0,0 +1,311 @@
+//go:build linux || darwin || freebsd || openbsd || netbsd || dragonfly
+
+package mmapfile
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+)
+
+func TestOpenTemp(t *testing.T) {
+	dir := t.TempDir()
+
+	f, err := OpenTemp(dir, 64)
+	if err != nil {
+		t.Fatalf("OpenTemp failed: %v", err)
+	}
+
+	if f.Len() != 64 {
+		t.Errorf("Len() = %d, want 64", f.Len())
+	}
+	if _, err := os.Stat(f.Name()); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Stat(%q): got %v, want fs.ErrNotExist", f.Name(), err)
+	}
+
+	if _, err := f.WriteAt([]byte("scratch"), 0); err != nil {
+		t.Fatalf("WriteAt failed: %v", err)
+	}
+	buf := make([]byte, 7)
+	if _, err := f.ReadAt(buf, 0); err != nil || string(buf) != "scratch" {
+		t.Errorf("ReadAt = %q, %v; want %q", buf, err, "scratch")
+	}
+
+	if err := f.Remove(); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Remove: got %v, want fs.ErrNotExist", err)
+	}
+	if _, err := f.ReadAt(buf, 0); !errors.Is(err, ErrClosed) {
+		t.Errorf("ReadAt after Remove: got %v, want ErrClosed", err)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("ReadDir failed: %v", err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("temp dir has %d entries, want 0", len(entries))
+	}
+
+	t.Run("negative size", func(t *testing.T) {
+		if _, err := OpenTemp(dir, -1); !errors.Is(err, ErrNegativeOffset) {
+			t.Errorf("got %v, want ErrNegativeOffset", err)
+		}
+	})
+}
+
+func TestMapInfoUnix(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "flags.bin")
+	if err := os.WriteFile(path, []byte("data"), 0644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+
+	tests := []struct {
+		name  string
+		flag  int
+		opts  []Option
+		prot  int
+		flags int
+	}{
+		{"read-only", os.O_RDONLY, nil, syscall.PROT_READ, syscall.MAP_SHARED},
+		{"read-write", os.O_RDWR, nil, syscall.PROT_READ | syscall.PROT_WRITE, syscall.MAP_SHARED},
+		{"private", os.O_RDWR, []Option{WithPrivate()}, syscall.PROT_READ | syscall.PROT_WRITE, syscall.MAP_PRIVATE},
+		{"populate", os.O_RDONLY, []Option{WithPopulate()}, syscall.PROT_READ, syscall.MAP_SHARED | mapPopulate},
+		{"no reserve", os.O_RDONLY, []Option{WithNoReserve()}, syscall.PROT_READ, syscall.MAP_SHARED | mapNoReserve},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := OpenFileWith(path, tt.flag, 0, 0, tt.opts...)
+			if err != nil {
+				t.Fatalf("OpenFileWith failed: %v", err)
+			}
+			defer f.Close()
+
+			info, err := f.MapInfo()
+			if err != nil {
+				t.Fatalf("MapInfo failed: %v", err)
+			}
+			if want := (MapInfo{Prot: tt.prot, Flags: tt.flags}); info != want {
+				t.Errorf("MapInfo() = %+v, want %+v", info, want)
+			}
+		})
+	}
+}
+
+func TestMmapENOMEM(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "enomem.bin")
+	if err := os.WriteFile(path, []byte("data"), 0644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+
+	// Simulate a 32-bit process without a free range large enough.
+	sysMmap = func(fd int, off int64, length, prot, flags int) ([]byte, error) {
+		return nil, syscall.ENOMEM
+	}
+	t.Cleanup(func() { sysMmap = syscall.Mmap })
+
+	_, err := Open(path)
+	if !errors.Is(err, ErrAddressSpaceExhausted) {
+		t.Errorf("Open: got %v, want ErrAddressSpaceExhausted", err)
+	}
+	if !errors.Is(err, syscall.ENOMEM) {
+		t.Errorf("Open: got %v, want it to wrap ENOMEM", err)
+	}
+}
+
+func TestWithValidate(t *testing.T) {
+	if mapSharedValidate == 0 {
+		t.Skip("MAP_SHARED_VALIDATE is Linux-specific")
+	}
+
+	path := filepath.Join(t.TempDir(), "validate.bin")
+	if err := os.WriteFile(path, []byte("data"), 0644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+
+	mapFlags := func(t *testing.T) int {
+		t.Helper()
+
+		f, err := OpenFileWith(path, os.O_RDWR, 0, 0, WithValidate())
+		if err != nil {
+			t.Fatalf("OpenFileWith failed: %v", err)
+		}
+		defer f.Close()
+
+		info, err := f.MapInfo()
+		if err != nil {
+			t.Fatalf("MapInfo failed: %v", err)
+		}
+
+		return info.Flags
+	}
+
+	t.Cleanup(func() { noSharedValidate.Store(false) })
+
+	t.Run("kernel", func(t *testing.T) {
+		noSharedValidate.Store(false)
+
+		flags := mapFlags(t)
+		if noSharedValidate.Load() {
+			t.Skip("kernel does not support MAP_SHARED_VALIDATE")
+		}
+		if flags != mapSharedValidate {
+			t.Errorf("Flags = %#x, want MAP_SHARED_VALIDATE", flags)
+		}
+	})
+
+	t.Run("fallback", func(t *testing.T) {
+		noSharedValidate.Store(false)
+
+		var calls, rejected int
+		sysMmap = func(fd int, off int64, length, prot, flags int) ([]byte, error) {
+			calls++
+			if flags&mapSharedValidate == mapSharedValidate {
+				// simulate a kernel older than 4.15
+				rejected++
+				return nil, syscall.EINVAL
+			}
+			return syscall.Mmap(fd, off, length, prot, flags)
+		}
+		t.Cleanup(func() { sysMmap = syscall.Mmap })
+
+		if flags := mapFlags(t); flags != syscall.MAP_SHARED {
+			t.Errorf("Flags = %#x, want MAP_SHARED", flags)
+		}
+		if calls != 2 || rejected != 1 {
+			t.Errorf("mmap called %d times, %d rejected; want 2, 1", calls, rejected)
+		}
+
+		// later mappings skip the attempt
+		mapFlags(t)
+		if calls != 3 || rejected != 1 {
+			t.Errorf("mmap called %d times, %d rejected; want 3, 1", calls, rejected)
+		}
+	})
+
+	t.Run("unrelated EINVAL", func(t *testing.T) {
+		noSharedValidate.Store(false)
+
+		sysMmap = func(fd int, off int64, length, prot, flags int) ([]byte, error) {
+			// e.g. a bad offset, rejected with or without validation
+			return nil, syscall.EINVAL
+		}
+		t.Cleanup(func() { sysMmap = syscall.Mmap })
+
+		if _, err := OpenFileWith(path, os.O_RDWR, 0, 0, WithValidate()); !errors.Is(err, syscall.EINVAL) {
+			t.Errorf("OpenFileWith: got %v, want EINVAL", err)
+		}
+		if noSharedValidate.Load() {
+			t.Error("a mapping failing with MAP_SHARED too disabled MAP_SHARED_VALIDATE")
+		}
+	})
+
+	t.Run("private", func(t *testing.T) {
+		f, err := OpenFileWith(path, os.O_RDWR, 0, 0, WithValidate(), WithPrivate())
+		if err != nil {
+			t.Fatalf("OpenFileWith failed: %v", err)
+		}
+		defer f.Close()
+
+		if info, _ := f.MapInfo(); info.Flags != syscall.MAP_PRIVATE {
+			t.Errorf("Flags = %#x, want MAP_PRIVATE", info.Flags)
+		}
+	})
+}
+
+func TestWithVerify(t *testing.T) {
+	pageSize := int64(PageSize())
+
+	path := filepath.Join(t.TempDir(), "verify.bin")
+	if err := os.WriteFile(path, make([]byte, 4*pageSize), 0644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+
+	f, err := OpenFileWith(path, os.O_RDONLY, 0, 0, WithVerify())
+	if err != nil {
+		t.Fatalf("OpenFileWith failed: %v", err)
+	}
+	f.Close()
+
+	// truncate the file right after it is mapped, as another process might,
+	// so that its last pages can no longer be read
+	sysMmap = func(fd int, off int64, length, prot, flags int) ([]byte, error) {
+		data, err := syscall.Mmap(fd, off, length, prot, flags)
+		if err == nil {
+			err = os.Truncate(path, pageSize)
+		}
+		return data, err
+	}
+	t.Cleanup(func() { sysMmap = syscall.Mmap })
+
+	if _, err := OpenFileWith(path, os.O_RDONLY, 0, 0, WithVerify()); err == nil {
+		t.Error("OpenFileWith succeeded on a file truncated underneath")
+	}
+}
+
+func TestSafeReadAtTruncated(t *testing.T) {
+	pageSize := PageSize()
+
+	path := filepath.Join(t.TempDir(), "shrink.bin")
+	if err := os.WriteFile(path, bytes.Repeat([]byte("x"), 3*pageSize), 0644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+
+	f, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer f.Close()
+
+	// another process shrinks the file; the third page is now past its end,
+	// where a plain ReadAt would raise SIGBUS
+	if err := os.Truncate(path, int64(pageSize+10)); err != nil {
+		t.Fatalf("Truncate failed: %v", err)
+	}
+
+	buf := make([]byte, 16)
+	if n, err := f.SafeReadAt(buf, int64(2*pageSize)); n != 0 || err != io.ErrUnexpectedEOF {
+		t.Errorf("SafeReadAt past the new end = %d, %v; want 0, io.ErrUnexpectedEOF", n, err)
+	}
+	if n, err := f.SafeReadAt(buf, int64(pageSize)); n != 10 || err != io.ErrUnexpectedEOF {
+		t.Errorf("SafeReadAt across the new end = %d, %v; want 10, io.ErrUnexpectedEOF", n, err)
+	}
+	if n, err := f.SafeReadAt(buf, 0); n != len(buf) || err != nil {
+		t.Errorf("SafeReadAt before the new end = %d, %v; want %d, nil", n, err, len(buf))
+	}
+
+	// a fault that slips past the size check is recovered too
+	if n, err := copyNoFault(buf, f.Bytes()[2*pageSize:]); n != 0 || err != io.ErrUnexpectedEOF {
+		t.Errorf("copyNoFault from a truncated page = %d, %v; want 0, io.ErrUnexpectedEOF", n, err)
+	}
+}
+
+func TestEnableTHP(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "thp.bin")
+
+	f, err := OpenFile(path, os.O_RDWR|os.O_CREATE, 0644, 4<<20)
+	if err != nil {
+		t.Fatalf("OpenFile failed: %v", err)
+	}
+	defer f.Close()
+
+	if err := f.EnableTHP(); err != nil {
+		if errors.Is(err, syscall.EINVAL) {
+			t.Skip("kernel does not support transparent huge pages")
+		}
+		t.Fatalf("EnableTHP failed: %v", err)
+	}
+	if err := f.EnableNoTHP(); err != nil {
+		t.Fatalf("EnableNoTHP failed: %v", err)
+	}
+
+	f.Close()
+	if err := f.EnableTHP(); err != ErrClosed {
+		t.Errorf("EnableTHP after Close: got %v, want ErrClosed", err)
+	}
+}
@@ -3,6 +3,7 @@
 package mmapfile
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"runtime"
@@ -10,6 +11,9 @@ import (
 	"unsafe"
 )
 
+// nativeMapping is true, as the file is mapped with MapViewOfFile.
+const nativeMapping = true
+
 // Open memory-maps the named file for reading.
 // The returned MmapFile implements io.ReadSeeker and io.ReaderAt.
 func Open(name string) (*MmapFile, error) {
@@ -20,17 +24,40 @@ func Open(name string) (*MmapFile, error) {
 //
 // Supported flags:
 //   - [os.O_RDONLY]: Open for reading only
+//   - [os.O_WRONLY]: Open for writing only (see below)
 //   - [os.O_RDWR]: Open for reading and writing
 //   - [os.O_CREATE]: Create the file if it doesn't exist (requires size > 0)
+//   - [os.O_EXCL]: Used with [os.O_CREATE], file must not exist
 //   - [os.O_TRUNC]: Truncate the file to the specified size
 //
 // The size parameter is used when creating a new file or when [os.O_TRUNC] is
 // specified. For existing files opened without [os.O_TRUNC], size is ignored
 // and the file's current size is used.
+// Creating a writable file with a size of 0, or opening an empty one with
+// [os.O_CREATE], returns [ErrInvalidSize], as nothing could be written to it;
+// pass [WithGrowIncrement] to [OpenFileWith] to start empty and grow on write.
+//
+// Directories, devices, sockets, and other non-regular files are rejected
+// with [ErrNotRegularFile]; see [WithAllowSpecial].
+//
+// With [os.O_WRONLY], the file is still mapped read-write, since there is no
+// write-only memory protection, so read permission on the file is required.
+// However, [MmapFile.Read], [MmapFile.ReadAt], and related methods return
+// [ErrWriteOnly].
 //
 // Note: [os.O_APPEND] is not supported as mmap does not support growing files.
 func OpenFile(name string, flag int, perm os.FileMode, size int64) (*MmapFile, error) {
+	return OpenFileWith(name, flag, perm, size)
+}
+
+// OpenFileWith is like [OpenFile], but additionally applies the given
+// [Option]s to control how the file is mapped.
+func OpenFileWith(name string, flag int, perm os.FileMode, size int64, opts ...Option) (*MmapFile, error) {
+	o := newOptions(opts)
+	o.borrowed = false // the file opened here is always owned
+
 	writable := flag&os.O_RDWR != 0 || flag&os.O_WRONLY != 0
+	writeOnly := flag&(os.O_RDWR|os.O_WRONLY) == os.O_WRONLY
 	create := flag&os.O_CREATE != 0
 	trunc := flag&os.O_TRUNC != 0
 
@@ -38,6 +65,11 @@ func OpenFile(name string, flag int, perm os.FileMode, size int64) (*MmapFile, e
 	if flag&os.O_APPEND != 0 {
 		return nil, fmt.Errorf("mmapfile: O_APPEND is not supported")
 	}
+	if create && writable {
+		if err := checkCreateSize(name, size, o); err != nil {
+			return nil, err
+		}
+	}
 
 	// Open or create the underlying file
 	osFlag := os.O_RDONLY
@@ -47,8 +79,13 @@ func OpenFile(name string, flag int, perm os.FileMode, size int64) (*MmapFile, e
 	if create {
 		osFlag |= os.O_CREATE
 	}
+	if flag&os.O_EXCL != 0 {
+		osFlag |= os.O_EXCL
+	}
+
+	created := createsFile(name, osFlag)
 
-	f, err := os.OpenFile(name, osFlag, perm)
+	f, err := openFile(name, osFlag, perm, o.unshared)
 	if err != nil {
 		return nil, err
 	}
@@ -59,53 +96,216 @@ func OpenFile(name string, flag int, perm os.FileMode, size int64) (*MmapFile, e
 		return nil, err
 	}
 
-	fileSize := fi.Size()
+	if err := checkMode(fi, o); err != nil {
+		f.Close()
+		return nil, err
+	}
 
-	// Handle size for new/truncated files
-	if create && fileSize == 0 && size > 0 {
-		if err := f.Truncate(size); err != nil {
-			return nil, fmt.Errorf("mmapfile: failed to set file size: %w", err)
+	fileSize, err := openSize(fi, create, trunc, size, o)
+	if err != nil {
+		f.Close()
+		if created {
+			_ = os.Remove(name)
 		}
-		fileSize = size
-	} else if trunc && size > 0 {
-		if err := f.Truncate(size); err != nil {
-			return nil, fmt.Errorf("mmapfile: failed to truncate file: %w", err)
+		return nil, err
+	}
+
+	if fi.Mode().IsRegular() && fileSize != fi.Size() {
+		if err := f.Truncate(fileSize); err != nil {
+			f.Close()
+			return nil, fmt.Errorf("mmapfile: failed to set file size: %w", err)
 		}
-		fileSize = size
 	}
 
-	if fileSize == 0 {
-		return &MmapFile{
-			data:     nil,
-			name:     name,
-			writable: writable,
-			platform: &fileHolder{file: f},
-		}, nil
+	mf, err := mapFile(f, name, writable, writeOnly, 0, fileSize, o)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	return mf, nil
+}
+
+// errorSharingViolation is the ERROR_SHARING_VIOLATION error code.
+const errorSharingViolation syscall.Errno = 32
+
+// openFile opens the named file like [os.OpenFile]. If unshared is true, the
+// file is opened with CreateFile without any sharing, failing with
+// [ErrLocked] if it is already open elsewhere.
+func openFile(name string, flag int, perm os.FileMode, unshared bool) (*os.File, error) {
+	if !unshared {
+		return os.OpenFile(name, flag, perm)
+	}
+
+	namep, err := syscall.UTF16PtrFromString(name)
+	if err != nil {
+		return nil, &os.PathError{Op: "open", Path: name, Err: err}
+	}
+
+	access := uint32(syscall.GENERIC_READ)
+	if flag&os.O_RDWR != 0 {
+		access |= syscall.GENERIC_WRITE
+	}
+
+	disposition := uint32(syscall.OPEN_EXISTING)
+	switch {
+	case flag&(os.O_CREATE|os.O_EXCL) == os.O_CREATE|os.O_EXCL:
+		disposition = syscall.CREATE_NEW
+	case flag&os.O_CREATE != 0:
+		disposition = syscall.OPEN_ALWAYS
+	}
+
+	attrs := uint32(syscall.FILE_ATTRIBUTE_NORMAL)
+	if flag&os.O_CREATE != 0 && perm&0200 == 0 {
+		attrs = syscall.FILE_ATTRIBUTE_READONLY
+	}
+
+	h, err := syscall.CreateFile(namep, access, 0, nil, disposition, attrs, 0)
+	if err == errorSharingViolation {
+		return nil, fmt.Errorf("%w: %s", ErrLocked, name)
+	}
+	if err != nil {
+		return nil, &os.PathError{Op: "open", Path: name, Err: err}
+	}
+
+	return os.NewFile(uintptr(h), name), nil
+}
+
+// dupFile duplicates the handle of file with DuplicateHandle.
+func dupFile(file *os.File) (*os.File, error) {
+	rc, err := file.SyscallConn()
+	if err != nil {
+		return nil, err
+	}
+
+	proc, err := syscall.GetCurrentProcess()
+	if err != nil {
+		return nil, err
+	}
+
+	var h syscall.Handle
+	var dupErr error
+	if err := rc.Control(func(fd uintptr) {
+		dupErr = syscall.DuplicateHandle(proc, syscall.Handle(fd), proc, &h, 0, false, syscall.DUPLICATE_SAME_ACCESS)
+	}); err != nil {
+		return nil, err
+	}
+	if dupErr != nil {
+		return nil, fmt.Errorf("mmapfile: DuplicateHandle failed: %w", dupErr)
+	}
+
+	return os.NewFile(uintptr(h), file.Name()), nil
+}
+
+// newMapInfo returns the page protection of the file mapping object and the
+// view access for a mapping with the given settings.
+func newMapInfo(writable bool, o options) MapInfo {
+	var info MapInfo
+	switch {
+	case o.private:
+		info = MapInfo{Prot: syscall.PAGE_WRITECOPY, Flags: syscall.FILE_MAP_COPY}
+	case writable:
+		info = MapInfo{Prot: syscall.PAGE_READWRITE, Flags: syscall.FILE_MAP_WRITE}
+	default:
+		info = MapInfo{Prot: syscall.PAGE_READONLY, Flags: syscall.FILE_MAP_READ}
+	}
+
+	return info
+}
+
+// mapFile maps the size bytes of file starting at offset off. On success, the
+// returned [MmapFile] owns file; on failure, closing file is up to the caller.
+func mapFile(file *os.File, name string, writable, writeOnly bool, off, size int64, o options) (*MmapFile, error) {
+	if err := o.checkSize(size); err != nil {
+		return nil, err
 	}
 
-	if fileSize < 0 {
+	holder := &fileHolder{file: file, borrowed: o.borrowed}
+
+	if size == 0 {
+		mf := &MmapFile{
+			data:      nil,
+			base:      off,
+			name:      name,
+			writable:  writable,
+			writeOnly: writeOnly,
+			private:   o.private,
+			exclusive: o.exclusive,
+			zeroFill:  o.zeroFill,
+			unshared:  o.unshared,
+			writeThru: o.writeThrough,
+			info:      newMapInfo(writable, o),
+			growBy:    o.growIncrement,
+			opts:      o,
+			platform:  holder,
+		}
+		runtime.SetFinalizer(mf, (*MmapFile).Close)
+
+		return mf, nil
+	}
+
+	if size < 0 {
 		return nil, fmt.Errorf("mmapfile: file %q has negative size", name)
 	}
 
-	if fileSize != int64(int(fileSize)) {
-		return nil, fmt.Errorf("mmapfile: file %q is too large", name)
+	if size > maxInt {
+		return nil, fmt.Errorf("%w: file %q is %d bytes", ErrAddressSpaceExhausted, name, size)
 	}
 
-	protect := uint32(syscall.PAGE_READONLY)
-	access := uint32(syscall.FILE_MAP_READ)
-	if writable {
-		protect = syscall.PAGE_READWRITE
-		access = syscall.FILE_MAP_WRITE
+	data, err := mmap(file, off, size, writable, o)
+	if err != nil {
+		return nil, err
+	}
+
+	mf := &MmapFile{
+		data:      data,
+		base:      off,
+		name:      name,
+		writable:  writable,
+		writeOnly: writeOnly,
+		private:   o.private,
+		exclusive: o.exclusive,
+		zeroFill:  o.zeroFill,
+		unshared:  o.unshared,
+		writeThru: o.writeThrough,
+		info:      newMapInfo(writable, o),
+		growBy:    o.growIncrement,
+		opts:      o,
+	}
+	runtime.SetFinalizer(mf, (*MmapFile).Close)
+
+	mf.platform = holder
+
+	return mf, nil
+}
+
+// mmap maps a view of the size bytes of file starting at offset off according
+// to o.
+//
+// The view itself starts at the allocation granularity boundary at or before
+// off; the returned slice starts at off and extends to the end of the view.
+func mmap(file *os.File, off, size int64, writable bool, o options) ([]byte, error) {
+	info := newMapInfo(writable, o)
+	protect, access := uint32(info.Prot), uint32(info.Flags)
+
+	adjust := off % mapAlign()
+	if size > int64(maxInt)-adjust {
+		return nil, ErrAddressSpaceExhausted
 	}
 
-	low, high := uint32(fileSize), uint32(fileSize>>32)
-	fmap, err := syscall.CreateFileMapping(syscall.Handle(f.Fd()), nil, protect, high, low, nil)
+	end := off + size
+	fmap, err := syscall.CreateFileMapping(syscall.Handle(file.Fd()), nil, protect, uint32(end>>32), uint32(end), nil)
 	if err != nil {
 		return nil, fmt.Errorf("mmapfile: CreateFileMapping failed: %w", err)
 	}
 	defer syscall.CloseHandle(fmap)
 
-	ptr, err := syscall.MapViewOfFile(fmap, access, 0, 0, uintptr(fileSize))
+	viewOff := off - adjust
+	ptr, err := syscall.MapViewOfFile(fmap, access, uint32(viewOff>>32), uint32(viewOff), uintptr(adjust+size))
+	if errors.Is(err, errNotEnoughMemory) {
+		// no free range of the address space is large enough for the view
+		return nil, fmt.Errorf("mmapfile: MapViewOfFile failed: %w: %w", ErrAddressSpaceExhausted, err)
+	}
 	if err != nil {
 		return nil, fmt.Errorf("mmapfile: MapViewOfFile failed: %w", err)
 	}
@@ -113,24 +313,115 @@ func OpenFile(name string, flag int, perm os.FileMode, size int64) (*MmapFile, e
 	// NOTE(dwisiswant0): This is safe despite the warning.
 	// ptr is an address in OS-managed memory (from MapViewOfFile), not
 	// Go-managed memory, so it cannot be moved by the GC.
-	data := unsafe.Slice((*byte)(unsafe.Pointer(ptr)), fileSize) //nolint
+	data := unsafe.Slice((*byte)(unsafe.Pointer(ptr)), adjust+size) //nolint
 
-	mf := &MmapFile{
-		data:     data,
-		name:     name,
-		writable: writable,
+	if o.populate {
+		_ = prefetch(data)
 	}
-	runtime.SetFinalizer(mf, (*MmapFile).Close)
 
-	mf.platform = &fileHolder{file: f}
+	if o.verify {
+		if err := verify(data); err != nil {
+			_ = syscall.UnmapViewOfFile(ptr)
+			return nil, err
+		}
+	}
 
-	return mf, nil
+	return data[adjust:], nil
+}
+
+// errNotEnoughMemory is ERROR_NOT_ENOUGH_MEMORY, which MapViewOfFile reports
+// when the view does not fit in the address space.
+const errNotEnoughMemory syscall.Errno = 8
+
+// allocationGranularity is the alignment required of view offsets, as
+// reported by GetSystemInfo; it is 64 KiB on all Windows versions.
+const allocationGranularity = 64 << 10
+
+// mapAlign returns the alignment required of mapping offsets.
+func mapAlign() int64 {
+	return allocationGranularity
+}
+
+// remap replaces the read-only mapping with one of file at the given size.
+//
+// The caller must hold f.mu.
+func (f *MmapFile) remap(file *os.File, size int64) error {
+	data, err := mmap(file, f.base, size, false, options{private: f.private})
+	if err != nil {
+		return err
+	}
+
+	old, _ := f.mapping()
+	f.data = data
+
+	if len(old) == 0 {
+		return nil
+	}
+
+	if err := syscall.UnmapViewOfFile(uintptr(unsafe.Pointer(&old[0]))); err != nil {
+		return fmt.Errorf("mmapfile: UnmapViewOfFile failed: %w", err)
+	}
+
+	return nil
+}
+
+// resize truncates or extends file to size and replaces the mapping with one
+// of the new size.
+//
+// The caller must hold f.mu.
+func (f *MmapFile) resize(file *os.File, size int64) error {
+	o := options{private: f.private}
+	oldSize := int64(len(f.data))
+
+	// a file cannot be truncated while a view of it is mapped
+	if m, _ := f.mapping(); len(m) > 0 {
+		if err := syscall.UnmapViewOfFile(uintptr(unsafe.Pointer(&m[0]))); err != nil {
+			return fmt.Errorf("mmapfile: UnmapViewOfFile failed: %w", err)
+		}
+		f.data = nil
+	}
+
+	if err := file.Truncate(f.base + size); err != nil {
+		if oldSize > 0 {
+			if data, mErr := mmap(file, f.base, oldSize, f.writable, o); mErr == nil {
+				f.data = data
+			}
+		}
+
+		return fmt.Errorf("mmapfile: failed to truncate file: %w", err)
+	}
+
+	if size > 0 {
+		data, err := mmap(file, f.base, size, f.writable, o)
+		if err != nil {
+			return err
+		}
+		f.data = data
+	}
+
+	return nil
+}
+
+// writeThrough is a no-op, as writes to a shared mapping already reach the
+// page cache of the file.
+func (f *MmapFile) writeThrough(off int64, n int) error {
+	return nil
 }
 
 // Close closes the memory-mapped file.
 //
+// Close unmaps the view without calling FlushViewOfFile: changes to the view
+// are already in the system cache, and are written back to the file lazily.
+// Call [Sync] first if they must be durable once Close returns.
+//
 // After Close, the [MmapFile] should not be used.
 func (f *MmapFile) Close() error {
+	return f.close(true)
+}
+
+// close implements [Close] and [CloseNoSync], which are the same here, as
+// closing never writes the mapping back itself.
+func (f *MmapFile) close(_ bool) error {
 	f.mu.Lock()
 	defer f.mu.Unlock()
 
@@ -139,27 +430,32 @@ func (f *MmapFile) Close() error {
 	}
 	f.closed = true
 
-	var err error
-
-	if fh, ok := f.platform.(*fileHolder); ok && fh.file != nil {
-		if cErr := fh.file.Close(); cErr != nil {
-			err = cErr
-		}
-		f.platform = nil
-	}
+	err := f.closeCheck()
 
 	runtime.SetFinalizer(f, nil)
 
-	if len(f.data) == 0 {
-		f.data = nil
-		return err
-	}
-
-	addr := uintptr(unsafe.Pointer(&f.data[0]))
+	m, _ := f.mapping()
+	size := int64(len(f.data))
 	f.data = nil
 
-	if unmapErr := syscall.UnmapViewOfFile(addr); unmapErr != nil && err == nil {
-		err = unmapErr
+	if len(m) > 0 && !f.memory {
+		if unmapErr := syscall.UnmapViewOfFile(uintptr(unsafe.Pointer(&m[0]))); unmapErr != nil && err == nil {
+			err = unmapErr
+		}
+	}
+
+	// the file is closed only once it is no longer mapped, so that it can be
+	// trimmed to its logical size first
+	if fh, ok := f.platform.(*fileHolder); ok && fh.file != nil {
+		if tErr := f.trim(fh.file, size); tErr != nil && err == nil {
+			err = tErr
+		}
+		if !fh.borrowed {
+			if cErr := fh.file.Close(); cErr != nil && err == nil {
+				err = cErr
+			}
+		}
+		f.platform = nil
 	}
 
 	return err
@@ -175,12 +471,14 @@ func (f *MmapFile) Sync() error {
 	if f.closed {
 		return ErrClosed
 	}
-	if !f.writable || len(f.data) == 0 {
+	if !f.writable || f.private || f.memory || len(f.data) == 0 {
 		return nil
 	}
 
 	var err error
 
+	f.dirty.Store(false)
+
 	if fh, ok := f.platform.(*fileHolder); ok && fh.file != nil {
 		if sErr := fh.file.Sync(); sErr != nil {
 			err = sErr
@@ -191,12 +489,78 @@ func (f *MmapFile) Sync() error {
 		err = flushErr
 	}
 
-	return err
+	if err != nil {
+		f.dirty.Store(true)
+		return err
+	}
+	f.stats.syncs.Add(1)
+
+	return nil
+}
+
+// SyncMeta is like [Sync], but guarantees that the modified pages are
+// flushed from the view before FlushFileBuffers is called on the underlying
+// file, so that both the data and the file metadata are durable once it
+// returns.
+//
+// This is a no-op for read-only files.
+func (f *MmapFile) SyncMeta() error {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	if f.closed {
+		return ErrClosed
+	}
+	if !f.writable || f.private || f.memory {
+		return nil
+	}
+
+	if len(f.data) > 0 {
+		f.dirty.Store(false)
+		if err := flushViewOfFile(uintptr(unsafe.Pointer(&f.data[0])), uintptr(len(f.data))); err != nil {
+			f.dirty.Store(true)
+			return err
+		}
+		f.stats.syncs.Add(1)
+	}
+
+	if fh, ok := f.platform.(*fileHolder); ok && fh.file != nil {
+		return fh.file.Sync()
+	}
+
+	return nil
+}
+
+// flushAndEvict implements [FlushAndEvict] over b, a page-aligned region of
+// the view. There is no equivalent of MADV_DONTNEED for file views, so the
+// pages are only flushed.
+//
+// The caller must hold f.mu.
+func (f *MmapFile) flushAndEvict(b []byte) error {
+	if !f.writable || f.private {
+		return nil
+	}
+
+	if err := flushViewOfFile(uintptr(unsafe.Pointer(&b[0])), uintptr(len(b))); err != nil {
+		return err
+	}
+	if fh, ok := f.platform.(*fileHolder); ok && fh.file != nil {
+		if err := fh.file.Sync(); err != nil {
+			return err
+		}
+	}
+	f.stats.syncs.Add(1)
+
+	return nil
 }
 
 var (
-	modkernel32         = syscall.NewLazyDLL("kernel32.dll")
-	procFlushViewOfFile = modkernel32.NewProc("FlushViewOfFile")
+	modkernel32               = syscall.NewLazyDLL("kernel32.dll")
+	procFlushViewOfFile       = modkernel32.NewProc("FlushViewOfFile")
+	procPrefetchVirtualMemory = modkernel32.NewProc("PrefetchVirtualMemory")
+	procVirtualProtect        = modkernel32.NewProc("VirtualProtect")
+	procLockFileEx            = modkernel32.NewProc("LockFileEx")
+	procUnlockFileEx          = modkernel32.NewProc("UnlockFileEx")
 )
 
 func flushViewOfFile(addr, length uintptr) error {
@@ -207,3 +571,105 @@ func flushViewOfFile(addr, length uintptr) error {
 
 	return nil
 }
+
+// memoryRangeEntry mirrors WIN32_MEMORY_RANGE_ENTRY.
+type memoryRangeEntry struct {
+	VirtualAddress uintptr
+	NumberOfBytes  uintptr
+}
+
+// prefetch asks the memory manager to bring the pages backing b into memory.
+//
+// PrefetchVirtualMemory is only available on Windows 8 and later; on older
+// versions this is a no-op.
+func prefetch(b []byte) error {
+	if procPrefetchVirtualMemory.Find() != nil {
+		return nil
+	}
+
+	entry := memoryRangeEntry{
+		VirtualAddress: uintptr(unsafe.Pointer(&b[0])),
+		NumberOfBytes:  uintptr(len(b)),
+	}
+
+	process, err := syscall.GetCurrentProcess()
+	if err != nil {
+		return err
+	}
+
+	r1, _, err := procPrefetchVirtualMemory.Call(uintptr(process), 1, uintptr(unsafe.Pointer(&entry)), 0)
+	if r1 == 0 {
+		return err
+	}
+
+	return nil
+}
+
+// resident is not supported on Windows.
+func resident(b []byte) ([]bool, error) {
+	return nil, ErrUnsupported
+}
+
+// setReadOnly changes the protection of the view to PAGE_READONLY.
+//
+// The caller must hold f.mu.
+func (f *MmapFile) setReadOnly() error {
+	if len(f.data) == 0 {
+		return nil
+	}
+
+	var old uint32
+	r1, _, err := procVirtualProtect.Call(uintptr(unsafe.Pointer(&f.data[0])), uintptr(len(f.data)), syscall.PAGE_READONLY, uintptr(unsafe.Pointer(&old)))
+	if r1 == 0 {
+		return fmt.Errorf("mmapfile: VirtualProtect failed: %w", err)
+	}
+
+	return nil
+}
+
+// lockfileExclusiveLock is the LOCKFILE_EXCLUSIVE_LOCK flag of LockFileEx.
+const lockfileExclusiveLock = 0x2
+
+// lockRange locks [off, off+length) of file with LockFileEx, waiting for any
+// conflicting lock to be released.
+func lockRange(file *os.File, off, length int64, exclusive bool) error {
+	var flags uintptr
+	if exclusive {
+		flags = lockfileExclusiveLock
+	}
+
+	lenLow, lenHigh, ol := lockArgs(off, length)
+	r1, _, err := procLockFileEx.Call(file.Fd(), flags, 0, lenLow, lenHigh, uintptr(unsafe.Pointer(ol)))
+	if r1 == 0 {
+		return fmt.Errorf("mmapfile: LockFileEx failed: %w", err)
+	}
+
+	return nil
+}
+
+// unlockRange unlocks [off, off+length) of file with UnlockFileEx.
+func unlockRange(file *os.File, off, length int64) error {
+	lenLow, lenHigh, ol := lockArgs(off, length)
+	r1, _, err := procUnlockFileEx.Call(file.Fd(), 0, lenLow, lenHigh, uintptr(unsafe.Pointer(ol)))
+	if r1 == 0 {
+		return fmt.Errorf("mmapfile: UnlockFileEx failed: %w", err)
+	}
+
+	return nil
+}
+
+// lockArgs converts a lock range into LockFileEx arguments. A length of zero
+// locks the largest possible range.
+func lockArgs(off, length int64) (lenLow, lenHigh uintptr, ol *syscall.Overlapped) {
+	n := uint64(length)
+	if n == 0 {
+		n = ^uint64(0)
+	}
+
+	ol = &syscall.Overlapped{
+		Offset:     uint32(off),
+		OffsetHigh: uint32(off >> 32),
+	}
+
+	return uintptr(uint32(n)), uintptr(uint32(n >> 32)), ol
+}
@@ -0,0 +1,64 @@
+package mmapfile
+
+import (
+	"io"
+	"sort"
+)
+
+// multiReaderAt is the [io.ReaderAt] returned by [NewMultiReaderAt].
+type multiReaderAt struct {
+	files  []*MmapFile
+	starts []int64 // offset of each file in the concatenation
+	ends   []int64 // cumulative end offset of each file
+}
+
+// NewMultiReaderAt returns an [io.ReaderAt] that is the logical concatenation
+// of the given files.
+//
+// File lengths are captured at construction time. Reads that cross a file
+// boundary are split across the files involved, and io.EOF is returned at the
+// end of the last file.
+func NewMultiReaderAt(files ...*MmapFile) io.ReaderAt {
+	mr := &multiReaderAt{
+		files:  files,
+		starts: make([]int64, len(files)),
+		ends:   make([]int64, len(files)),
+	}
+
+	var end int64
+	for i, f := range files {
+		mr.starts[i] = end
+		end += int64(f.Len())
+		mr.ends[i] = end
+	}
+
+	return mr
+}
+
+// ReadAt implements [io.ReaderAt].
+func (mr *multiReaderAt) ReadAt(b []byte, off int64) (n int, err error) {
+	if off < 0 {
+		return 0, ErrNegativeOffset
+	}
+
+	i := sort.Search(len(mr.ends), func(i int) bool { return mr.ends[i] > off })
+	for ; i < len(mr.files) && n < len(b); i++ {
+		want := min(int64(len(b)-n), mr.ends[i]-off)
+
+		m, err := mr.files[i].ReadAt(b[n:n+int(want)], off-mr.starts[i])
+		n += m
+		off += int64(m)
+		if err != nil && err != io.EOF {
+			return n, err
+		}
+		if int64(m) < want {
+			return n, io.EOF
+		}
+	}
+
+	if n < len(b) {
+		return n, io.EOF
+	}
+
+	return n, nil
+}
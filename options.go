@@ -0,0 +1,343 @@
+package mmapfile
+
+import "fmt"
+
+// Option configures how [OpenFileWith] and [NewFromFile] map a file.
+type Option func(*options)
+
+// options holds the settings collected from a set of [Option]s.
+type options struct {
+	private   bool
+	populate  bool
+	noReserve bool
+	exclusive bool
+	zeroFill  bool
+	borrowed  bool
+	access    accessPattern
+
+	allowSpecial  bool
+	unshared      bool
+	writeThrough  bool
+	validate      bool
+	verify        bool
+	growIncrement int64
+	readChunk     int64
+
+	exactSize    int64
+	hasExactSize bool
+	maxSize      int64
+	hasMaxSize   bool
+
+	closeCheckOff int64
+	closeCheckLen int64
+	closeCheck    func([]byte) error
+
+	backend Backend
+}
+
+// accessPattern is the expected access pattern of a mapping.
+type accessPattern int
+
+const (
+	accessNormal accessPattern = iota
+	accessSequential
+	accessRandom
+)
+
+// newOptions applies opts over the default settings.
+func newOptions(opts []Option) options {
+	var o options
+	for _, opt := range opts {
+		if opt != nil {
+			opt(&o)
+		}
+	}
+
+	return o
+}
+
+// checkSize reports whether a mapping of size bytes satisfies o.
+func (o options) checkSize(size int64) error {
+	if o.hasExactSize && size != o.exactSize {
+		return fmt.Errorf("%w: got %d bytes, want %d", ErrSizeMismatch, size, o.exactSize)
+	}
+	if o.hasMaxSize && size > o.maxSize {
+		return fmt.Errorf("%w: got %d bytes, limit %d", ErrFileTooLarge, size, o.maxSize)
+	}
+
+	return nil
+}
+
+// WithPrivate maps the file copy-on-write.
+//
+// Writes modify a private copy of the affected pages and are never written
+// back to the underlying file, nor are they visible to other mappings of the
+// same file.
+func WithPrivate() Option {
+	return func(o *options) {
+		o.private = true
+	}
+}
+
+// WithNoWriteBack makes writes affect only memory, so that neither
+// [MmapFile.Sync] nor [MmapFile.Close] ever persists them, e.g. to use a file
+// as a scratch buffer seeded with its contents.
+//
+// It is the same as [WithPrivate]: on native backends, the file is mapped
+// copy-on-write, and on the fallback backend, which reads the file into
+// memory, the buffer is never written back. Either way, the file on disk is
+// left unchanged, so cross-platform code behaves the same.
+func WithNoWriteBack() Option {
+	return WithPrivate()
+}
+
+// WithPopulate pre-faults the whole mapping at open time, so that later
+// accesses do not incur page faults.
+//
+// On Linux this uses MAP_POPULATE; on other native backends the pages are
+// prefetched right after mapping. On the fallback this is a no-op, since the
+// file is already read into memory.
+func WithPopulate() Option {
+	return func(o *options) {
+		o.populate = true
+	}
+}
+
+// WithBorrowedFd makes [NewFromFile] leave the passed file open when the
+// [MmapFile] is closed, so the caller retains ownership of the descriptor.
+//
+// It has no effect on [OpenFileWith], which always owns the file it opens.
+func WithBorrowedFd() Option {
+	return func(o *options) {
+		o.borrowed = true
+	}
+}
+
+// WithExactSize makes opening fail with [ErrSizeMismatch] unless the mapping
+// ends up exactly n bytes long.
+//
+// This is useful with [os.O_CREATE], where the size argument of
+// [OpenFileWith] is ignored for existing non-empty files.
+func WithExactSize(n int64) Option {
+	return func(o *options) {
+		o.exactSize = n
+		o.hasExactSize = true
+	}
+}
+
+// WithMaxSize makes opening fail with [ErrFileTooLarge] if the mapping would
+// be more than n bytes long, before anything is mapped or, on the fallback
+// backend, read into memory.
+//
+// This guards services that map untrusted paths against exhausting their
+// address space, or memory on the fallback, on a huge file. The limit only
+// applies at open time; see [OpenLimited].
+func WithMaxSize(n int64) Option {
+	return func(o *options) {
+		o.maxSize = n
+		o.hasMaxSize = true
+	}
+}
+
+// WithVerify makes opening read one byte of every page of the mapping, so
+// that a file that cannot be read in full, e.g. because of an I/O error on
+// network storage or because it was truncated concurrently, fails to open
+// with an error rather than crashing the program with SIGBUS on a later
+// access.
+//
+// This reads the whole file, so it costs O(file size) at open time, and it
+// only verifies the pages at that time; it is only worth it for critical data
+// on unreliable storage. It is a no-op on the fallback backend, which already
+// reads the file in full.
+func WithVerify() Option {
+	return func(o *options) {
+		o.verify = true
+	}
+}
+
+// WithSequential hints to the kernel that the mapping will be accessed
+// sequentially, e.g. by [MmapFile.WriteTo] or a full scan, so that it reads
+// ahead aggressively and frees pages soon after they are accessed.
+//
+// On Unix this issues madvise(2) with MADV_SEQUENTIAL right after mapping.
+// It is only a hint, and a no-op on other backends. WithSequential overrides a
+// preceding [WithRandom].
+func WithSequential() Option {
+	return func(o *options) {
+		o.access = accessSequential
+	}
+}
+
+// WithRandom hints to the kernel that the mapping will be accessed in random
+// order, so that it does not read ahead beyond the pages being accessed.
+//
+// On Unix this issues madvise(2) with MADV_RANDOM right after mapping. It is
+// only a hint, and a no-op on other backends. WithRandom overrides a preceding
+// [WithSequential].
+func WithRandom() Option {
+	return func(o *options) {
+		o.access = accessRandom
+	}
+}
+
+// WithNoReserve maps the file without reserving swap space for it, so that
+// mapping a large sparse file does not fail up front with ENOMEM; pages are
+// then allocated lazily as they are written.
+//
+// On Linux this uses MAP_NORESERVE. It is ignored on other platforms.
+func WithNoReserve() Option {
+	return func(o *options) {
+		o.noReserve = true
+	}
+}
+
+// WithValidate makes shared mappings on Linux use MAP_SHARED_VALIDATE instead
+// of MAP_SHARED, so that the kernel rejects mmap flags it does not support,
+// with EOPNOTSUPP, rather than silently ignoring them.
+//
+// Kernels older than 4.15, which do not know MAP_SHARED_VALIDATE, reject it
+// with EINVAL; the mapping is then transparently retried with MAP_SHARED, and
+// later mappings skip the attempt. [MmapFile.MapInfo] reports the flags that
+// were used. It is a no-op for private mappings and on other platforms.
+func WithValidate() Option {
+	return func(o *options) {
+		o.validate = true
+	}
+}
+
+// WithExclusiveWriteAt makes [MmapFile.WriteAt] and [MmapFile.WriteAtv]
+// serialize with each other and with all reads, so that overlapping writes
+// never interleave and readers never observe a partially applied write.
+//
+// This trades concurrency for determinism, for when the application cannot
+// guarantee that concurrent writes target disjoint ranges.
+func WithExclusiveWriteAt() Option {
+	return func(o *options) {
+		o.exclusive = true
+	}
+}
+
+// WithAllowSpecial allows mapping files other than regular files, such as
+// character devices, which are otherwise rejected with [ErrNotRegularFile].
+// Directories are always rejected.
+//
+// Special files have no meaningful size, so [OpenFileWith] maps exactly the
+// size bytes requested instead, and [NewFromFile] maps nothing.
+func WithAllowSpecial() Option {
+	return func(o *options) {
+		o.allowSpecial = true
+	}
+}
+
+// WithZeroFillReads makes reads past the end of the file yield zeros instead
+// of io.EOF, up to the capacity of the mapping, as for the uninitialized pages
+// of an arena.
+//
+// The length of the file, as reported by [MmapFile.Len], is its logical size.
+// The mapping itself extends to the end of the page holding the last byte,
+// and that capacity is where [MmapFile.Read] and [MmapFile.ReadAt] report
+// io.EOF with this option. Writes are still limited to the logical size.
+func WithZeroFillReads() Option {
+	return func(o *options) {
+		o.zeroFill = true
+	}
+}
+
+// WithGrowIncrement makes writes past the end of a writable, shared file grow
+// it instead of failing with [ErrWriteOutOfBounds].
+//
+// When a write does not fit in the current mapping, the file is extended and
+// remapped to n bytes beyond the end of the write, so that subsequent writes
+// within that headroom only extend the logical length, as reported by
+// [MmapFile.Len], without remapping. [MmapFile.Capacity] reports the size of
+// the mapping. A larger n trades disk space for fewer remaps in append-heavy
+// workloads; n <= 0 disables growth.
+//
+// Until the file is closed, it holds Capacity bytes, of which those past Len
+// are zero; [MmapFile.Close] truncates it to Len. With this option,
+// [MmapFile.WriteAt] and [MmapFile.WriteAtv] take the write lock, as for
+// [WithExclusiveWriteAt].
+func WithGrowIncrement(n int64) Option {
+	return func(o *options) {
+		o.growIncrement = max(n, 0)
+	}
+}
+
+// defaultReadChunk is the default size of the window that [MmapFile.ReadFrom]
+// passes to each Read of its reader.
+const defaultReadChunk = 4 << 20
+
+// WithReadChunkSize sets the size of the window of the mapping that
+// [MmapFile.ReadFrom] and related methods pass to each Read call of the
+// reader, 4 MiB by default; n <= 0 restores the default.
+//
+// Bounding the window keeps a reader that tries to fill its whole buffer,
+// e.g. one reading a large file in a single system call, from faulting in the
+// whole remainder of a large mapping at once, so progress is made, and
+// reflected in the file offset, chunk by chunk. Readers that return what is
+// available, such as a [net.Conn], are unaffected either way.
+func WithReadChunkSize(n int64) Option {
+	return func(o *options) {
+		o.readChunk = n
+	}
+}
+
+// WithShared controls whether [OpenFileWith] lets other openers use the file
+// concurrently. With shared set to false, the file is opened exclusively, so
+// that a concurrent exclusive open fails fast with [ErrLocked] instead of two
+// writers mapping the same file; [MmapFile.IsExclusive] then reports true.
+// The default is shared.
+//
+// The semantics differ by platform:
+//   - On Unix, an advisory flock(2) lock is taken, which only conflicts with
+//     other exclusive opens; plain opens of the file still succeed.
+//   - On Windows, the file is opened without sharing, so any other open of
+//     the file, exclusive or not, fails while it is open, and an exclusive
+//     open fails if the file is already open elsewhere.
+//   - The fallback backend returns [ErrUnsupported].
+//
+// The lock is released when the file is closed. WithShared has no effect on
+// [NewFromFile], as the file is already open.
+func WithShared(shared bool) Option {
+	return func(o *options) {
+		o.unshared = !shared
+	}
+}
+
+// WithCloseChecksum makes [MmapFile.Close] call verify with the region
+// [headerOff, headerOff+headerLen) of the mapping, e.g. to check that a
+// header checksum still matches the data, and return the error it reports,
+// so that in-memory corruption of a long-running writable mapping does not go
+// unnoticed. The region is clamped to the end of the file, and verify runs
+// under the lock, before the file is unmapped; it must not retain the slice.
+//
+// The file is closed either way. On the fallback backend, a failed check also
+// skips writing the in-memory copy back, so the corruption is not persisted.
+// Native backends cannot hold the changes back, as they are already in the
+// page cache, but the error still flags the file as suspect.
+func WithCloseChecksum(headerOff, headerLen int64, verify func([]byte) error) Option {
+	return func(o *options) {
+		o.closeCheckOff = max(headerOff, 0)
+		o.closeCheckLen = max(headerLen, 0)
+		o.closeCheck = verify
+	}
+}
+
+// WithWriteThrough makes the fallback backend write every change to the file
+// as it is made, in addition to updating its in-memory copy.
+//
+// Without it, changes on the fallback only reach the file on [MmapFile.Sync]
+// or [MmapFile.Close], so a crash loses all of them, whereas the page cache
+// behind a real mapping keeps writes that have been made. With it, each
+// [MmapFile.Write], [MmapFile.WriteAt], and related call costs an additional
+// write system call, without an fsync, so it is only worth it for
+// crash-tolerant code; writes through the slice returned by [MmapFile.Bytes]
+// are still only written back on Sync or Close.
+//
+// It has no effect on native backends, where writes to the mapping already
+// reach the file.
+func WithWriteThrough() Option {
+	return func(o *options) {
+		o.writeThrough = true
+	}
+}
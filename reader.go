@@ -0,0 +1,87 @@
+package mmapfile
+
+import (
+	"io"
+	"math"
+)
+
+// Reader reads an [MmapFile] with its own offset, like a [bytes.Reader] over
+// the mapping, so that multiple readers can progress independently of each
+// other and of the file offset used by [MmapFile.Read]/[MmapFile.Seek].
+//
+// Reads are served from the mapping by [MmapFile.ReadAt], so they see writes
+// made to the file, and return [ErrClosed] once it is closed. A Reader is not
+// safe for concurrent use, though distinct Readers of the same file are.
+type Reader struct {
+	f   *MmapFile
+	off int64
+}
+
+// Compile-time interface checks.
+var (
+	_ io.ReadSeeker = (*Reader)(nil)
+	_ io.ReaderAt   = (*Reader)(nil)
+)
+
+// Reader returns a new [Reader] positioned at the start of the file.
+func (f *MmapFile) Reader() *Reader {
+	return &Reader{f: f}
+}
+
+// Read reads up to len(b) bytes, advancing the offset of the reader. At the
+// end of the file, it behaves like [MmapFile.Read].
+func (r *Reader) Read(b []byte) (n int, err error) {
+	n, err = r.f.ReadAt(b, r.off)
+	r.off += int64(n)
+
+	return n, err
+}
+
+// ReadAt reads len(b) bytes at offset off, like [MmapFile.ReadAt]. It does
+// not affect the offset of the reader.
+func (r *Reader) ReadAt(b []byte, off int64) (n int, err error) {
+	return r.f.ReadAt(b, off)
+}
+
+// Seek sets the offset of the reader for the next Read, with the same
+// semantics as [MmapFile.Seek].
+func (r *Reader) Seek(offset int64, whence int) (int64, error) {
+	r.f.mu.RLock()
+	closed, size := r.f.closed, int64(len(r.f.data))
+	r.f.mu.RUnlock()
+
+	if closed {
+		return 0, ErrClosed
+	}
+
+	var base int64
+	switch whence {
+	case io.SeekStart:
+		base = 0
+	case io.SeekCurrent:
+		base = r.off
+	case io.SeekEnd:
+		base = size
+	default:
+		return 0, ErrInvalidWhence
+	}
+
+	if offset > 0 && base > math.MaxInt64-offset {
+		return 0, ErrOffsetTooLarge
+	}
+	newOffset := base + offset
+
+	if newOffset < 0 {
+		return 0, ErrNegativeOffset
+	}
+
+	r.off = newOffset
+
+	return newOffset, nil
+}
+
+// Size returns the size of the underlying file, which is the range of valid
+// offsets for ReadAt; see [MmapFile.Len].
+func (r *Reader) Size() int64 {
+	return int64(r.f.Len())
+}
@@ -0,0 +1,76 @@
+package mmapfile
+
+import (
+	"io"
+	"os"
+)
+
+// ReadOnlyFile is a read-only view of an [MmapFile], as returned by
+// [OpenReadSeeker]. It has no methods that modify the file, so code that holds
+// one cannot write to it by accident.
+type ReadOnlyFile interface {
+	io.ReadSeekCloser
+	io.ReaderAt
+
+	// Len returns the size of the file in bytes.
+	Len() int
+
+	// Stat returns the [os.FileInfo] of the file.
+	Stat() (os.FileInfo, error)
+}
+
+// OpenReadSeeker opens the named file for reading like [Open], but returns it
+// behind the restricted [ReadOnlyFile] interface, for code that only needs an
+// [io.ReadSeeker] or [io.ReaderAt] and wants the compiler to rule out writes.
+//
+// The returned value wraps the [MmapFile], so it cannot be converted back to
+// one with a type assertion. It also implements [io.WriterTo], so that
+// [io.Copy] from it writes the mapping directly.
+func OpenReadSeeker(name string) (ReadOnlyFile, error) {
+	f, err := Open(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return readOnlyFile{f}, nil
+}
+
+// readOnlyFile forwards the read-only methods of [MmapFile].
+type readOnlyFile struct {
+	f *MmapFile
+}
+
+// Read implements [io.Reader].
+func (r readOnlyFile) Read(b []byte) (int, error) {
+	return r.f.Read(b)
+}
+
+// ReadAt implements [io.ReaderAt].
+func (r readOnlyFile) ReadAt(b []byte, off int64) (int, error) {
+	return r.f.ReadAt(b, off)
+}
+
+// Seek implements [io.Seeker].
+func (r readOnlyFile) Seek(offset int64, whence int) (int64, error) {
+	return r.f.Seek(offset, whence)
+}
+
+// WriteTo implements [io.WriterTo].
+func (r readOnlyFile) WriteTo(w io.Writer) (int64, error) {
+	return r.f.WriteTo(w)
+}
+
+// Close implements [io.Closer].
+func (r readOnlyFile) Close() error {
+	return r.f.Close()
+}
+
+// Len implements [ReadOnlyFile].
+func (r readOnlyFile) Len() int {
+	return r.f.Len()
+}
+
+// Stat implements [ReadOnlyFile].
+func (r readOnlyFile) Stat() (os.FileInfo, error) {
+	return r.f.Stat()
+}
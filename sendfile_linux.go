@@ -0,0 +1,137 @@
+//go:build linux
+
+package mmapfile
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"syscall"
+)
+
+// maxSendfileChunk is the largest count passed to a single sendfile(2) call,
+// matching the kernel's own per-call limit.
+const maxSendfileChunk = 0x7ffff000
+
+// sendfile copies the region [off, off+size) of the file contents, which must
+// be in bounds, to w with sendfile(2) when w is an [os.File], so the data does
+// not pass through user space. It reports whether it handled the copy; if
+// not, the caller should write f.data itself.
+//
+// The caller must hold f.mu.
+func (f *MmapFile) sendfile(w io.Writer, off, size int64) (n int64, handled bool, err error) {
+	dst, ok := w.(*os.File)
+	if !ok || f.private || size == 0 {
+		// private mappings may hold changes the file does not
+		return 0, false, nil
+	}
+
+	fh, ok := f.platform.(*fileHolder)
+	if !ok || fh.file == nil {
+		return 0, false, nil
+	}
+
+	rc, err := dst.SyscallConn()
+	if err != nil {
+		return 0, false, nil
+	}
+
+	src := int(fh.file.Fd())
+
+	var sendErr error
+	ctlErr := rc.Write(func(fd uintptr) bool {
+		for n < size {
+			srcOff := f.base + off + n
+			m, err := syscall.Sendfile(int(fd), src, &srcOff, int(min(size-n, maxSendfileChunk)))
+			if m > 0 {
+				n += int64(m)
+			}
+
+			switch {
+			case err == syscall.EINTR:
+				continue
+			case err == syscall.EAGAIN:
+				return false // wait until dst is writable
+			case err != nil:
+				sendErr = err
+				return true
+			case m == 0:
+				return true // file was truncated underneath the mapping
+			}
+		}
+
+		return true
+	})
+
+	if n == 0 && (ctlErr != nil || errors.Is(sendErr, syscall.EINVAL) || errors.Is(sendErr, syscall.ENOSYS)) {
+		// dst does not support sendfile, e.g. it was opened with O_APPEND
+		return 0, false, nil
+	}
+	if ctlErr != nil {
+		return n, true, ctlErr
+	}
+	if sendErr != nil {
+		return n, true, fmt.Errorf("mmapfile: sendfile failed: %w", sendErr)
+	}
+
+	if n < size {
+		m, err := dst.Write(f.data[off+n : off+size])
+		return n + int64(m), true, err
+	}
+
+	return n, true, nil
+}
+
+// copyFrom copies r into the file at the file offset when r is an [os.File],
+// or an [io.LimitedReader] of one, so that [os.File.ReadFrom] can use
+// copy_file_range(2), or sendfile(2) on older kernels, and the data does not
+// pass through user space. It copies at most up to the end of the mapping,
+// and reports whether it handled the copy; if not, the caller should read r
+// into f.data itself.
+//
+// The shared mapping and the file are backed by the same page cache, so the
+// mapping reflects the copied data as soon as the call returns.
+//
+// The caller must hold f.mu.
+func (f *MmapFile) copyFrom(r io.Reader) (n int64, handled bool, err error) {
+	limit := int64(len(f.data)) - f.offset
+	lr, limited := r.(*io.LimitedReader)
+	if limited {
+		r, limit = lr.R, min(limit, lr.N)
+	}
+
+	src, ok := r.(*os.File)
+	if !ok || f.private || limit <= 0 {
+		// private mappings would not see what is written to the file
+		return 0, false, nil
+	}
+
+	fh, ok := f.platform.(*fileHolder)
+	if !ok || fh.file == nil {
+		return 0, false, nil
+	}
+
+	// the file offset of a borrowed fd belongs to the caller, so restore it
+	pos, err := fh.file.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return 0, false, nil
+	}
+	if _, err := fh.file.Seek(f.base+f.offset, io.SeekStart); err != nil {
+		return 0, false, nil
+	}
+
+	n, err = fh.file.ReadFrom(&io.LimitedReader{R: src, N: limit})
+	if _, sErr := fh.file.Seek(pos, io.SeekStart); sErr != nil && err == nil {
+		err = sErr
+	}
+	if n > 0 {
+		f.dirty.Store(true)
+	}
+	f.offset += n
+	if limited {
+		lr.N -= n
+	}
+
+	return n, true, err
+}
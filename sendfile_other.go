@@ -0,0 +1,17 @@
+//go:build !linux
+
+package mmapfile
+
+import "io"
+
+// sendfile reports that the copy was not handled, so that [MmapFile.WriteTo]
+// and [MmapFile.WriteRangeTo] write the mapping directly.
+func (f *MmapFile) sendfile(w io.Writer, off, size int64) (n int64, handled bool, err error) {
+	return 0, false, nil
+}
+
+// copyFrom reports that the copy was not handled, so that [MmapFile.ReadFrom]
+// reads into the mapping directly.
+func (f *MmapFile) copyFrom(r io.Reader) (n int64, handled bool, err error) {
+	return 0, false, nil
+}
@@ -0,0 +1,213 @@
+package mmapfile
+
+import (
+	"os"
+	"sync"
+	"sync/atomic"
+)
+
+// SharedFile is a reference-counted handle to a file opened with
+// [OpenShared]. All handles to the same file share a single mapping, which is
+// unmapped when the last of them is closed.
+//
+// A handle only exposes positional I/O, as a file offset or a change to the
+// size or mode of the mapping would be shared with every other handle. Its
+// methods return [ErrClosed] once the handle is closed, even while the
+// mapping stays open for the other handles, and a handle opened with
+// [os.O_RDONLY] cannot write, even if the mapping is writable.
+type SharedFile struct {
+	entry    *sharedEntry
+	writable bool
+	closed   atomic.Bool
+}
+
+// sharedEntry is an open file in the registry of [OpenShared].
+type sharedEntry struct {
+	f    *MmapFile
+	fi   os.FileInfo
+	refs int
+}
+
+// shared is the registry of files opened with [OpenShared].
+var shared struct {
+	mu      sync.Mutex
+	entries []*sharedEntry
+}
+
+// OpenShared opens the named file like [OpenFile] with the given flag, which
+// must be [os.O_RDONLY] or [os.O_RDWR], unless it is already open through
+// OpenShared, in which case it returns a new handle to the existing mapping,
+// e.g. for components of an embedded database that open the same file on
+// their own. Files are identified by device and inode, so different paths to
+// the same file, such as hard links, share a mapping too.
+//
+// The file must exist, and its mapping keeps the mode of the first opener:
+// OpenShared returns [ErrReadOnly] when flag is [os.O_RDWR] and the file is
+// already mapped read-only.
+func OpenShared(name string, flag int) (*SharedFile, error) {
+	shared.mu.Lock()
+	defer shared.mu.Unlock()
+
+	fi, err := os.Stat(name)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, e := range shared.entries {
+		if !os.SameFile(e.fi, fi) {
+			continue
+		}
+		if flag&(os.O_WRONLY|os.O_RDWR) != 0 && e.f.ReadOnly() {
+			return nil, ErrReadOnly
+		}
+		e.refs++
+
+		return &SharedFile{entry: e, writable: flag&(os.O_WRONLY|os.O_RDWR) != 0}, nil
+	}
+
+	f, err := OpenFile(name, flag&(os.O_WRONLY|os.O_RDWR), 0, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	e := &sharedEntry{f: f, fi: fi, refs: 1}
+	shared.entries = append(shared.entries, e)
+
+	return &SharedFile{entry: e, writable: !f.ReadOnly()}, nil
+}
+
+// file returns the shared [MmapFile], or [ErrClosed] once the handle is
+// closed.
+func (s *SharedFile) file() (*MmapFile, error) {
+	if s.closed.Load() {
+		return nil, ErrClosed
+	}
+
+	return s.entry.f, nil
+}
+
+// Name returns the name the file was first opened with by [OpenShared].
+func (s *SharedFile) Name() string {
+	return s.entry.f.Name()
+}
+
+// ReadOnly reports whether the handle was opened read-only.
+func (s *SharedFile) ReadOnly() bool {
+	return !s.writable
+}
+
+// Len returns the length of the shared mapping, or 0 once the handle is
+// closed.
+func (s *SharedFile) Len() int {
+	f, err := s.file()
+	if err != nil {
+		return 0
+	}
+
+	return f.Len()
+}
+
+// Stat returns the [os.FileInfo] of the file, like [MmapFile.Stat].
+func (s *SharedFile) Stat() (os.FileInfo, error) {
+	f, err := s.file()
+	if err != nil {
+		return nil, err
+	}
+
+	return f.Stat()
+}
+
+// ReadAt implements [io.ReaderAt].
+func (s *SharedFile) ReadAt(b []byte, off int64) (int, error) {
+	f, err := s.file()
+	if err != nil {
+		return 0, err
+	}
+
+	return f.ReadAt(b, off)
+}
+
+// WriteAt implements [io.WriterAt]. It returns [ErrReadOnly] for a read-only
+// handle.
+func (s *SharedFile) WriteAt(b []byte, off int64) (int, error) {
+	f, err := s.file()
+	if err != nil {
+		return 0, err
+	}
+	if !s.writable {
+		return 0, ErrReadOnly
+	}
+
+	return f.WriteAt(b, off)
+}
+
+// Sync flushes changes to the shared mapping to the file, like
+// [MmapFile.Sync]. It returns [ErrReadOnly] for a read-only handle.
+func (s *SharedFile) Sync() error {
+	f, err := s.file()
+	if err != nil {
+		return err
+	}
+	if !s.writable {
+		return ErrReadOnly
+	}
+
+	return f.Sync()
+}
+
+// Close releases the handle. The file is closed once all handles to it are;
+// until then, Close returns nil and the mapping stays valid for the other
+// handles. Closing a handle more than once returns [ErrClosed].
+func (s *SharedFile) Close() error {
+	return s.release((*MmapFile).Close, false)
+}
+
+// CloseNoSync is like [SharedFile.Close], but closes the file with
+// [MmapFile.CloseNoSync] if this is the last handle to it.
+func (s *SharedFile) CloseNoSync() error {
+	return s.release((*MmapFile).CloseNoSync, false)
+}
+
+// Remove is like [MmapFile.Remove] for the last handle to the file. It returns
+// [ErrInUse] without releasing the handle if other handles to the file are
+// still open, as they rely on the mapping, and [ErrClosed] if the handle has
+// already been released.
+func (s *SharedFile) Remove() error {
+	return s.release((*MmapFile).Remove, true)
+}
+
+// Reopen returns [ErrUnsupported], as a released handle is not reopened; call
+// [OpenShared] again to get a new one.
+func (s *SharedFile) Reopen() error {
+	return ErrUnsupported
+}
+
+// release releases the handle, and closes the file with closeFn if it was the
+// last handle to it. If last is set, release returns [ErrInUse] and keeps the
+// handle instead when other handles are open.
+func (s *SharedFile) release(closeFn func(*MmapFile) error, last bool) error {
+	shared.mu.Lock()
+	defer shared.mu.Unlock()
+
+	if s.closed.Load() {
+		return ErrClosed
+	}
+	if last && s.entry.refs > 1 {
+		return ErrInUse
+	}
+	s.closed.Store(true)
+
+	s.entry.refs--
+	if s.entry.refs > 0 {
+		return nil
+	}
+
+	for i, e := range shared.entries {
+		if e == s.entry {
+			shared.entries = append(shared.entries[:i], shared.entries[i+1:]...)
+			break
+		}
+	}
+
+	return closeFn(s.entry.f)
+}
@@ -0,0 +1,50 @@
+package mmapfile
+
+import "unsafe"
+
+// AsSlice returns the mapping of f reinterpreted as a slice of T, e.g. to
+// index a dataset of float64 values without decoding it.
+//
+// T must be a fixed-size type without pointers, such as a number or a struct
+// of numbers; the elements are read in native byte order and layout, so a
+// file written on a machine of different endianness reads back garbled. The
+// slice aliases the mapping like [MmapFile.Bytes]: it is only valid until the
+// file is closed or remapped, assigning to its elements on a writable file
+// writes to the file, and calling AsSlice on a writable file marks it as
+// modified.
+//
+// It returns [ErrPartialRecord] if the size of the file is not a multiple of
+// the size of T, [ErrMisaligned] if the mapping is not suitably aligned for
+// T, e.g. when opened at an unaligned offset with [OpenFileAt], and
+// [ErrUnsupported] if T has a size of zero. An empty file yields a nil slice.
+func AsSlice[T any](f *MmapFile) ([]T, error) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	if f.closed {
+		return nil, ErrClosed
+	}
+	if f.writeOnly {
+		return nil, ErrWriteOnly
+	}
+
+	var zero T
+	size := unsafe.Sizeof(zero)
+	if size == 0 {
+		return nil, ErrUnsupported
+	}
+	if uintptr(len(f.data))%size != 0 {
+		return nil, ErrPartialRecord
+	}
+	if len(f.data) == 0 {
+		return nil, nil
+	}
+	if uintptr(unsafe.Pointer(&f.data[0]))%unsafe.Alignof(zero) != 0 {
+		return nil, ErrMisaligned
+	}
+	if f.writable {
+		f.dirty.Store(true)
+	}
+
+	return unsafe.Slice((*T)(unsafe.Pointer(&f.data[0])), uintptr(len(f.data))/size), nil
+}
@@ -0,0 +1,83 @@
+package mmapfile
+
+import "sync/atomic"
+
+// Stats holds I/O counters of an [MmapFile], as returned by [MmapFile.Stats].
+//
+// Reads and Writes count calls, including failed ones, of the methods that
+// copy data out of and into the file respectively, such as [MmapFile.ReadAt],
+// [MmapFile.WriteTo], [MmapFile.WriteAt], [MmapFile.ReadFrom], and
+// [CopyRangeBetween] into the file, and BytesRead and BytesWritten the bytes
+// they transferred. Accesses through the slice returned by [MmapFile.Bytes],
+// a [View], or the atomic accessors are not counted. Syncs counts successful
+// flushes by [MmapFile.Sync] and [MmapFile.SyncMeta], including those made on
+// behalf of other methods.
+type Stats struct {
+	Reads        int64
+	BytesRead    int64
+	Writes       int64
+	BytesWritten int64
+	Syncs        int64
+}
+
+// stats holds the live counters behind [Stats], updated without f.mu.
+type stats struct {
+	reads        atomic.Int64
+	bytesRead    atomic.Int64
+	writes       atomic.Int64
+	bytesWritten atomic.Int64
+	syncs        atomic.Int64
+	highWater    atomic.Int64 // see MmapFile.HighWater
+}
+
+// Stats returns a snapshot of the I/O counters of the file. The counters are
+// updated atomically, so each is accurate, but they are not read together, so
+// the snapshot may be torn across concurrent operations.
+func (f *MmapFile) Stats() Stats {
+	return Stats{
+		Reads:        f.stats.reads.Load(),
+		BytesRead:    f.stats.bytesRead.Load(),
+		Writes:       f.stats.writes.Load(),
+		BytesWritten: f.stats.bytesWritten.Load(),
+		Syncs:        f.stats.syncs.Load(),
+	}
+}
+
+// countRead records a read of *n bytes in s. It takes a pointer so that it can
+// be deferred before the result is known.
+func countRead[T int | int64](s *stats, n *T) {
+	s.reads.Add(1)
+	s.bytesRead.Add(int64(*n))
+}
+
+// countWrite records a write of *n bytes at off in s, like countRead, and
+// raises the high-water mark to its end.
+func countWrite[T int | int64](s *stats, off int64, n *T) {
+	s.writes.Add(1)
+	s.bytesWritten.Add(int64(*n))
+	if *n > 0 {
+		s.raiseHighWater(off + int64(*n))
+	}
+}
+
+// raiseHighWater raises the high-water mark to end, unless it is already
+// higher.
+func (s *stats) raiseHighWater(end int64) {
+	for {
+		hw := s.highWater.Load()
+		if hw >= end || s.highWater.CompareAndSwap(hw, end) {
+			return
+		}
+	}
+}
+
+// lowerHighWater lowers the high-water mark to size, e.g. after the file is
+// truncated, unless it is already lower.
+func (s *stats) lowerHighWater(size int64) {
+	for {
+		hw := s.highWater.Load()
+		if hw <= size || s.highWater.CompareAndSwap(hw, size) {
+			return
+		}
+	}
+}
@@ -0,0 +1,15 @@
+//go:build linux
+
+package mmapfile
+
+import "syscall"
+
+// hugepage issues madvise(2) with MADV_HUGEPAGE, or MADV_NOHUGEPAGE if enable
+// is false, over b, which must start on a page boundary.
+func hugepage(b []byte, enable bool) error {
+	if enable {
+		return madvise(b, syscall.MADV_HUGEPAGE)
+	}
+
+	return madvise(b, syscall.MADV_NOHUGEPAGE)
+}
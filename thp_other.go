@@ -0,0 +1,8 @@
+//go:build !linux
+
+package mmapfile
+
+// hugepage is a no-op, as transparent huge pages are Linux-specific.
+func hugepage(b []byte, enable bool) error {
+	return nil
+}
@@ -0,0 +1,121 @@
+package mmapfile
+
+import "encoding/binary"
+
+// View is a fixed region of an [MmapFile], e.g. a header or record of a binary
+// format, accessed with offsets relative to the start of the region.
+//
+// All accesses are bounds-checked against the region. A View is only valid
+// for the generation of the file it was created in (see
+// [MmapFile.Generation]); once the file is remapped, its methods return
+// [ErrStaleView], and once the file is closed, [ErrClosed].
+type View struct {
+	f      *MmapFile
+	off    int64
+	length int64
+	gen    uint64
+}
+
+// View returns a [View] over the region [off, off+length) of the file.
+//
+// It returns [ErrNegativeOffset] if off or length is negative, and
+// [ErrOutOfRange] if the region extends past the end of the file.
+func (f *MmapFile) View(off, length int64) (*View, error) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	if f.closed {
+		return nil, ErrClosed
+	}
+	if err := f.validRange(off, length); err != nil {
+		return nil, err
+	}
+
+	return &View{f: f, off: off, length: length, gen: f.gen}, nil
+}
+
+// Offset returns the offset of the view within the file.
+func (v *View) Offset() int64 {
+	return v.off
+}
+
+// Len returns the length of the view in bytes.
+func (v *View) Len() int64 {
+	return v.length
+}
+
+// Bytes returns a copy of the n bytes at relOff within the view.
+func (v *View) Bytes(relOff, n int64) ([]byte, error) {
+	v.f.mu.RLock()
+	defer v.f.mu.RUnlock()
+
+	region, err := v.region(relOff, n)
+	if err != nil {
+		return nil, err
+	}
+	if v.f.writeOnly {
+		return nil, ErrWriteOnly
+	}
+
+	b := make([]byte, n)
+	copy(b, region)
+
+	return b, nil
+}
+
+// Uint32 decodes the uint32 at relOff within the view using bo.
+func (v *View) Uint32(relOff int64, bo binary.ByteOrder) (uint32, error) {
+	v.f.mu.RLock()
+	defer v.f.mu.RUnlock()
+
+	region, err := v.region(relOff, 4)
+	if err != nil {
+		return 0, err
+	}
+	if v.f.writeOnly {
+		return 0, ErrWriteOnly
+	}
+
+	return bo.Uint32(region), nil
+}
+
+// WriteUint32 encodes val at relOff within the view using bo.
+func (v *View) WriteUint32(relOff int64, val uint32, bo binary.ByteOrder) error {
+	v.f.mu.RLock()
+	defer v.f.mu.RUnlock()
+
+	region, err := v.region(relOff, 4)
+	if err != nil {
+		return err
+	}
+	if !v.f.writable {
+		return ErrReadOnly
+	}
+
+	v.f.dirty.Store(true)
+	bo.PutUint32(region, val)
+
+	return v.f.writeThrough(v.off+relOff, 4)
+}
+
+// region returns the n bytes at relOff within the view.
+//
+// The caller must hold v.f.mu.
+func (v *View) region(relOff, n int64) ([]byte, error) {
+	if v.f.closed {
+		return nil, ErrClosed
+	}
+	if v.f.gen != v.gen {
+		return nil, ErrStaleView
+	}
+	if relOff < 0 || n < 0 {
+		return nil, ErrNegativeOffset
+	}
+	if relOff > v.length || n > v.length-relOff {
+		return nil, ErrOutOfRange
+	}
+
+	start := v.off + relOff
+
+	return v.f.data[start : start+n], nil
+}